@@ -23,8 +23,8 @@ async function init() {
     u_mouse: { type: "v2", value: new THREE.Vector2() }
   };
 
-  const vertexShader = await loadShaderSource('shader.vert')
-  const fragmentShader = await loadShaderSource('shader.frag')
+  const vertexShader = await loadShaderSource(container.dataset.vert)
+  const fragmentShader = await loadShaderSource(container.dataset.frag)
 
   const material = new THREE.ShaderMaterial(
     {
@@ -51,9 +51,8 @@ async function init() {
   }
 }
 
-async function loadShaderSource(name) {
-  const pathPrefix = "../shaders";
-  const shaderResponse = await fetch(`${pathPrefix}/${name}`);
+async function loadShaderSource(path) {
+  const shaderResponse = await fetch(path);
   const shaderSource = await shaderResponse.text();
   return shaderSource;
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	goruntime "runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/krmckone/lk-site/internal/links"
+	"github.com/krmckone/lk-site/internal/server"
+	"github.com/krmckone/lk-site/internal/templating"
+	"github.com/krmckone/lk-site/internal/utils"
+)
+
+// version is set at link time with -ldflags "-X main.version=...". Otherwise
+// it comes from the module version or VCS revision go embeds in the binary
+var version = ""
+
+var commands = []command{
+	{
+		name:  "build",
+		short: "Build the site",
+		long:  "Build templates every page under the assets directory and writes the site to the build directory.",
+		setup: setupBuild,
+	},
+	{
+		name:    "serve",
+		aliases: []string{"server"},
+		short:   "Serve the site locally and rebuild on changes",
+		long:    "Serve builds the site and serves the build directory, rebuilding and reloading open pages when the assets or configs change.",
+		setup:   setupServe,
+	},
+	{
+		name:  "new",
+		args:  "<section/name>",
+		short: "Create a new page",
+		long:  "New creates a markdown page under the pages directory, e.g. 'lk-site new posts/my_post' creates assets/pages/posts/my_post.md, with front matter for its title and date.",
+		setup: setupNew,
+	},
+	{
+		name:  "check",
+		short: "Build the site and check for broken links",
+		long:  "Check builds the site to a temporary directory and reports every link between pages and assets that doesn't resolve. The build directory isn't touched.",
+		setup: setupCheck,
+	},
+	{
+		name:  "clean",
+		short: "Remove the build directory and build cache",
+		long:  "Clean removes the build directory and the build cache so that the next build starts from scratch.",
+		setup: setupClean,
+	},
+	{
+		name:  "version",
+		short: "Print the version",
+		long:  "Version prints the version of lk-site.",
+		setup: setupVersion,
+	},
+}
+
+// buildFlags registers the flags for commands that build the site
+func buildFlags(flags *flag.FlagSet, runtime *utils.RuntimeConfig) {
+	flags.BoolVar(&runtime.BuildDrafts, "drafts", false, "Include pages marked as drafts")
+	flags.BoolVar(&runtime.BuildFuture, "future", false, "Include pages with a publish date in the future")
+	flags.IntVar(&runtime.Workers, "j", goruntime.GOMAXPROCS(0), "Number of pages to render concurrently")
+	flags.BoolVar(&runtime.Offline, "offline", false, "Never call remote APIs, only use cached responses")
+	flags.StringVar(&runtime.SteamFixture, "steam-fixture", "", "Directory of fake Steam API responses to build with instead of calling the API, e.g. test/steam")
+}
+
+// noArgs wraps a command that doesn't take arguments
+func noArgs(run func() error) func(args []string) error {
+	return func(args []string) error {
+		if len(args) > 0 {
+			return usageError{fmt.Sprintf("unexpected arguments %q", args)}
+		}
+		return run()
+	}
+}
+
+func setupBuild(flags *flag.FlagSet, runtime *utils.RuntimeConfig, stdout io.Writer) func(args []string) error {
+	buildFlags(flags, runtime)
+	flags.BoolVar(&runtime.Force, "force", false, "Rebuild everything, ignoring the build cache")
+	flags.BoolVar(&runtime.RecordPlaytime, "record-playtime", false, "Add today's Steam playtime to the history under the assets data directory")
+	return noArgs(func() error {
+		return templating.TemplateSite(*runtime)
+	})
+}
+
+func setupServe(flags *flag.FlagSet, runtime *utils.RuntimeConfig, stdout io.Writer) func(args []string) error {
+	buildFlags(flags, runtime)
+	port := flags.Int("port", 8080, "Port to serve the site on")
+	return noArgs(func() error {
+		return server.ListenAndServe(*runtime, fmt.Sprintf(":%d", *port), templating.TemplateSite)
+	})
+}
+
+func setupNew(flags *flag.FlagSet, runtime *utils.RuntimeConfig, stdout io.Writer) func(args []string) error {
+	title := flags.String("title", "", "Title of the page, derived from the name by default")
+	draft := flags.Bool("draft", true, "Mark the page as a draft")
+	return func(args []string) error {
+		if len(args) != 1 {
+			return usageError{"expected the name of the page"}
+		}
+		pagePath, err := utils.NewPage(*runtime, args[0], *title, *draft, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Created %s\n", pagePath)
+		return nil
+	}
+}
+
+func setupCheck(flags *flag.FlagSet, runtime *utils.RuntimeConfig, stdout io.Writer) func(args []string) error {
+	buildFlags(flags, runtime)
+	return noArgs(func() error {
+		buildPath, err := os.MkdirTemp(utils.GetRepoRoot(), ".lk-check-")
+		if err != nil {
+			return fmt.Errorf("error making temporary build directory: %s", err)
+		}
+		defer os.RemoveAll(buildPath)
+		checkRuntime := *runtime
+		checkRuntime.BuildPath = buildPath
+		checkRuntime.CachePath = ""
+		if err := templating.TemplateSite(checkRuntime); err != nil {
+			return err
+		}
+
+		broken, err := links.Check(buildPath)
+		if err != nil {
+			return err
+		}
+		for _, b := range broken {
+			fmt.Fprintln(stdout, b)
+		}
+		if len(broken) > 0 {
+			return fmt.Errorf("found %d broken links", len(broken))
+		}
+		fmt.Fprintln(stdout, "No broken links found")
+		return nil
+	})
+}
+
+func setupClean(flags *flag.FlagSet, runtime *utils.RuntimeConfig, stdout io.Writer) func(args []string) error {
+	keepCache := flags.Bool("keep-cache", false, "Only remove the build directory")
+	return noArgs(func() error {
+		paths := []string{runtime.BuildPath}
+		if !*keepCache && runtime.CachePath != "" {
+			paths = append(paths, runtime.CachePath)
+		}
+		for _, path := range paths {
+			if err := utils.Clean(path); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "Removed %s\n", utils.MakePath(path))
+		}
+		return nil
+	})
+}
+
+func setupVersion(flags *flag.FlagSet, runtime *utils.RuntimeConfig, stdout io.Writer) func(args []string) error {
+	return noArgs(func() error {
+		fmt.Fprintf(stdout, "lk-site %s\n", getVersion())
+		return nil
+	})
+}
+
+func getVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	v := info.Main.Version
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision != "" {
+		if len(revision) > 12 {
+			revision = revision[:12]
+		}
+		v = fmt.Sprintf("%s (%s", v, revision)
+		if modified {
+			v += ", modified"
+		}
+		v += ")"
+	}
+	return v
+}
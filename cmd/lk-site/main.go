@@ -1,37 +1,160 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
-	"net/http"
+	"io"
 	"os"
+	"strings"
 
-	"github.com/krmckone/lk-site/internal/templating"
 	"github.com/krmckone/lk-site/internal/utils"
 )
 
+// Exit codes distinguish a command that failed, e.g. a broken build, from a
+// command that was called incorrectly
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// usageError is returned by a command that was given invalid arguments
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// command is a subcommand of lk-site. setup registers the command's flags and
+// returns the function that runs it with the remaining arguments
+type command struct {
+	name    string
+	aliases []string
+	args    string // Arguments shown in the usage line
+	short   string
+	long    string
+	setup   func(flags *flag.FlagSet, runtime *utils.RuntimeConfig, stdout io.Writer) func(args []string) error
+}
+
 func main() {
-	assetsPath := flag.String("assets-path", "assets", "Path to the assets directory")
-	configsPath := flag.String("configs-path", "configs", "Path to the configs directory")
-	buildPath := flag.String("build-path", "build", "Path to the build directory")
-	flag.Parse()
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs lk-site with args and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
 	runtime := utils.NewRuntimeConfig()
-	runtime.AssetsPath = *assetsPath
-	runtime.ConfigsPath = *configsPath
-	runtime.BuildPath = *buildPath
+	global := flag.NewFlagSet("lk-site", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	globalFlags(global, &runtime)
+	global.Usage = func() { usage(global.Output()) }
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	args = global.Args()
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	name, args := args[0], args[1:]
+	if name == "help" {
+		return help(args, stdout, stderr)
+	}
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(stderr, "lk-site: unknown command %q\n\n", name)
+		usage(stderr)
+		return exitUsage
+	}
 
-	if err := templating.TemplateSite(runtime); err != nil {
-		log.Fatalf("Error templating site: %s", err)
+	flags := newFlagSet(cmd, &runtime, stderr)
+	runCmd := cmd.setup(flags, &runtime, stdout)
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
 	}
+	if err := runCmd(flags.Args()); err != nil {
+		fmt.Fprintf(stderr, "lk-site %s: %s\n", cmd.name, err)
+		if errors.As(err, &usageError{}) {
+			flags.Usage()
+			return exitUsage
+		}
+		return exitError
+	}
+	return exitOK
+}
+
+// globalFlags registers the flags shared by every command. They're accepted
+// both before and after the command name
+func globalFlags(flags *flag.FlagSet, runtime *utils.RuntimeConfig) {
+	flags.StringVar(&runtime.AssetsPath, "assets-path", runtime.AssetsPath, "Path to the assets directory")
+	flags.StringVar(&runtime.ConfigsPath, "configs-path", runtime.ConfigsPath, "Path to the configs directory")
+	flags.StringVar(&runtime.BuildPath, "build-path", runtime.BuildPath, "Path to the build directory")
+	flags.StringVar(&runtime.CachePath, "cache-path", runtime.CachePath, "Path to the build cache directory, empty to turn off caching")
+}
 
-	args := os.Args[1:]
-	if len(args) > 0 && args[0] == "server" {
-		port := args[1]
-		serveDir := "./build"
-		log.Printf("Serving %s on HTTP port: %s\n", serveDir, port)
-		http.Handle("/", http.FileServer(http.Dir(serveDir)))
-		log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), nil))
+func newFlagSet(cmd command, runtime *utils.RuntimeConfig, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	globalFlags(flags, runtime)
+	flags.Usage = func() {
+		w := flags.Output()
+		fmt.Fprintf(w, "Usage: lk-site %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.long)
+		flags.PrintDefaults()
 	}
+	return flags
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd, true
+			}
+		}
+	}
+	return command{}, false
+}
 
+func usage(w io.Writer) {
+	fmt.Fprint(w, "Usage: lk-site [global flags] <command> [flags] [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprint(w, "\nGlobal flags:\n")
+	flags := flag.NewFlagSet("lk-site", flag.ContinueOnError)
+	flags.SetOutput(w)
+	runtime := utils.NewRuntimeConfig()
+	globalFlags(flags, &runtime)
+	flags.PrintDefaults()
+	fmt.Fprint(w, "\nRun 'lk-site help <command>' for more about a command.\n")
+}
+
+// help prints the usage of a command, or of lk-site when there's no command
+func help(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stdout)
+		return exitOK
+	}
+	cmd, ok := findCommand(args[0])
+	if !ok || len(args) > 1 {
+		fmt.Fprintf(stderr, "lk-site help: unknown command %q\n", strings.Join(args, " "))
+		return exitUsage
+	}
+	runtime := utils.NewRuntimeConfig()
+	flags := newFlagSet(cmd, &runtime, stdout)
+	cmd.setup(flags, &runtime, stdout)
+	flags.Usage()
+	return exitOK
 }
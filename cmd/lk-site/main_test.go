@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/krmckone/lk-site/internal/utils"
+)
+
+var testFlags = []string{
+	"--assets-path", "test/assets",
+	"--configs-path", "test/configs",
+	"--build-path", "test/build",
+	"--cache-path", "test/cache",
+}
+
+func cleanTestBuild(t *testing.T) {
+	t.Cleanup(func() {
+		for _, path := range []string{"test/build", "test/cache"} {
+			if err := utils.Clean(path); err != nil {
+				t.Errorf("Unexpected error from Clean: %s", err)
+			}
+		}
+	})
+}
+
+func TestRunExitCodes(t *testing.T) {
+	cleanTestBuild(t)
+	testCases := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"no command", []string{}, exitUsage},
+		{"unknown command", []string{"deploy"}, exitUsage},
+		{"unknown flag", []string{"build", "--not-a-flag"}, exitUsage},
+		{"unexpected argument", []string{"build", "extra"}, exitUsage},
+		{"help", []string{"help"}, exitOK},
+		{"help for a command", []string{"help", "serve"}, exitOK},
+		{"help for an unknown command", []string{"help", "deploy"}, exitUsage},
+		{"command help flag", []string{"build", "-h"}, exitOK},
+		{"version", []string{"version"}, exitOK},
+		{"build", append(append([]string{}, testFlags...), "build", "--force"), exitOK},
+		{"build with global flags after the command", append([]string{"build"}, testFlags...), exitOK},
+		{"build error", []string{"--assets-path", "test/missing", "build"}, exitError},
+		{"new without a name", []string{"new"}, exitUsage},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			if actual := run(testCase.args, stdout, stderr); actual != testCase.code {
+				t.Errorf("Expected: %d, actual: %d, stderr: %s", testCase.code, actual, stderr)
+			}
+		})
+	}
+}
+
+func TestRunClean(t *testing.T) {
+	cleanTestBuild(t)
+	if code := run(append(append([]string{}, testFlags...), "build"), &bytes.Buffer{}, &bytes.Buffer{}); code != exitOK {
+		t.Fatalf("Expected the build to succeed, actual exit code: %d", code)
+	}
+	stdout := &bytes.Buffer{}
+	if code := run(append(append([]string{}, testFlags...), "clean"), stdout, &bytes.Buffer{}); code != exitOK {
+		t.Fatalf("Expected clean to succeed, actual exit code: %d", code)
+	}
+	for _, path := range []string{"test/build", "test/cache"} {
+		if _, err := os.Stat(utils.MakePath(path)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed, actual: %v", path, err)
+		}
+	}
+	if !strings.Contains(stdout.String(), "Removed") {
+		t.Errorf("Expected clean to report what was removed, actual: %s", stdout)
+	}
+}
+
+func TestRunNew(t *testing.T) {
+	t.Cleanup(func() {
+		if err := utils.Clean("test/new_assets"); err != nil {
+			t.Errorf("Unexpected error from Clean: %s", err)
+		}
+	})
+	args := []string{"--assets-path", "test/new_assets", "new", "--title", "Hello", "posts/hello"}
+	stdout := &bytes.Buffer{}
+	if code := run(args, stdout, &bytes.Buffer{}); code != exitOK {
+		t.Fatalf("Expected new to succeed, actual exit code: %d", code)
+	}
+	b, err := os.ReadFile(utils.MakePath("test/new_assets/pages/posts/hello.md"))
+	if err != nil {
+		t.Fatalf("Unexpected error reading new page: %s", err)
+	}
+	if !strings.Contains(string(b), `title: "Hello"`) {
+		t.Errorf("Expected the page to have the title from the flag, actual: %s", string(b))
+	}
+	if code := run(args, &bytes.Buffer{}, &bytes.Buffer{}); code != exitError {
+		t.Errorf("Expected an error creating an existing page, actual exit code: %d", code)
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run(append(append([]string{}, testFlags...), "check"), stdout, stderr)
+	if code != exitOK {
+		t.Errorf("Expected check to pass, actual exit code: %d, stdout: %s, stderr: %s", code, stdout, stderr)
+	}
+	if _, err := os.Stat(utils.MakePath("test/build")); !os.IsNotExist(err) {
+		t.Errorf("Expected check to leave the build directory alone, actual: %v", err)
+	}
+}
@@ -8,10 +8,17 @@ require (
 	gopkg.in/yaml.v2 v2.4.0
 )
 
-require golang.org/x/text v0.21.0
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/alecthomas/chroma/v2 v2.14.0
+	github.com/gofrs/flock v0.12.1
+	github.com/yuin/goldmark-highlighting/v2 v2.0.0-20230729083705-37449abec8cc
+	golang.org/x/image v0.18.0
+	golang.org/x/text v0.21.0
+)
 
 require (
-	github.com/gofrs/flock v0.12.1 // indirect
+	github.com/dlclark/regexp2 v1.11.0 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	golang.org/x/sys v0.22.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	manifestFile = "manifest.json"
+	contentDir   = "content"
+)
+
+// manifest is the record of the previous build kept in the cache directory
+type manifest struct {
+	BuildPath string            `json:"buildPath"`
+	Generator string            `json:"generator"`
+	Outputs   map[string]string `json:"outputs"` // Output path relative to the build directory to input key
+}
+
+// Cache remembers the key of the inputs each build output was written from so
+// that outputs with unchanged inputs can be skipped by the next build. A nil
+// *Cache is valid and behaves as an always empty cache, which is how caching is
+// turned off
+type Cache struct {
+	dir      string
+	previous manifest
+	current  manifest
+	mu       sync.Mutex // Guards current, since pages are built concurrently
+}
+
+// Open loads the cache for buildPath from dir. The previous build is ignored when
+// force is set, when it was written to a different build directory, or when it
+// was written by a different generator, since any of these can change the output
+// without the inputs changing. An empty dir turns caching off and returns nil
+func Open(dir, buildPath, generator string, force bool) (*Cache, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	c := &Cache{
+		dir:      dir,
+		previous: manifest{Outputs: map[string]string{}},
+		current:  manifest{BuildPath: buildPath, Generator: generator, Outputs: map[string]string{}},
+	}
+	if force {
+		return c, nil
+	}
+	b, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading build cache: %s", err)
+	}
+	previous := manifest{}
+	if err := json.Unmarshal(b, &previous); err != nil {
+		// A corrupt manifest only costs a full rebuild
+		return c, nil
+	}
+	if previous.BuildPath == buildPath && previous.Generator == generator && previous.Outputs != nil {
+		c.previous = previous
+	}
+	return c, nil
+}
+
+// Clean reports whether the build has to start from an empty build directory
+// because there is no previous build to reuse outputs from
+func (c *Cache) Clean() bool {
+	return c == nil || len(c.previous.Outputs) == 0
+}
+
+// Fresh reports whether output was written by the previous build from inputs
+// with the same key and is still in the build directory. Fresh outputs are
+// carried over to the current build
+func (c *Cache) Fresh(output, key string) bool {
+	if c == nil {
+		return false
+	}
+	if previous, ok := c.previous.Outputs[output]; !ok || previous != key {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(c.current.BuildPath, output)); err != nil {
+		return false
+	}
+	c.Put(output, key)
+	return true
+}
+
+// Put records that output was written by the current build from inputs with key
+func (c *Cache) Put(output, key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.current.Outputs[output] = key
+}
+
+// ReadContent returns content stored for key by a previous build
+func (c *Cache) ReadContent(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	b, err := os.ReadFile(filepath.Join(c.dir, contentDir, key))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// WriteContent stores content for key, for intermediate results that are needed
+// even when the output they were part of is skipped
+func (c *Cache) WriteContent(key string, b []byte) error {
+	if c == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(c.dir, contentDir), 0755); err != nil {
+		return fmt.Errorf("error writing build cache: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(c.dir, contentDir, key), b, 0644); err != nil {
+		return fmt.Errorf("error writing build cache: %s", err)
+	}
+	return nil
+}
+
+// RemoveStale deletes the outputs of the previous build that the current build
+// did not produce, along with any directories left empty by doing so
+func (c *Cache) RemoveStale() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for output := range c.previous.Outputs {
+		if _, ok := c.current.Outputs[output]; ok {
+			continue
+		}
+		path := filepath.Join(c.current.BuildPath, output)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing stale output %s: %s", path, err)
+		}
+		for dir := filepath.Dir(path); strings.HasPrefix(dir, c.current.BuildPath+string(os.PathSeparator)); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break // Not empty
+			}
+		}
+	}
+	return nil
+}
+
+// Save writes the current build's manifest and drops stored content that it
+// no longer refers to
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("error writing build cache: %s", err)
+	}
+	b, err := json.MarshalIndent(c.current, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(c.dir, manifestFile), b, 0644); err != nil {
+		return fmt.Errorf("error writing build cache: %s", err)
+	}
+
+	keys := map[string]bool{}
+	for _, key := range c.current.Outputs {
+		keys[key] = true
+	}
+	entries, err := os.ReadDir(filepath.Join(c.dir, contentDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading build cache: %s", err)
+	}
+	for _, entry := range entries {
+		if !keys[entry.Name()] {
+			if err := os.Remove(filepath.Join(c.dir, contentDir, entry.Name())); err != nil {
+				return fmt.Errorf("error pruning build cache: %s", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Hash returns a key for the given inputs. Each part is length prefixed so that
+// moving bytes from one part to the next changes the key
+func Hash(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		binary.Write(h, binary.LittleEndian, uint64(len(part)))
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HashFiles returns a key for the contents of the files at paths
+func HashFiles(paths ...string) (string, error) {
+	h := sha256.New()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		// Separate files so that moving bytes between them changes the key
+		h.Write([]byte{0})
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// GeneratorKey identifies the running lk-site binary, so that a cache written by
+// an older build of the generator is not reused after its code changes
+func GeneratorKey() string {
+	executable, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	key, err := HashFiles(executable)
+	if err != nil {
+		return ""
+	}
+	return key
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newTestCache(t *testing.T, dir, buildPath, generator string, force bool) *Cache {
+	c, err := Open(dir, buildPath, generator, force)
+	if err != nil {
+		t.Fatalf("Unexpected error from Open: %s", err)
+	}
+	return c
+}
+
+func writeOutput(t *testing.T, buildPath, output string) {
+	path := filepath.Join(buildPath, output)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Unexpected error from MkdirAll: %s", err)
+	}
+	if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+		t.Fatalf("Unexpected error from WriteFile: %s", err)
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	c := newTestCache(t, "", "build", "generator", false)
+	if c != nil {
+		t.Fatalf("Expected a nil cache for an empty directory")
+	}
+	if !c.Clean() {
+		t.Errorf("Expected a nil cache to be clean")
+	}
+	c.Put("index.html", "key")
+	if c.Fresh("index.html", "key") {
+		t.Errorf("Expected nothing to be fresh in a nil cache")
+	}
+	if err := c.Save(); err != nil {
+		t.Errorf("Unexpected error from Save: %s", err)
+	}
+}
+
+func TestFresh(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	buildPath := t.TempDir()
+
+	first := newTestCache(t, dir, buildPath, "generator", false)
+	if !first.Clean() {
+		t.Errorf("Expected the first build to be clean")
+	}
+	writeOutput(t, buildPath, "index.html")
+	first.Put("index.html", "key")
+	if err := first.Save(); err != nil {
+		t.Fatalf("Unexpected error from Save: %s", err)
+	}
+
+	cases := []struct {
+		name      string
+		buildPath string
+		generator string
+		force     bool
+		key       string
+		expect    bool
+	}{
+		{"same inputs", buildPath, "generator", false, "key", true},
+		{"changed inputs", buildPath, "generator", false, "other", false},
+		{"forced", buildPath, "generator", true, "key", false},
+		{"new generator", buildPath, "other", false, "key", false},
+		{"other build directory", t.TempDir(), "generator", false, "key", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			next := newTestCache(t, dir, c.buildPath, c.generator, c.force)
+			if actual := next.Fresh("index.html", c.key); actual != c.expect {
+				t.Errorf("Expected Fresh to be %t, actual: %t", c.expect, actual)
+			}
+		})
+	}
+
+	if err := os.Remove(filepath.Join(buildPath, "index.html")); err != nil {
+		t.Fatalf("Unexpected error from Remove: %s", err)
+	}
+	next := newTestCache(t, dir, buildPath, "generator", false)
+	if next.Fresh("index.html", "key") {
+		t.Errorf("Expected a deleted output not to be fresh")
+	}
+}
+
+func TestRemoveStale(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	buildPath := t.TempDir()
+
+	first := newTestCache(t, dir, buildPath, "generator", false)
+	for _, output := range []string{"index.html", filepath.Join("posts", "old.html"), filepath.Join("posts", "new.html"), filepath.Join("images", "old", "a.jpg")} {
+		writeOutput(t, buildPath, output)
+		first.Put(output, "key")
+	}
+	if err := first.Save(); err != nil {
+		t.Fatalf("Unexpected error from Save: %s", err)
+	}
+
+	next := newTestCache(t, dir, buildPath, "generator", false)
+	next.Fresh("index.html", "key")
+	next.Put(filepath.Join("posts", "new.html"), "key")
+	if err := next.RemoveStale(); err != nil {
+		t.Fatalf("Unexpected error from RemoveStale: %s", err)
+	}
+
+	actual := []string{}
+	filepath.WalkDir(buildPath, func(path string, d os.DirEntry, err error) error {
+		rel, _ := filepath.Rel(buildPath, path)
+		actual = append(actual, rel)
+		return nil
+	})
+	expect := []string{".", "index.html", "posts", filepath.Join("posts", "new.html")}
+	slices.Sort(actual)
+	slices.Sort(expect)
+	if !slices.Equal(actual, expect) {
+		t.Errorf("Expected: %s, actual: %s", expect, actual)
+	}
+}
+
+func TestContent(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	buildPath := t.TempDir()
+
+	first := newTestCache(t, dir, buildPath, "generator", false)
+	for _, key := range []string{"kept", "dropped"} {
+		if err := first.WriteContent(key, []byte(key)); err != nil {
+			t.Fatalf("Unexpected error from WriteContent: %s", err)
+		}
+	}
+	first.Put("index.html", "kept")
+	if err := first.Save(); err != nil {
+		t.Fatalf("Unexpected error from Save: %s", err)
+	}
+
+	next := newTestCache(t, dir, buildPath, "generator", false)
+	if b, ok := next.ReadContent("kept"); !ok || string(b) != "kept" {
+		t.Errorf("Expected content for a key in use, actual: %q, %t", b, ok)
+	}
+	if _, ok := next.ReadContent("dropped"); ok {
+		t.Errorf("Expected content for an unused key to be pruned")
+	}
+}
+
+func TestHash(t *testing.T) {
+	if Hash([]byte("ab"), []byte("c")) == Hash([]byte("a"), []byte("bc")) {
+		t.Errorf("Expected moving bytes between parts to change the hash")
+	}
+	if Hash([]byte("abc")) != Hash([]byte("abc")) {
+		t.Errorf("Expected equal inputs to hash equally")
+	}
+}
@@ -3,22 +3,72 @@ package config
 import (
 	"fmt"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/krmckone/lk-site/internal/utils"
 	"gopkg.in/yaml.v2"
 )
 
+// BuildTimeParam is the template param with the time of the build, which the
+// footer shows
+const BuildTimeParam = "currentEasternTime"
+
 // Config top level project config settings
 type Config struct {
 	Env      EnvConfig      `yaml:"environment"`
 	Template TemplateConfig `yaml:"template"`
+	Site     SiteConfig     `yaml:"site"`
+	Remote   RemoteConfig   `yaml:"remote"`
+	Images   ImagesConfig   `yaml:"images"`
+	Assets   AssetsConfig   `yaml:"assets"`
+}
+
+// AssetsConfig settings for the fingerprinted copies of the stylesheets,
+// scripts and shaders
+type AssetsConfig struct {
+	Integrity bool `yaml:"integrity"` // Whether the integrity template function gives Subresource Integrity attributes
+}
+
+// ImagesConfig settings for the resized variants of the images under assets/images
+type ImagesConfig struct {
+	Widths   []int               `yaml:"widths"`   // Widths of the variants of each image in pixels, e.g. [480, 960]
+	Quality  int                 `yaml:"quality"`  // JPEG and WebP quality of the variants, from 1 to 100
+	Sizes    string              `yaml:"sizes"`    // How wide an image is shown, e.g. (max-width: 960px) 100vw, 960px
+	Metadata map[string][]string `yaml:"metadata"` // EXIF fields kept by images matching each pattern, e.g. steam_deck/*: [dateTaken, camera]
+	Cwebp    string              `yaml:"cwebp"`    // libwebp's WebP encoder, cwebp on the PATH by default
+}
+
+// RemoteConfig settings for data fetched from other sites while building
+type RemoteConfig struct {
+	Allow []string      `yaml:"allow"` // URLs templates may fetch, or URL prefixes ending with *
+	TTL   time.Duration `yaml:"ttl"`   // How long a fetched response is reused, e.g. 12h
+}
+
+// SiteConfig settings for outputs that describe the site as a whole, like feeds
+type SiteConfig struct {
+	BaseURL string       `yaml:"baseURL"` // Absolute URL the site is served from, e.g. https://krmckone.com
+	Author  string       `yaml:"author"`
+	Robots  RobotsConfig `yaml:"robots"`
+}
+
+// RobotsConfig settings for the generated robots.txt
+type RobotsConfig struct {
+	Disallow []string `yaml:"disallow"` // Paths crawlers should not visit
 }
 
 // TemplateConfig config for the html templating
 type TemplateConfig struct {
-	Params Params       `yaml:"params"`
-	Icons  Params       `yaml:"icons"`
-	Styles StylesParams `yaml:"styles"`
+	Params          Params                `yaml:"params"`
+	Icons           Params                `yaml:"icons"`
+	Styles          StylesParams          `yaml:"styles"`
+	TableOfContents TableOfContentsConfig `yaml:"tableOfContents"`
+}
+
+// TableOfContentsConfig settings for the table of contents of each page
+type TableOfContentsConfig struct {
+	MinLevel int `yaml:"minLevel"` // Level of the top headings listed, e.g. 2 for ##
+	MaxLevel int `yaml:"maxLevel"` // Level of the deepest headings listed
 }
 
 type EnvConfig struct {
@@ -30,7 +80,14 @@ type Params map[string]interface{}
 
 // StylesParams parameters for stylesheets
 type StylesParams struct {
-	SheetURL string `yaml:"sheetURL"`
+	SheetURL  string          `yaml:"sheetURL"`
+	Highlight HighlightStyles `yaml:"highlight"`
+}
+
+// HighlightStyles names the chroma styles for highlighted code, e.g. github
+type HighlightStyles struct {
+	Light string `yaml:"light"`
+	Dark  string `yaml:"dark"` // Used when the reader prefers a dark theme
 }
 
 // ReadConfig reads in the project config yaml located at path
@@ -50,8 +107,9 @@ func ReadConfig(runtime utils.RuntimeConfig) (Config, error) {
 		return config, err
 	}
 	config.Template.Params["sheetsURL"] = config.Template.Styles.SheetURL
-	config.Template.Params["currentYear"] = utils.GetCurrentYear()
-	config.Template.Params["currentEasternTime"] = utils.GetCurrentEasternTime()
+	now := runtime.Now()
+	config.Template.Params["currentYear"] = strconv.Itoa(now.Year())
+	config.Template.Params[BuildTimeParam] = utils.GetEasternTime(now)
 	return config, nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/krmckone/lk-site/internal/utils"
 )
@@ -43,9 +44,27 @@ template:
     myName: "Tester 0"
   styles:
     sheetURL: "styles.url"
+  tableOfContents:
+    minLevel: 2
+    maxLevel: 4
   icons:
     github: github.svg
-    linkedin: linkedin.svg`,
+    linkedin: linkedin.svg
+site:
+  baseURL: "https://example.com"
+  author: "Tester 0"
+remote:
+  allow:
+    - https://example.com/data.json
+  ttl: 12h
+images:
+  widths: [320, 640]
+  quality: 70
+  sizes: 100vw
+  metadata:
+    "steam_deck/*.jpg": [dateTaken, camera]
+assets:
+  integrity: true`,
 			Config{
 				EnvConfig{Params: Params{
 					"steamId": "invalid_steam_id",
@@ -65,7 +84,17 @@ template:
 						"linkedin": "linkedin.svg",
 					},
 					StylesParams{SheetURL: "styles.url"},
+					TableOfContentsConfig{MinLevel: 2, MaxLevel: 4},
 				},
+				SiteConfig{BaseURL: "https://example.com", Author: "Tester 0"},
+				RemoteConfig{Allow: []string{"https://example.com/data.json"}, TTL: 12 * time.Hour},
+				ImagesConfig{
+					Widths:   []int{320, 640},
+					Quality:  70,
+					Sizes:    "100vw",
+					Metadata: map[string][]string{"steam_deck/*.jpg": {"dateTaken", "camera"}},
+				},
+				AssetsConfig{Integrity: true},
 			},
 		},
 		{
@@ -86,7 +115,12 @@ template:
 					},
 					nil,
 					StylesParams{},
+					TableOfContentsConfig{},
 				},
+				SiteConfig{},
+				RemoteConfig{},
+				ImagesConfig{},
+				AssetsConfig{},
 			},
 		},
 	}
@@ -109,6 +143,21 @@ template:
 	}
 }
 
+func TestReadConfigBuildTime(t *testing.T) {
+	runtime := NewTestRuntime()
+	runtime.BuildTime = time.Date(2024, 6, 5, 16, 30, 0, 0, time.UTC)
+	c, err := ReadConfig(runtime)
+	if err != nil {
+		t.Fatalf("Unexpected error from ReadConfig: %s", err)
+	}
+	if expected, actual := "05 Jun 24 12:30 EDT", c.Template.Params[BuildTimeParam]; actual != expected {
+		t.Errorf("Expected: %s, actual: %s", expected, actual)
+	}
+	if expected, actual := "2024", c.Template.Params["currentYear"]; actual != expected {
+		t.Errorf("Expected: %s, actual: %s", expected, actual)
+	}
+}
+
 func TestReadIcons(t *testing.T) {
 	githubIcon, err := readIcon("github.svg")
 	if err != nil {
@@ -132,7 +181,12 @@ func TestReadIcons(t *testing.T) {
 						"linkedin": "linkedin.svg",
 					},
 					StylesParams{},
+					TableOfContentsConfig{},
 				},
+				SiteConfig{},
+				RemoteConfig{},
+				ImagesConfig{},
+				AssetsConfig{},
 			},
 			Config{
 				EnvConfig{Params{}},
@@ -146,7 +200,12 @@ func TestReadIcons(t *testing.T) {
 						"linkedin": "linkedin.svg",
 					},
 					StylesParams{},
+					TableOfContentsConfig{},
 				},
+				SiteConfig{},
+				RemoteConfig{},
+				ImagesConfig{},
+				AssetsConfig{},
 			},
 		},
 	}
@@ -0,0 +1,243 @@
+package data
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// parsers read a data file by its extension
+var parsers = map[string]func(b []byte) (interface{}, error){
+	".json": parseJSON,
+	".yaml": parseYAML,
+	".yml":  parseYAML,
+	".toml": parseTOML,
+	".csv":  parseCSV,
+}
+
+// yamlLine finds the line in a YAML error, e.g. "yaml: line 3: did not find expected key"
+var yamlLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// Error is an error in a data file, at Line when it's known
+type Error struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("error reading data %s:%d: %s", e.Path, e.Line, e.Err)
+	}
+	return fmt.Sprintf("error reading data %s: %s", e.Path, e.Err)
+}
+
+// Load reads every data file under dir into a tree for templates. Each file is
+// keyed by its name without the extension and each subdirectory by its name,
+// so assets/data/projects/graphics.yaml is at .Data.projects.graphics. JSON,
+// YAML and TOML files hold whatever they define, and a CSV file is a list of
+// its rows keyed by the header row. Other files are ignored. The tree is empty
+// when dir doesn't exist
+func Load(dir string) (map[string]interface{}, error) {
+	tree := map[string]interface{}{}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return tree, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading data directory: %s", err)
+	}
+	sources := map[string]string{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		key := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		var value interface{}
+		if entry.IsDir() {
+			key = entry.Name()
+			value, err = Load(path)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if _, ok := parsers[ext]; !ok {
+				log.Printf("Ignoring data file %s with an unknown format", path)
+				continue
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("error reading data file: %s", err)
+			}
+			value, err = Parse(path, ext, b)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if other, ok := sources[key]; ok {
+			return nil, fmt.Errorf("data %q is defined by both %s and %s", key, other, path)
+		}
+		sources[key] = path
+		tree[key] = value
+	}
+	return tree, nil
+}
+
+// Parse reads b in the format of the extension ext, e.g. ".csv", the same way
+// as a data file. Errors are reported at path
+func Parse(path, ext string, b []byte) (interface{}, error) {
+	parse, ok := parsers[ext]
+	if !ok {
+		return nil, Error{Path: path, Err: fmt.Errorf("unknown format %q", ext)}
+	}
+	value, err := parse(b)
+	if err != nil {
+		dataErr := Error{}
+		if errors.As(err, &dataErr) {
+			dataErr.Path = path
+			return nil, dataErr
+		}
+		return nil, Error{Path: path, Err: err}
+	}
+	return value, nil
+}
+
+func parseJSON(b []byte) (interface{}, error) {
+	var value interface{}
+	err := json.Unmarshal(b, &value)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return nil, Error{Line: lineAt(b, syntaxErr.Offset), Err: err}
+	case errors.As(err, &typeErr):
+		return nil, Error{Line: lineAt(b, typeErr.Offset), Err: err}
+	case err != nil:
+		return nil, err
+	}
+	return value, nil
+}
+
+func parseYAML(b []byte) (interface{}, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(b, &value); err != nil {
+		match := yamlLine.FindStringSubmatch(err.Error())
+		if match == nil {
+			return nil, err
+		}
+		line, _ := strconv.Atoi(match[1])
+		return nil, Error{Line: line, Err: errors.New(strings.Replace(err.Error(), match[0], "yaml: ", 1))}
+	}
+	return normalize(value), nil
+}
+
+func parseTOML(b []byte) (interface{}, error) {
+	value := map[string]interface{}{}
+	if err := toml.Unmarshal(b, &value); err != nil {
+		parseErr := toml.ParseError{}
+		if errors.As(err, &parseErr) {
+			// The message repeats the line, e.g. toml: line 2 (last key "b"): ...
+			message := strings.SplitN(parseErr.Error(), ": ", 3)
+			return nil, Error{Line: parseErr.Position.Line, Err: fmt.Errorf("toml: %s", message[len(message)-1])}
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+func parseCSV(b []byte) (interface{}, error) {
+	r := csv.NewReader(bytes.NewReader(b))
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return []map[string]string{}, nil
+	} else if err != nil {
+		return nil, csvError(err)
+	}
+	names := map[string]bool{}
+	for i, name := range header {
+		if name == "" {
+			return nil, Error{Line: 1, Err: fmt.Errorf("column %d has no name", i+1)}
+		}
+		if names[name] {
+			return nil, Error{Line: 1, Err: fmt.Errorf("column %q is named more than once", name)}
+		}
+		names[name] = true
+	}
+	rows := []map[string]string{}
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		} else if err != nil {
+			return nil, csvError(err)
+		}
+		row := map[string]string{}
+		for i, field := range record {
+			row[header[i]] = field
+		}
+		rows = append(rows, row)
+	}
+}
+
+func csvError(err error) error {
+	parseErr := &csv.ParseError{}
+	if errors.As(err, &parseErr) {
+		return Error{Line: parseErr.Line, Err: parseErr.Err}
+	}
+	return err
+}
+
+// lineAt returns the line of the byte at offset in b
+func lineAt(b []byte, offset int64) int {
+	offset = min(max(offset, 0), int64(len(b)))
+	return bytes.Count(b[:offset], []byte("\n")) + 1
+}
+
+// Lookup returns the data under a dotted path of keys, e.g. "reading.graphics"
+// for the file assets/data/reading/graphics.yaml. It's meant for shortcodes,
+// whose arguments are strings, e.g. {{ template "linkList" lookup .Data .Params.data }}
+func Lookup(data map[string]interface{}, path string) (interface{}, error) {
+	var value interface{} = data
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("no data at %s", path)
+		}
+		if value, ok = m[key]; !ok {
+			return nil, fmt.Errorf("no data at %s", path)
+		}
+	}
+	return value, nil
+}
+
+// normalize turns the maps decoded from YAML, which can have keys of any type,
+// into maps with string keys like the other formats
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalize(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+		return v
+	}
+	return value
+}
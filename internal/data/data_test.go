@@ -0,0 +1,126 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/krmckone/lk-site/internal/utils"
+)
+
+func TestLoad(t *testing.T) {
+	actual, err := Load(utils.MakePath("test/assets/data"))
+	if err != nil {
+		t.Fatalf("Unexpected error from Load: %s", err)
+	}
+	expected := map[string]interface{}{
+		"books": []interface{}{
+			map[string]interface{}{
+				"title": "3D Math Primer for Graphics and Game Development",
+				"url":   "https://gamemath.com/book/",
+				"free":  true,
+			},
+		},
+		"projects": map[string]interface{}{
+			"graphics": []interface{}{
+				map[string]interface{}{"name": "rayTracingOneWeekend", "language": "C++"},
+				map[string]interface{}{"name": "rayTracingOneWeekendRust", "language": "Rust"},
+			},
+			"tools": map[string]interface{}{
+				"site": map[string]interface{}{"name": "lk-site", "stars": int64(3)},
+			},
+		},
+		"reading": []map[string]string{
+			{"title": "The Book of Shaders", "url": "https://thebookofshaders.com/"},
+			{"title": "Learn OpenGL, extensively", "url": "https://learnopengl.com/"},
+		},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestLoadMissingDir(t *testing.T) {
+	actual, err := Load(utils.MakePath("test/assets/no_data"))
+	if err != nil || len(actual) != 0 {
+		t.Errorf("Expected no data without a data directory, actual: %v, %v", actual, err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"broken.json", "{\n  \"a\": 1,\n  \"b\": }\n", "broken.json:3: "},
+		{"wrong.json", "{\n  \"a\": [1,\n}", "wrong.json:3: "},
+		{"broken.yaml", "a: 1\nb: [1, 2\nc: 3\n", "broken.yaml:2: yaml: did not find expected ',' or ']'"},
+		{"broken.toml", "a = 1\nb = \"unterminated\nc = 2\n", "broken.toml:2: toml: "},
+		{"broken.csv", "a,b\n1,2\n3\n", "broken.csv:3: wrong number of fields"},
+		{"quotes.csv", "a,b\n1,\"2\n", "quotes.csv:2: "},
+		{"header.csv", "a,a\n1,2\n", "header.csv:1: column \"a\" is named more than once"},
+	}
+	dir := utils.MakePath("test/data_errors")
+	defer utils.Clean("test/data_errors")
+	for _, c := range cases {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, c.name), []byte(c.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(dir)
+		if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, c.expected)) {
+			t.Errorf("Expected: %s, actual: %v", c.expected, err)
+		}
+		if err := utils.Clean("test/data_errors"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadConflict(t *testing.T) {
+	dir := utils.MakePath("test/data_conflict")
+	defer utils.Clean("test/data_conflict")
+	if err := os.MkdirAll(filepath.Join(dir, "books"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "books.json"), []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), `data "books" is defined by both`) {
+		t.Errorf("Expected an error for data defined twice, actual: %v", err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	data := map[string]interface{}{
+		"books":   []interface{}{"linear algebra"},
+		"reading": map[string]interface{}{"graphics": []interface{}{"shaders"}},
+	}
+	cases := []struct {
+		path   string
+		expect interface{}
+	}{
+		{"books", []interface{}{"linear algebra"}},
+		{"reading.graphics", []interface{}{"shaders"}},
+		{"reading", map[string]interface{}{"graphics": []interface{}{"shaders"}}},
+	}
+	for _, c := range cases {
+		actual, err := Lookup(data, c.path)
+		if err != nil {
+			t.Errorf("Unexpected error from Lookup: %s", err)
+		}
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("Expected: %v, actual: %v", c.expect, actual)
+		}
+	}
+	for _, path := range []string{"missing", "books.first", "reading.graphics.shaders"} {
+		if _, err := Lookup(data, path); err == nil || err.Error() != "no data at "+path {
+			t.Errorf("Expected an error for %s, actual: %v", path, err)
+		}
+	}
+}
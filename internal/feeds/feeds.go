@@ -0,0 +1,308 @@
+package feeds
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/krmckone/lk-site/internal/page"
+)
+
+const (
+	RSSFile  = "feed.xml"
+	AtomFile = "atom.xml"
+	JSONFile = "feed.json"
+)
+
+// Feed holds the site metadata and items shared by every feed format. Nothing in
+// a feed depends on the time it was generated, so rebuilding unchanged content
+// produces byte-identical feeds
+type Feed struct {
+	Title       string
+	Description string
+	Author      string
+	BaseURL     string
+	Items       []Item
+}
+
+// Item is a single entry in a feed
+type Item struct {
+	Title   string
+	URL     string
+	Date    time.Time
+	Summary string
+	Content string
+	Tags    []string
+}
+
+// NewFeed makes a feed from pages, newest first. Pages need a date to be placed
+// in a feed, so pages without one are left out. Links and images in the content
+// are made absolute, since feed readers show it away from the site
+func NewFeed(title, description, author, baseURL string, pages []page.Page) (Feed, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	feed := Feed{
+		Title:       title,
+		Description: description,
+		Author:      author,
+		BaseURL:     baseURL,
+		Items:       []Item{},
+	}
+	sorted, err := page.SortBy(pages, "Date", "desc")
+	if err != nil {
+		return feed, err
+	}
+	for _, p := range sorted {
+		if p.Date.IsZero() {
+			continue
+		}
+		title := p.Title
+		if title == "" {
+			title = p.Name
+		}
+		feed.Items = append(feed.Items, Item{
+			Title:   title,
+			URL:     baseURL + p.URL,
+			Date:    p.Date,
+			Summary: p.Summary,
+			Content: absoluteLinks(p.HTML, baseURL+p.URL),
+			Tags:    p.Tags,
+		})
+	}
+	return feed, nil
+}
+
+// linkPattern matches the attributes of HTML elements that hold URLs
+var linkPattern = regexp.MustCompile(`(?i)(\s(?:href|src|srcset)\s*=\s*)"([^"]*)"`)
+
+// absoluteLinks resolves the links in content against pageURL, the absolute
+// URL of the page it's from. Both relative links like ../images/a.png and ones
+// from the root of the site like /images/a.png are resolved
+func absoluteLinks(content, pageURL string) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return content
+	}
+	resolve := func(link string) string {
+		ref, err := url.Parse(link)
+		if err != nil {
+			return link
+		}
+		return base.ResolveReference(ref).String()
+	}
+	return linkPattern.ReplaceAllStringFunc(content, func(attr string) string {
+		match := linkPattern.FindStringSubmatch(attr)
+		value := match[2]
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(match[1])), "srcset") {
+			// A srcset is a list of URLs, each followed by its width or density
+			candidates := strings.Split(value, ",")
+			for i, candidate := range candidates {
+				fields := strings.Fields(candidate)
+				if len(fields) > 0 {
+					fields[0] = resolve(fields[0])
+				}
+				candidates[i] = strings.Join(fields, " ")
+			}
+			value = strings.Join(candidates, ", ")
+		} else {
+			value = resolve(value)
+		}
+		return match[1] + `"` + value + `"`
+	})
+}
+
+// Updated is the date of the newest item
+func (f Feed) Updated() time.Time {
+	if len(f.Items) == 0 {
+		return time.Time{}
+	}
+	return f.Items[0].Date
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+}
+
+// RSS renders the feed as RSS 2.0
+func (f Feed) RSS() ([]byte, error) {
+	channel := rssChannel{
+		Title:       f.Title,
+		Link:        f.BaseURL + "/",
+		Description: f.Description,
+		AtomLink:    atomLink{Href: f.BaseURL + "/" + RSSFile, Rel: "self", Type: "application/rss+xml"},
+		Items:       []rssItem{},
+	}
+	if !f.Updated().IsZero() {
+		channel.LastBuildDate = f.Updated().Format(time.RFC1123Z)
+	}
+	for _, item := range f.Items {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.URL,
+			GUID:        item.URL,
+			PubDate:     item.Date.Format(time.RFC1123Z),
+			Description: item.Content,
+			Categories:  item.Tags,
+		})
+	}
+	return marshalXML(rss{Version: "2.0", AtomNS: "http://www.w3.org/2005/Atom", Channel: channel})
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	NS      string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Updated    string         `xml:"updated"`
+	Summary    string         `xml:"summary,omitempty"`
+	Content    atomContent    `xml:"content"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Base string `xml:"xml:base,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// Atom renders the feed as Atom 1.0
+func (f Feed) Atom() ([]byte, error) {
+	feed := atomFeed{
+		NS:      "http://www.w3.org/2005/Atom",
+		Title:   f.Title,
+		ID:      f.BaseURL + "/",
+		Updated: f.Updated().Format(time.RFC3339),
+		Author:  atomAuthor{Name: f.Author},
+		Links: []atomLink{
+			{Href: f.BaseURL + "/"},
+			{Href: f.BaseURL + "/" + AtomFile, Rel: "self", Type: "application/atom+xml"},
+		},
+		Entries: []atomEntry{},
+	}
+	for _, item := range f.Items {
+		entry := atomEntry{
+			Title:   item.Title,
+			ID:      item.URL,
+			Link:    atomLink{Href: item.URL},
+			Updated: item.Date.Format(time.RFC3339),
+			Summary: item.Summary,
+			// Relative links in the content resolve against the page itself
+			Content: atomContent{Type: "html", Base: item.URL, Body: item.Content},
+		}
+		for _, tag := range item.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return marshalXML(feed)
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Authors     []jsonAuthor   `json:"authors,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	ContentHTML   string   `json:"content_html"`
+	Summary       string   `json:"summary,omitempty"`
+	DatePublished string   `json:"date_published"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// JSON renders the feed as JSON Feed 1.1
+func (f Feed) JSON() ([]byte, error) {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.BaseURL + "/",
+		FeedURL:     f.BaseURL + "/" + JSONFile,
+		Description: f.Description,
+		Items:       []jsonFeedItem{},
+	}
+	if f.Author != "" {
+		feed.Authors = []jsonAuthor{{Name: f.Author}}
+	}
+	for _, item := range f.Items {
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:            item.URL,
+			URL:           item.URL,
+			Title:         item.Title,
+			ContentHTML:   item.Content,
+			Summary:       item.Summary,
+			DatePublished: item.Date.Format(time.RFC3339),
+			Tags:          item.Tags,
+		})
+	}
+	b, err := json.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
@@ -0,0 +1,152 @@
+package feeds
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krmckone/lk-site/internal/page"
+)
+
+func newTestFeed(t *testing.T) Feed {
+	pages := []page.Page{
+		{Name: "older", URL: "/posts/older.html", Title: "Older", Date: time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC), HTML: "<p>Older</p>"},
+		{Name: "undated", URL: "/posts/undated.html", Title: "Undated", HTML: "<p>Undated</p>"},
+		{Name: "newer", URL: "/posts/newer.html", Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Summary: "Newer summary", HTML: "<p>Newer</p>", Tags: []string{"go"}},
+	}
+	feed, err := NewFeed("Test Site", "Always Testing", "Tester", "https://example.com/", pages)
+	if err != nil {
+		t.Fatalf("Unexpected error from NewFeed: %s", err)
+	}
+	return feed
+}
+
+func TestNewFeed(t *testing.T) {
+	feed := newTestFeed(t)
+	expect := []Item{
+		{Title: "newer", URL: "https://example.com/posts/newer.html", Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Summary: "Newer summary", Content: "<p>Newer</p>", Tags: []string{"go"}},
+		{Title: "Older", URL: "https://example.com/posts/older.html", Date: time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC), Content: "<p>Older</p>"},
+	}
+	if !reflect.DeepEqual(feed.Items, expect) {
+		t.Errorf("Expected: %v, actual: %v", expect, feed.Items)
+	}
+	if !feed.Updated().Equal(expect[0].Date) {
+		t.Errorf("Expected updated to be %s, actual: %s", expect[0].Date, feed.Updated())
+	}
+}
+
+func TestRSS(t *testing.T) {
+	feed := newTestFeed(t)
+	b, err := feed.RSS()
+	if err != nil {
+		t.Fatalf("Unexpected error from RSS: %s", err)
+	}
+	actual := rss{}
+	if err := xml.Unmarshal(b, &actual); err != nil {
+		t.Fatalf("Unexpected error parsing RSS: %s", err)
+	}
+	if actual.Channel.LastBuildDate != "Wed, 01 May 2024 00:00:00 +0000" {
+		t.Errorf("Unexpected lastBuildDate: %s", actual.Channel.LastBuildDate)
+	}
+	if len(actual.Channel.Items) != 2 || actual.Channel.Items[0].Description != "<p>Newer</p>" {
+		t.Errorf("Unexpected items: %v", actual.Channel.Items)
+	}
+	if !strings.Contains(string(b), "&lt;p&gt;Newer&lt;/p&gt;") {
+		t.Errorf("Expected item content to be escaped HTML: %s", b)
+	}
+}
+
+func TestAtom(t *testing.T) {
+	feed := newTestFeed(t)
+	b, err := feed.Atom()
+	if err != nil {
+		t.Fatalf("Unexpected error from Atom: %s", err)
+	}
+	actual := atomFeed{}
+	if err := xml.Unmarshal(b, &actual); err != nil {
+		t.Fatalf("Unexpected error parsing Atom: %s", err)
+	}
+	if actual.Updated != "2024-05-01T00:00:00Z" {
+		t.Errorf("Unexpected updated: %s", actual.Updated)
+	}
+	if len(actual.Entries) != 2 || actual.Entries[1].ID != "https://example.com/posts/older.html" {
+		t.Errorf("Unexpected entries: %v", actual.Entries)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	feed := newTestFeed(t)
+	b, err := feed.JSON()
+	if err != nil {
+		t.Fatalf("Unexpected error from JSON: %s", err)
+	}
+	actual := jsonFeed{}
+	if err := json.Unmarshal(b, &actual); err != nil {
+		t.Fatalf("Unexpected error parsing JSON feed: %s", err)
+	}
+	if actual.FeedURL != "https://example.com/feed.json" {
+		t.Errorf("Unexpected feed_url: %s", actual.FeedURL)
+	}
+	if len(actual.Items) != 2 || actual.Items[0].DatePublished != "2024-05-01T00:00:00Z" {
+		t.Errorf("Unexpected items: %v", actual.Items)
+	}
+}
+
+func TestFeedsAreDeterministic(t *testing.T) {
+	for _, render := range []func(Feed) ([]byte, error){Feed.RSS, Feed.Atom, Feed.JSON} {
+		first, err := render(newTestFeed(t))
+		if err != nil {
+			t.Fatalf("Unexpected error rendering feed: %s", err)
+		}
+		second, err := render(newTestFeed(t))
+		if err != nil {
+			t.Fatalf("Unexpected error rendering feed: %s", err)
+		}
+		if string(first) != string(second) {
+			t.Errorf("Expected identical feeds, got:\n%s\n%s", first, second)
+		}
+	}
+}
+
+func TestAbsoluteLinks(t *testing.T) {
+	cases := []struct {
+		content  string
+		expected string
+	}{
+		{
+			`<a href="/about.html">About</a> <a href="other.html#top">Other</a>`,
+			`<a href="https://example.com/about.html">About</a> <a href="https://example.com/posts/other.html#top">Other</a>`,
+		},
+		{
+			`<img src="../images/a.png" alt="A">`,
+			`<img src="https://example.com/images/a.png" alt="A">`,
+		},
+		{
+			`<source srcset="/images/a-480w.webp 480w, /images/a-960w.webp 960w">`,
+			`<source srcset="https://example.com/images/a-480w.webp 480w, https://example.com/images/a-960w.webp 960w">`,
+		},
+		{
+			`<a href="https://github.com/krmckone">GitHub</a> <a href="mailto:a@example.com">Mail</a>`,
+			`<a href="https://github.com/krmckone">GitHub</a> <a href="mailto:a@example.com">Mail</a>`,
+		},
+	}
+	for _, c := range cases {
+		if actual := absoluteLinks(c.content, "https://example.com/posts/a.html"); actual != c.expected {
+			t.Errorf("Expected: %s, actual: %s", c.expected, actual)
+		}
+	}
+}
+
+func TestNewFeedAbsoluteLinks(t *testing.T) {
+	pages := []page.Page{{Name: "a", URL: "/posts/a.html", Date: time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC), HTML: `<img src="../images/a.png">`}}
+	feed, err := NewFeed("Test Site", "", "", "https://example.com", pages)
+	if err != nil {
+		t.Fatalf("Unexpected error from NewFeed: %s", err)
+	}
+	if expected := `<img src="https://example.com/images/a.png">`; feed.Items[0].Content != expected {
+		t.Errorf("Expected: %s, actual: %s", expected, feed.Items[0].Content)
+	}
+}
@@ -0,0 +1,113 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"path"
+	"strings"
+
+	"github.com/krmckone/lk-site/internal/cache"
+)
+
+// ManifestFile is where the manifest is written in the build directory
+const ManifestFile = "assets.json"
+
+// hashLength is how many hex digits of the content's hash are in a name
+const hashLength = 8
+
+// File is an asset written under its fingerprinted name
+type File struct {
+	Path      string `json:"path"`      // e.g. css/styles.3fa2c1d0.css
+	Integrity string `json:"integrity"` // Subresource Integrity hash, e.g. sha384-...
+}
+
+// Manifest maps the names of assets to their fingerprinted files. Templates
+// link to an asset with the asset function, so that a changed asset gets a
+// new URL and caches never serve a stale copy of it
+type Manifest struct {
+	integrity bool
+	files     map[string]File
+}
+
+// NewManifest returns an empty manifest, whose integrity function gives the
+// attributes for Subresource Integrity when integrity is set
+func NewManifest(integrity bool) *Manifest {
+	return &Manifest{integrity: integrity, files: map[string]File{}}
+}
+
+// Add adds the asset at name, a path from the root of the site like
+// css/styles.css, with the content b, and returns the file it's written to.
+// Assets are all added before any template looks them up
+func (m *Manifest) Add(name string, b []byte) File {
+	sum := sha256.Sum256(b)
+	ext := path.Ext(name)
+	integrity := sha512.Sum384(b)
+	f := File{
+		Path:      fmt.Sprintf("%s.%s%s", strings.TrimSuffix(name, ext), hex.EncodeToString(sum[:])[:hashLength], ext),
+		Integrity: "sha384-" + base64.StdEncoding.EncodeToString(integrity[:]),
+	}
+	m.files[name] = f
+	return f
+}
+
+// lookup returns the file of the asset at name, which may start with a slash
+func (m *Manifest) lookup(name string) (File, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	f, ok := m.files[name]
+	if !ok {
+		return File{}, fmt.Errorf("%s isn't a fingerprinted asset", name)
+	}
+	return f, nil
+}
+
+// Asset is the asset template function. It returns the URL of the
+// fingerprinted file of an asset, e.g. {{ asset "css/styles.css" }} is
+// /css/styles.3fa2c1d0.css
+func (m *Manifest) Asset(name string) (string, error) {
+	f, err := m.lookup(name)
+	if err != nil {
+		return "", fmt.Errorf("asset: %s", err)
+	}
+	return "/" + f.Path, nil
+}
+
+// Integrity is the integrity template function. It returns the integrity and
+// crossorigin attributes for an asset, or nothing when the manifest isn't for
+// Subresource Integrity, e.g.
+// <script src="{{ asset "js/shaders.js" }}"{{ integrity "js/shaders.js" }}></script>
+func (m *Manifest) Integrity(name string) (template.HTMLAttr, error) {
+	f, err := m.lookup(name)
+	if err != nil {
+		return "", fmt.Errorf("integrity: %s", err)
+	}
+	if !m.integrity {
+		return "", nil
+	}
+	return template.HTMLAttr(fmt.Sprintf(` integrity="%s" crossorigin="anonymous"`, f.Integrity)), nil
+}
+
+// TemplateFuncs returns the asset and integrity template functions for the
+// assets in m
+func TemplateFuncs(m *Manifest) template.FuncMap {
+	return template.FuncMap{
+		"asset":     m.Asset,
+		"integrity": m.Integrity,
+	}
+}
+
+// JSON renders the manifest as the files by the names of their assets
+func (m *Manifest) JSON() ([]byte, error) {
+	return json.MarshalIndent(m.files, "", "  ")
+}
+
+// Key identifies the files, for the build cache keys of the pages that link
+// to them
+func (m *Manifest) Key() string {
+	b, _ := m.JSON()
+	return cache.Hash(b)
+}
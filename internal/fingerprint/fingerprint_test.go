@@ -0,0 +1,89 @@
+package fingerprint
+
+import (
+	"encoding/json"
+	"html/template"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	m := NewManifest(false)
+	f := m.Add("css/styles.css", []byte("body {}"))
+	if f.Path != "css/styles.62368a1a.css" {
+		t.Errorf("Expected: css/styles.62368a1a.css, actual: %s", f.Path)
+	}
+	if expected := "sha384-JvbluEOKMBmUtNHx346xlZFWqKqtOmexOupPSHRCR0NbwTey4wjq9itKKoSWuGsH"; f.Integrity != expected {
+		t.Errorf("Expected: %s, actual: %s", expected, f.Integrity)
+	}
+	if changed := m.Add("css/styles.css", []byte("body { margin: 0 }")); changed.Path == f.Path {
+		t.Errorf("Expected changed content to change the path, actual: %s", changed.Path)
+	}
+	if f := m.Add("LICENSE", []byte("MIT")); !strings.HasPrefix(f.Path, "LICENSE.") {
+		t.Errorf("Expected a name without an extension to end with the hash, actual: %s", f.Path)
+	}
+}
+
+func TestAsset(t *testing.T) {
+	m := NewManifest(false)
+	f := m.Add("js/shaders.js", []byte("init()"))
+	for _, name := range []string{"js/shaders.js", "/js/shaders.js", "js/../js/shaders.js"} {
+		actual, err := m.Asset(name)
+		if err != nil {
+			t.Fatalf("Unexpected error from Asset: %s", err)
+		}
+		if expected := "/" + f.Path; actual != expected {
+			t.Errorf("Expected: %s, actual: %s", expected, actual)
+		}
+	}
+	if _, err := m.Asset("js/missing.js"); err == nil {
+		t.Errorf("Expected an error for an asset that isn't in the manifest")
+	}
+}
+
+func TestIntegrity(t *testing.T) {
+	cases := []struct {
+		integrity bool
+		expected  string
+	}{
+		{false, `<script src="/js/shaders.%s.js"></script>`},
+		{true, `<script src="/js/shaders.%s.js" integrity="%s" crossorigin="anonymous"></script>`},
+	}
+	for _, c := range cases {
+		m := NewManifest(c.integrity)
+		f := m.Add("js/shaders.js", []byte("init()"))
+		tmpl, err := template.New("page").Funcs(TemplateFuncs(m)).Parse(`<script src="{{ asset "js/shaders.js" }}"{{ integrity "js/shaders.js" }}></script>`)
+		if err != nil {
+			t.Fatalf("Unexpected error from Parse: %s", err)
+		}
+		b := strings.Builder{}
+		if err := tmpl.Execute(&b, nil); err != nil {
+			t.Fatalf("Unexpected error from Execute: %s", err)
+		}
+		hash := strings.TrimSuffix(strings.TrimPrefix(f.Path, "js/shaders."), ".js")
+		expected := strings.Replace(strings.Replace(c.expected, "%s", hash, 1), "%s", f.Integrity, 1)
+		if b.String() != expected {
+			t.Errorf("Expected: %s, actual: %s", expected, b.String())
+		}
+	}
+	if _, err := NewManifest(true).Integrity("js/missing.js"); err == nil {
+		t.Errorf("Expected an error for an asset that isn't in the manifest")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	m := NewManifest(false)
+	m.Add("css/styles.css", []byte("body {}"))
+	b, err := m.JSON()
+	if err != nil {
+		t.Fatalf("Unexpected error from JSON: %s", err)
+	}
+	actual := map[string]File{}
+	if err := json.Unmarshal(b, &actual); err != nil {
+		t.Fatalf("Unexpected error from Unmarshal: %s", err)
+	}
+	if !reflect.DeepEqual(actual, m.files) {
+		t.Errorf("Expected: %+v, actual: %+v", m.files, actual)
+	}
+}
@@ -0,0 +1,75 @@
+package highlight
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+)
+
+const (
+	// StylesheetFile is where the stylesheet for highlighted code is written in
+	// the build directory
+	StylesheetFile = "css/syntax.css"
+
+	DefaultLightStyle = "github"
+	DefaultDarkStyle  = "github-dark"
+)
+
+// Extension highlights fenced code blocks when the markdown is converted. The
+// highlighted code is marked up with classes rather than inline styles, so the
+// colors come from the stylesheet and follow the reader's light or dark theme.
+// A fence can number its lines and highlight some of them with attributes
+// after the language:
+//
+//	```go {linenos=table,hl_lines=[2,"4-5"],linenostart=10}
+//
+// Code in a language without a lexer is left as a plain code block
+func Extension() goldmark.Extender {
+	return highlighting.NewHighlighting(
+		highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+	)
+}
+
+// Stylesheet returns the CSS for highlighted code using the chroma style named
+// light, and the one named dark when the reader prefers a dark theme. Styles
+// are listed at https://xyproto.github.io/splash/docs/
+func Stylesheet(light, dark string) ([]byte, error) {
+	lightStyle, err := getStyle(light)
+	if err != nil {
+		return nil, err
+	}
+	darkStyle, err := getStyle(dark)
+	if err != nil {
+		return nil, err
+	}
+	// The stylesheet covers line numbers as well, for the blocks that ask for them
+	formatter := chromahtml.New(
+		chromahtml.WithClasses(true),
+		chromahtml.WithLineNumbers(true),
+		chromahtml.LineNumbersInTable(true),
+	)
+	b := bytes.Buffer{}
+	fmt.Fprintf(&b, "/* Generated by lk-site from the %s and %s styles */\n", light, dark)
+	if err := formatter.WriteCSS(&b, lightStyle); err != nil {
+		return nil, fmt.Errorf("error writing %s style: %s", light, err)
+	}
+	b.WriteString("\n@media (prefers-color-scheme: dark) {\n")
+	if err := formatter.WriteCSS(&b, darkStyle); err != nil {
+		return nil, fmt.Errorf("error writing %s style: %s", dark, err)
+	}
+	b.WriteString("\n}\n")
+	return b.Bytes(), nil
+}
+
+func getStyle(name string) (*chroma.Style, error) {
+	style, ok := styles.Registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown highlighting style %q", name)
+	}
+	return style, nil
+}
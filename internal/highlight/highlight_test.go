@@ -0,0 +1,141 @@
+package highlight
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/yuin/goldmark"
+)
+
+func convert(t *testing.T, markdown string) string {
+	t.Helper()
+	b := bytes.Buffer{}
+	if err := goldmark.New(goldmark.WithExtensions(Extension())).Convert([]byte(markdown), &b); err != nil {
+		t.Fatalf("Unexpected error converting markdown: %s", err)
+	}
+	return b.String()
+}
+
+func TestExtension(t *testing.T) {
+	cases := []struct {
+		name     string
+		markdown string
+		contains []string
+		excludes []string
+	}{
+		{
+			"classes",
+			"```go\nfunc main() {}\n```\n",
+			[]string{`<pre class="chroma"><code>`, `<span class="kd">func</span>`},
+			[]string{"style="},
+		},
+		{
+			"line numbers and highlighted lines",
+			"```rust {linenos=table,hl_lines=[2]}\nfn main() {\n    let x = 1;\n}\n```\n",
+			[]string{`class="lntable"`, `<span class="lnt">3`, `<span class="line hl">`},
+			nil,
+		},
+		{
+			"line numbers starting elsewhere",
+			"```cpp {linenos=inline,linenostart=10,hl_lines=[\"1-2\"]}\nint a;\nint b;\nint c;\n```\n",
+			[]string{`<span class="ln">10</span>`, `<span class="ln">12</span>`, `<span class="line hl"><span class="ln">11</span>`},
+			[]string{`<span class="line hl"><span class="ln">12</span>`},
+		},
+		{
+			"shaders",
+			"```glsl\nuniform vec3 color;\n```\n\n```wgsl\n@fragment fn main() -> @location(0) vec4f { return vec4f(1.0); }\n```\n",
+			[]string{`<span class="k">uniform</span>`, `<span class="nd">@fragment</span>`, `<span class="kt">vec4f</span>`},
+			nil,
+		},
+		{
+			"unknown language",
+			"```notalanguage\nplain <text>\n```\n",
+			[]string{`<pre><code class="language-notalanguage">plain &lt;text&gt;`},
+			nil,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := convert(t, c.markdown)
+			for _, s := range c.contains {
+				if !strings.Contains(actual, s) {
+					t.Errorf("Expected: %s, actual: %s", s, actual)
+				}
+			}
+			for _, s := range c.excludes {
+				if strings.Contains(actual, s) {
+					t.Errorf("Expected no %s, actual: %s", s, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestWGSL(t *testing.T) {
+	if lexers.Get("wgsl") != WGSL {
+		t.Fatalf("Expected the WGSL lexer to be registered")
+	}
+	source := "/* a /* nested */ comment */ let x: vec3<f32> = vec3(1.5, 2e3f, 0x1u); x += 1i;"
+	tokens, err := chroma.Tokenise(WGSL, nil, source)
+	if err != nil {
+		t.Fatalf("Unexpected error tokenising: %s", err)
+	}
+	expected := map[string]chroma.TokenType{
+		"let":  chroma.Keyword,
+		"vec3": chroma.KeywordType,
+		"f32":  chroma.KeywordType,
+		"1.5":  chroma.LiteralNumberFloat,
+		"2e3f": chroma.LiteralNumberFloat,
+		"0x1u": chroma.LiteralNumberHex,
+		"1i":   chroma.LiteralNumberInteger,
+		"+=":   chroma.Operator,
+	}
+	comment := ""
+	for _, token := range tokens {
+		if token.Type == chroma.CommentMultiline {
+			comment += token.Value
+		}
+		if tokenType, ok := expected[token.Value]; ok {
+			if token.Type != tokenType {
+				t.Errorf("Expected %q to be %s, actual: %s", token.Value, tokenType, token.Type)
+			}
+			delete(expected, token.Value)
+		}
+		if token.Type == chroma.Error {
+			t.Errorf("Unexpected error token %q", token.Value)
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("Expected tokens not found: %v", expected)
+	}
+	if comment != "/* a /* nested */ comment */" {
+		t.Errorf("Expected the nested comment as one, actual: %s", comment)
+	}
+}
+
+func TestStylesheet(t *testing.T) {
+	b, err := Stylesheet(DefaultLightStyle, DefaultDarkStyle)
+	if err != nil {
+		t.Fatalf("Unexpected error from Stylesheet: %s", err)
+	}
+	css := string(b)
+	light, dark, ok := strings.Cut(css, "@media (prefers-color-scheme: dark) {")
+	if !ok {
+		t.Fatalf("Expected a dark theme, actual: %s", css)
+	}
+	for _, rule := range []string{".chroma .hl {", ".chroma .lnt {", ".chroma .kd {"} {
+		if !strings.Contains(light, rule) || !strings.Contains(dark, rule) {
+			t.Errorf("Expected %s in both themes, actual: %s", rule, css)
+		}
+	}
+	if light == dark {
+		t.Errorf("Expected the themes to differ")
+	}
+
+	if _, err := Stylesheet("nostyle", DefaultDarkStyle); err == nil {
+		t.Errorf("Expected an error for an unknown style")
+	}
+}
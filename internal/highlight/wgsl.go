@@ -0,0 +1,56 @@
+package highlight
+
+import (
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// WGSL lexes the WebGPU Shading Language, which chroma doesn't have a lexer for
+// yet. See https://www.w3.org/TR/WGSL/
+var WGSL = lexers.Register(chroma.MustNewLexer(
+	&chroma.Config{
+		Name:      "WGSL",
+		Aliases:   []string{"wgsl"},
+		Filenames: []string{"*.wgsl"},
+		MimeTypes: []string{"text/wgsl"},
+	},
+	wgslRules,
+))
+
+func wgslRules() chroma.Rules {
+	return chroma.Rules{
+		"root": {
+			{Pattern: `\s+`, Type: chroma.TextWhitespace},
+			{Pattern: `//[^\n]*`, Type: chroma.CommentSingle},
+			{Pattern: `/\*`, Type: chroma.CommentMultiline, Mutator: chroma.Push("comment")},
+			{Pattern: `@[a-zA-Z_]\w*`, Type: chroma.NameDecorator},
+			{Pattern: chroma.Words(``, `\b`,
+				"alias", "break", "case", "const", "const_assert", "continue", "continuing",
+				"default", "diagnostic", "discard", "else", "enable", "fn", "for", "if", "let",
+				"loop", "override", "requires", "return", "struct", "switch", "var", "while",
+			), Type: chroma.Keyword},
+			{Pattern: `(true|false)\b`, Type: chroma.KeywordConstant},
+			{Pattern: chroma.Words(``, `\b`,
+				"function", "private", "workgroup", "uniform", "storage", "read", "write", "read_write",
+			), Type: chroma.KeywordReserved},
+			{Pattern: `(bool|f16|f32|i32|u32|array|atomic|ptr|sampler|sampler_comparison)\b`, Type: chroma.KeywordType},
+			{Pattern: `(vec[234]|mat[234]x[234])[fhiu]?\b`, Type: chroma.KeywordType},
+			{Pattern: `texture_\w+\b`, Type: chroma.KeywordType},
+			{Pattern: `0[xX][0-9a-fA-F]+[iu]?`, Type: chroma.LiteralNumberHex},
+			{Pattern: `(\d+\.\d*|\.\d+)([eE][+-]?\d+)?[fh]?`, Type: chroma.LiteralNumberFloat},
+			{Pattern: `\d+([eE][+-]?\d+[fh]?|[fh])`, Type: chroma.LiteralNumberFloat},
+			{Pattern: `\d+[iu]?`, Type: chroma.LiteralNumberInteger},
+			{Pattern: `[a-zA-Z_]\w*(?=\s*\()`, Type: chroma.NameFunction},
+			{Pattern: `[a-zA-Z_]\w*`, Type: chroma.Name},
+			{Pattern: `->|\+\+|--|&&|\|\||<<=?|>>=?|[-+*/%&|^!=<>]=?|~`, Type: chroma.Operator},
+			{Pattern: `[{}()\[\],.;:]`, Type: chroma.Punctuation},
+		},
+		// Block comments nest in WGSL
+		"comment": {
+			{Pattern: `/\*`, Type: chroma.CommentMultiline, Mutator: chroma.Push()},
+			{Pattern: `\*/`, Type: chroma.CommentMultiline, Mutator: chroma.Pop(1)},
+			{Pattern: `[^/*]+`, Type: chroma.CommentMultiline},
+			{Pattern: `[/*]`, Type: chroma.CommentMultiline},
+		},
+	}
+}
@@ -0,0 +1,60 @@
+package images
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultCwebp is the WebP encoder used when the config doesn't name one
+const DefaultCwebp = "cwebp"
+
+// cwebp runs libwebp's cwebp to write the WebP variants, since there's no WebP
+// encoder for Go that builds without cgo
+type cwebp struct {
+	path    string
+	version string // Part of the key of every WebP variant, so a new encoder replaces them
+}
+
+// findCwebp returns the cwebp at path, or on the PATH when path is just a name
+func findCwebp(path string) (*cwebp, error) {
+	found, err := exec.LookPath(path)
+	if err != nil {
+		return nil, err
+	}
+	out, err := exec.Command(found, "-version").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running %s -version: %s", found, err)
+	}
+	return &cwebp{path: found, version: strings.TrimSpace(string(out))}, nil
+}
+
+// encode returns m encoded as WebP at quality, which cwebp maps to its
+// quantizer the same way as cwebp -q. m is handed over as a PNG, so nothing
+// is lost on the way
+func (e *cwebp) encode(m image.Image, quality int) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "lk-site-cwebp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	input, output := filepath.Join(dir, "input.png"), filepath.Join(dir, "output.webp")
+	b := bytes.Buffer{}
+	if err := png.Encode(&b, m); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(input, b.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(e.path, "-quiet", "-q", strconv.Itoa(quality), "-metadata", "none", input, "-o", output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("error running %s: %s: %s", e.path, err, strings.TrimSpace(string(out)))
+	}
+	return os.ReadFile(output)
+}
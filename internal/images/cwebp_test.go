@@ -0,0 +1,47 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os/exec"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestCwebp(t *testing.T) {
+	if _, err := exec.LookPath(DefaultCwebp); err != nil {
+		t.Skipf("cwebp isn't installed: %s", err)
+	}
+	encoder, err := findCwebp(DefaultCwebp)
+	if err != nil {
+		t.Fatalf("Unexpected error from findCwebp: %s", err)
+	}
+	if encoder.version == "" {
+		t.Errorf("Expected the version of cwebp")
+	}
+	m := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			m.Set(x, y, color.RGBA{uint8(x * 6), uint8(y * 12), 128, 255})
+		}
+	}
+	b, err := encoder.encode(m, 80)
+	if err != nil {
+		t.Fatalf("Unexpected error from encode: %s", err)
+	}
+	cfg, err := webp.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Unexpected error decoding the WebP: %s", err)
+	}
+	if cfg.Width != 40 || cfg.Height != 20 {
+		t.Errorf("Expected: 40x20, actual: %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestCwebpMissing(t *testing.T) {
+	if _, err := findCwebp("lk-site-missing-cwebp"); err == nil {
+		t.Errorf("Expected an error for a cwebp that isn't installed")
+	}
+}
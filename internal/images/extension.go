@@ -0,0 +1,109 @@
+package images
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindPicture is the kind of Picture nodes
+var KindPicture = ast.NewNodeKind("Picture")
+
+// Picture is an image in markdown that was resized, shown with its variants
+type Picture struct {
+	ast.BaseInline
+	Image Image
+	Alt   string
+	Title string
+}
+
+func (n *Picture) Kind() ast.NodeKind {
+	return KindPicture
+}
+
+func (n *Picture) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"URL": n.Image.URL, "Alt": n.Alt}, nil)
+}
+
+// Extension renders the Picture nodes that Pictures puts in a document
+func Extension() goldmark.Extender {
+	return extension{}
+}
+
+type extension struct{}
+
+func (e extension) Extend(m goldmark.Markdown) {
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(nodeRenderer{}, 500)))
+}
+
+type nodeRenderer struct{}
+
+func (r nodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindPicture, r.renderPicture)
+}
+
+func (r nodeRenderer) renderPicture(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		picture := n.(*Picture)
+		w.WriteString(picture.Image.HTML(picture.Alt, picture.Title))
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+// Pictures replaces the images in doc that are in the set with Picture nodes.
+// An image's destination is resolved against pageURL, the URL of the page the
+// markdown is for, e.g. ../images/a.jpg from /posts/b.html is /images/a.jpg
+func (s *Set) Pictures(doc ast.Node, source []byte, pageURL string) {
+	images := []*ast.Image{}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if img, ok := n.(*ast.Image); ok && entering {
+			images = append(images, img)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, node := range images {
+		img, ok := s.Lookup(resolve(string(node.Destination), pageURL))
+		if !ok || len(img.Variants) == 0 {
+			continue
+		}
+		picture := &Picture{Image: img, Alt: altText(node, source), Title: string(node.Title)}
+		node.Parent().ReplaceChild(node.Parent(), node, picture)
+	}
+}
+
+// resolve returns the path on the site of the destination of an image, or an
+// empty string for an image on another site
+func resolve(destination, pageURL string) string {
+	u, err := url.Parse(destination)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return ""
+	}
+	if strings.HasPrefix(u.Path, "/") {
+		return path.Clean(u.Path)
+	}
+	return path.Join(path.Dir(pageURL), u.Path)
+}
+
+// altText returns the plain text of an image's description
+func altText(img *ast.Image, source []byte) string {
+	b := strings.Builder{}
+	ast.Walk(img, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Text:
+			b.Write(node.Value(source))
+		case *ast.String:
+			b.Write(node.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
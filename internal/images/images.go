@@ -0,0 +1,505 @@
+package images
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	goruntime "runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/krmckone/lk-site/internal/cache"
+	"github.com/krmckone/lk-site/internal/config"
+	"golang.org/x/image/draw"
+)
+
+// The defaults for settings missing from the config
+var DefaultWidths = []int{480, 960, 1440}
+
+const (
+	DefaultQuality = 80
+	DefaultSizes   = "(max-width: 960px) 100vw, 960px"
+)
+
+// imagesDir is the directory of the assets and of the build the images are in
+const imagesDir = "images"
+
+// encoding is part of the key of the JPEG and PNG variants, so that changing
+// how they're encoded replaces the variants stored by earlier builds. WebP
+// variants are keyed by the version of cwebp instead
+const encoding = "3"
+
+// Variant is an image resized to one of the configured widths
+type Variant struct {
+	URL    string // e.g. /images/steam_deck/oled-960w.webp
+	Type   string // Media type, e.g. image/webp
+	Width  int
+	Height int
+}
+
+// Image is a JPEG or PNG under assets/images along with its variants. Its size
+// is the size it's shown at, which is turned for a photo taken sideways
+type Image struct {
+	URL      string // The image as written, e.g. /images/steam_deck/oled.jpg
+	Type     string // Media type, e.g. image/jpeg
+	Width    int
+	Height   int
+	Variants []Variant // From the narrowest to the widest, in the image's own type and then as WebP for a JPEG
+	Metadata Metadata  // The fields of its EXIF the config keeps for it
+	sizes    string
+}
+
+// Set is the images of a build by their URL
+type Set struct {
+	images map[string]Image
+}
+
+// Process writes every file under the images directory of assetsPath to the same
+// place under buildPath, along with the variants of the JPEGs and PNGs. Their
+// metadata is stripped, other than the EXIF fields c.Metadata keeps for them
+// and the orientation, which variants are turned to instead. An image gets a variant at each
+// configured width narrower than itself, and at its own width when that's no
+// wider than the widest configured one, in its own type and, for JPEGs, as
+// WebP when cwebp is installed. Images that can't be decoded, or whose metadata
+// can't be stripped, like a truncated JPEG, are written as they are.
+// With a buildCache, variants are keyed by the content of their image, and
+// variants with unchanged images are skipped. Images are processed concurrently
+// with workers workers, or one per CPU when that's less than 1
+func Process(assetsPath, buildPath string, c config.ImagesConfig, workers int, buildCache *cache.Cache) (*Set, error) {
+	widths := c.Widths
+	if len(widths) == 0 {
+		widths = DefaultWidths
+	}
+	quality := c.Quality
+	if quality <= 0 {
+		quality = DefaultQuality
+	}
+	sizes := c.Sizes
+	if sizes == "" {
+		sizes = DefaultSizes
+	}
+	if workers < 1 {
+		workers = goruntime.GOMAXPROCS(0)
+	}
+	webp, err := findCwebp(cmp.Or(c.Cwebp, DefaultCwebp))
+	if err != nil {
+		log.Printf("Not writing WebP variants without cwebp: %s", err)
+	}
+
+	paths := []string{}
+	err = filepath.WalkDir(filepath.Join(assetsPath, imagesDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Set{images: map[string]Image{}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	processed := make([]*Image, len(paths))
+	errs := make([]error, len(paths))
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for range min(workers, len(paths)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				processed[i], errs[i] = process(assetsPath, buildPath, paths[i], widths, quality, c.Metadata, webp, buildCache)
+				if errs[i] != nil {
+					errs[i] = fmt.Errorf("error processing %s: %s", paths[i], errs[i])
+				}
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	set := &Set{images: map[string]Image{}}
+	for _, img := range processed {
+		if img != nil {
+			img.sizes = sizes
+			set.images[img.URL] = *img
+		}
+	}
+	return set, nil
+}
+
+// process writes the file at path without its metadata along with its
+// variants, and returns nil when it isn't an image that can be decoded or
+// whose metadata can't be stripped, which is written as it is. JPEGs
+// only get WebP variants with webp
+func process(assetsPath, buildPath, path string, widths []int, quality int, allow map[string][]string, webp *cwebp, buildCache *cache.Cache) (*Image, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(assetsPath, path)
+	if err != nil {
+		return nil, err
+	}
+	rel = filepath.ToSlash(rel)
+	switch strings.ToLower(filepath.Ext(rel)) {
+	case ".jpg", ".jpeg", ".png":
+	default:
+		return nil, write(buildPath, rel, b, buildCache)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		log.Printf("Not resizing %s, which can't be decoded: %s", path, err)
+		return nil, write(buildPath, rel, b, buildCache)
+	}
+
+	fields, err := allowedFields(allow, strings.TrimPrefix(rel, imagesDir+"/"))
+	if err != nil {
+		return nil, err
+	}
+	exif, err := readExif(b, format)
+	if err != nil {
+		log.Printf("Not resizing %s or stripping its metadata, which can't be read: %s", path, err)
+		return nil, write(buildPath, rel, b, buildCache)
+	}
+	metadata := exifMetadata{orientation: 1}
+	if exif != nil {
+		if metadata, err = parseExif(exif); err != nil {
+			log.Printf("Not keeping the EXIF of %s, which can't be read: %s", path, err)
+		}
+	}
+	metadata = metadata.keep(fields)
+	stripped, err := strip(b, format, encodeExif(metadata))
+	if err != nil {
+		log.Printf("Not resizing %s or stripping its metadata, which can't be read: %s", path, err)
+		return nil, write(buildPath, rel, b, buildCache)
+	}
+	if err := write(buildPath, rel, stripped, buildCache); err != nil {
+		return nil, err
+	}
+
+	img := &Image{URL: "/" + rel, Type: "image/" + format, Width: cfg.Width, Height: cfg.Height, Metadata: metadata.Metadata}
+	turned := metadata.orientation >= 5
+	if turned {
+		img.Width, img.Height = cfg.Height, cfg.Width
+	}
+
+	// The image is only decoded when one of its variants has to be encoded
+	var src image.Image
+	decode := func() error {
+		if src != nil {
+			return nil
+		}
+		src, _, err = image.Decode(bytes.NewReader(b))
+		return err
+	}
+	// Only photos are converted to WebP, since lossy encoding blurs the text
+	// and sharp edges of screenshots and drops transparency
+	types := []string{img.Type}
+	if format == "jpeg" && webp != nil {
+		types = append(types, "image/webp")
+	}
+
+	base := strings.TrimSuffix(rel, filepath.Ext(rel))
+	for _, width := range variantWidths(img.Width, widths) {
+		height := max(1, (img.Height*width+img.Width/2)/img.Width)
+		var resized image.Image
+		for _, t := range types {
+			ext := filepath.Ext(rel)
+			if t == "image/webp" {
+				ext = ".webp"
+			}
+			output := fmt.Sprintf("%s-%dw%s", base, width, ext)
+			img.Variants = append(img.Variants, Variant{URL: "/" + output, Type: t, Width: width, Height: height})
+			encoder := encoding
+			if t == "image/webp" {
+				encoder = webp.version
+			}
+			key := cache.Hash(b, []byte(fmt.Sprintf("%s %dx%d %d %s", t, width, height, quality, encoder)))
+			if buildCache.Fresh(output, key) {
+				continue
+			}
+			// A variant stored by an earlier build is reused even when the build
+			// directory was cleaned, since encoding is the slow part
+			encoded, ok := buildCache.ReadContent(key)
+			if !ok {
+				if resized == nil {
+					if err := decode(); err != nil {
+						log.Printf("Not resizing %s, which can't be decoded: %s", path, err)
+						return nil, nil
+					}
+					// The image is resized as it's stored and then turned, which
+					// is less work than turning it whole
+					if turned {
+						resized = orient(resize(src, height, width), metadata.orientation)
+					} else {
+						resized = orient(resize(src, width, height), metadata.orientation)
+					}
+				}
+				if encoded, err = encode(resized, t, quality, webp); err != nil {
+					return nil, err
+				}
+				if err := buildCache.WriteContent(key, encoded); err != nil {
+					return nil, err
+				}
+			}
+			if err := writeFile(buildPath, output, encoded); err != nil {
+				return nil, err
+			}
+			buildCache.Put(output, key)
+		}
+	}
+	return img, nil
+}
+
+// write writes b to output under buildPath unless it's there from the
+// previous build
+func write(buildPath, output string, b []byte, buildCache *cache.Cache) error {
+	key := cache.Hash(b)
+	if buildCache.Fresh(output, key) {
+		return nil
+	}
+	if err := writeFile(buildPath, output, b); err != nil {
+		return err
+	}
+	buildCache.Put(output, key)
+	return nil
+}
+
+func writeFile(buildPath, output string, b []byte) error {
+	dst := filepath.Join(buildPath, filepath.FromSlash(output))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, b, 0644)
+}
+
+// variantWidths returns the configured widths narrower than width, and width
+// itself when it's no wider than the widest of them
+func variantWidths(width int, widths []int) []int {
+	variants := []int{}
+	for _, w := range widths {
+		if w > 0 && w < width && !slices.Contains(variants, w) {
+			variants = append(variants, w)
+		}
+	}
+	if width <= slices.Max(widths) {
+		variants = append(variants, width)
+	}
+	slices.Sort(variants)
+	return variants
+}
+
+// resize scales src to width by height
+func resize(src image.Image, width, height int) image.Image {
+	if src.Bounds().Dx() == width && src.Bounds().Dy() == height {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// orient turns or flips m from how it's stored to how it's shown, by its EXIF
+// orientation
+func orient(m image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return m
+	}
+	bounds := m.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// The pixel of m that's shown at x, y
+			sx, sy := x, y
+			switch orientation {
+			case 2:
+				sx = w - 1 - x
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sy = h - 1 - y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, m.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// encode returns m encoded as the media type t, with webp for WebP
+func encode(m image.Image, t string, quality int, webp *cwebp) ([]byte, error) {
+	b := bytes.Buffer{}
+	var err error
+	switch t {
+	case "image/jpeg":
+		err = jpeg.Encode(&b, m, &jpeg.Options{Quality: quality})
+	case "image/png":
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&b, m)
+	case "image/webp":
+		return webp.encode(m, quality)
+	default:
+		err = fmt.Errorf("can't encode %s", t)
+	}
+	return b.Bytes(), err
+}
+
+// Lookup returns the image with the URL, e.g. /images/steam_deck/oled.jpg
+func (s *Set) Lookup(url string) (Image, bool) {
+	if s == nil {
+		return Image{}, false
+	}
+	img, ok := s.images[url]
+	return img, ok
+}
+
+// Image is the image template function. It returns the image at src, which is
+// a path from the root of the site like images/steam_deck/oled.jpg, for its
+// size and the metadata kept for it, e.g.
+// {{ (image "images/steam_deck/oled.jpg").Metadata.Camera }}
+func (s *Set) Image(src string) (Image, error) {
+	img, ok := s.Lookup(path.Join("/", src))
+	if !ok {
+		return Image{}, fmt.Errorf("image: %s isn't a JPEG or PNG under %s", src, imagesDir)
+	}
+	return img, nil
+}
+
+// Key identifies the images and their variants, for the build cache keys of
+// the pages that show them
+func (s *Set) Key() string {
+	if s == nil {
+		return ""
+	}
+	urls := []string{}
+	for url := range s.images {
+		urls = append(urls, url)
+	}
+	slices.Sort(urls)
+	b := bytes.Buffer{}
+	for _, url := range urls {
+		fmt.Fprintf(&b, "%+v\n", s.images[url])
+	}
+	return cache.Hash(b.Bytes())
+}
+
+// Figure is the figure template function. It shows the image at src, which is
+// a path from the root of the site like images/steam_deck/oled.jpg, with an
+// optional alt text and caption given as key and value pairs, e.g.
+// {{ figure "images/steam_deck/oled.jpg" "alt" "A Steam Deck" "caption" "The OLED model" }}.
+// The alt text defaults to the caption. An image that wasn't resized is shown
+// as it is
+func (s *Set) Figure(src string, args ...string) (template.HTML, error) {
+	if len(args)%2 != 0 {
+		return "", fmt.Errorf("figure: arguments after the image are key and value pairs, got %d of them", len(args))
+	}
+	alt, caption := "", ""
+	for i := 0; i < len(args); i += 2 {
+		switch args[i] {
+		case "alt":
+			alt = args[i+1]
+		case "caption":
+			caption = args[i+1]
+		default:
+			return "", fmt.Errorf("figure: unknown argument %s, which should be alt or caption", args[i])
+		}
+	}
+	if alt == "" {
+		alt = caption
+	}
+	b := strings.Builder{}
+	b.WriteString("<figure>")
+	b.WriteString(s.HTML(path.Join("/", src), alt, ""))
+	if caption != "" {
+		fmt.Fprintf(&b, "<figcaption>%s</figcaption>", html.EscapeString(caption))
+	}
+	b.WriteString("</figure>")
+	return template.HTML(b.String()), nil
+}
+
+// HTML returns the markup for the image with the URL, which is a picture of
+// its variants when it has them, or otherwise a plain img
+func (s *Set) HTML(url, alt, title string) string {
+	if img, ok := s.Lookup(url); ok && len(img.Variants) > 0 {
+		return img.HTML(alt, title)
+	}
+	b := strings.Builder{}
+	fmt.Fprintf(&b, `<img src="%s" alt="%s"`, html.EscapeString(url), html.EscapeString(alt))
+	if title != "" {
+		fmt.Fprintf(&b, ` title="%s"`, html.EscapeString(title))
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// HTML returns a picture with a source for the WebP variants and an img of the
+// variants in the image's own type, which browsers without WebP fall back to.
+// An image without WebP variants is just the img. The img has the size of the widest variant, so that the page's layout
+// doesn't shift as it loads
+func (img Image) HTML(alt, title string) string {
+	b := strings.Builder{}
+	webpSrcset := img.srcset("image/webp")
+	if webpSrcset != "" {
+		fmt.Fprintf(&b, `<picture><source type="image/webp" srcset="%s" sizes="%s">`, webpSrcset, html.EscapeString(img.sizes))
+	}
+	fallback := Variant{URL: img.URL, Width: img.Width, Height: img.Height}
+	for _, v := range img.Variants {
+		if v.Type == img.Type {
+			fallback = v
+		}
+	}
+	fmt.Fprintf(&b, `<img src="%s" srcset="%s" sizes="%s" width="%d" height="%d" alt="%s"`,
+		html.EscapeString(fallback.URL), img.srcset(img.Type), html.EscapeString(img.sizes), fallback.Width, fallback.Height, html.EscapeString(alt))
+	if title != "" {
+		fmt.Fprintf(&b, ` title="%s"`, html.EscapeString(title))
+	}
+	b.WriteString(` loading="lazy" decoding="async">`)
+	if webpSrcset != "" {
+		b.WriteString("</picture>")
+	}
+	return b.String()
+}
+
+// srcset lists the variants of the type t with their widths
+func (img Image) srcset(t string) string {
+	candidates := []string{}
+	for _, v := range img.Variants {
+		if v.Type == t {
+			candidates = append(candidates, fmt.Sprintf("%s %dw", html.EscapeString(v.URL), v.Width))
+		}
+	}
+	return strings.Join(candidates, ", ")
+}
@@ -0,0 +1,392 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krmckone/lk-site/internal/cache"
+	"github.com/krmckone/lk-site/internal/config"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/text"
+)
+
+// fakeCwebp writes a stand-in for cwebp that copies its input, a PNG, to its
+// output, so that the variants can be checked without libwebp installed
+func fakeCwebp(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cwebp")
+	script := `#!/bin/sh
+if [ "$1" = "-version" ]; then
+  echo "0.0.0-test"
+  exit 0
+fi
+while [ $# -gt 0 ]; do
+  case "$1" in
+    -o) out=$2; shift ;;
+    -q|-metadata) shift ;;
+    -*) ;;
+    *) in=$1 ;;
+  esac
+  shift
+done
+cp "$in" "$out"
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeTestImages writes a photo, an opaque screenshot, an empty file and a
+// document under the images directory of assetsPath
+func writeTestImages(t *testing.T, assetsPath string) {
+	t.Helper()
+	dir := filepath.Join(assetsPath, "images", "nested")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	photo := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	screenshot := image.NewNRGBA(image.Rect(0, 0, 30, 20))
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 100; x++ {
+			photo.Set(x, y, color.RGBA{uint8(x * 2), uint8(y * 5), 128, 255})
+			if x < 30 && y < 20 {
+				screenshot.Set(x, y, color.NRGBA{uint8(x * 8), 0, 0, 255})
+			}
+		}
+	}
+	b := bytes.Buffer{}
+	if err := jpeg.Encode(&b, photo, nil); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{"photo.jpg": b.Bytes(), "nested/empty.jpg": {}, "nested/resume.pdf": []byte("%PDF")}
+	b = bytes.Buffer{}
+	if err := png.Encode(&b, screenshot); err != nil {
+		t.Fatal(err)
+	}
+	files["nested/screenshot.png"] = b.Bytes()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(assetsPath, "images", name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	assetsPath, buildPath := t.TempDir(), t.TempDir()
+	writeTestImages(t, assetsPath)
+	set, err := Process(assetsPath, buildPath, config.ImagesConfig{Widths: []int{40, 80, 200}, Sizes: "50vw", Cwebp: fakeCwebp(t)}, 2, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error from Process: %s", err)
+	}
+	expected := map[string]Image{
+		"/images/photo.jpg": {
+			URL: "/images/photo.jpg", Type: "image/jpeg", Width: 100, Height: 50, sizes: "50vw",
+			Variants: []Variant{
+				{URL: "/images/photo-40w.jpg", Type: "image/jpeg", Width: 40, Height: 20},
+				{URL: "/images/photo-40w.webp", Type: "image/webp", Width: 40, Height: 20},
+				{URL: "/images/photo-80w.jpg", Type: "image/jpeg", Width: 80, Height: 40},
+				{URL: "/images/photo-80w.webp", Type: "image/webp", Width: 80, Height: 40},
+				{URL: "/images/photo-100w.jpg", Type: "image/jpeg", Width: 100, Height: 50},
+				{URL: "/images/photo-100w.webp", Type: "image/webp", Width: 100, Height: 50},
+			},
+		},
+		// Screenshots aren't converted to WebP, even when they're opaque
+		"/images/nested/screenshot.png": {
+			URL: "/images/nested/screenshot.png", Type: "image/png", Width: 30, Height: 20, sizes: "50vw",
+			Variants: []Variant{{URL: "/images/nested/screenshot-30w.png", Type: "image/png", Width: 30, Height: 20}},
+		},
+	}
+	if !reflect.DeepEqual(set.images, expected) {
+		t.Errorf("Expected: %+v, actual: %+v", expected, set.images)
+	}
+	for _, img := range set.images {
+		for _, v := range img.Variants {
+			f, err := os.Open(filepath.Join(buildPath, filepath.FromSlash(v.URL)))
+			if err != nil {
+				t.Fatalf("Expected the variant %s to be written: %s", v.URL, err)
+			}
+			// The fake cwebp writes the WebP variants as PNGs
+			cfg, _, err := image.DecodeConfig(f)
+			f.Close()
+			if err != nil {
+				t.Fatalf("Unexpected error decoding %s: %s", v.URL, err)
+			}
+			if cfg.Width != v.Width || cfg.Height != v.Height {
+				t.Errorf("Expected %s to be %dx%d, actual: %dx%d", v.URL, v.Width, v.Height, cfg.Width, cfg.Height)
+			}
+		}
+	}
+}
+
+func TestProcessWithoutCwebp(t *testing.T) {
+	assetsPath, buildPath := t.TempDir(), t.TempDir()
+	writeTestImages(t, assetsPath)
+	set, err := Process(assetsPath, buildPath, config.ImagesConfig{Widths: []int{40}, Cwebp: filepath.Join(t.TempDir(), "cwebp")}, 1, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error from Process: %s", err)
+	}
+	// Photos only get variants in their own type
+	img, _ := set.Lookup("/images/photo.jpg")
+	expected := []Variant{{URL: "/images/photo-40w.jpg", Type: "image/jpeg", Width: 40, Height: 20}}
+	if !reflect.DeepEqual(img.Variants, expected) {
+		t.Errorf("Expected: %+v, actual: %+v", expected, img.Variants)
+	}
+}
+
+func TestProcessMetadata(t *testing.T) {
+	assetsPath, buildPath := t.TempDir(), t.TempDir()
+	writeTestImages(t, assetsPath)
+	// The photo was taken sideways, with a camera and a date
+	original, err := os.ReadFile(filepath.Join(assetsPath, "images", "photo.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err = stripJPEG(original, encodeExif(testExif))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(assetsPath, "images", "photo.jpg"), original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	images := config.ImagesConfig{Widths: []int{40}, Metadata: map[string][]string{"*.jpg": {"camera"}}}
+	set, err := Process(assetsPath, buildPath, images, 1, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error from Process: %s", err)
+	}
+	img, err := set.Image("images/photo.jpg")
+	if err != nil {
+		t.Fatalf("Unexpected error from Image: %s", err)
+	}
+	if img.Width != 50 || img.Height != 100 || img.Metadata != (Metadata{Camera: testExif.Camera}) {
+		t.Errorf("Expected a 50x100 image with only its camera, actual: %+v", img)
+	}
+	if v := img.Variants[0]; v.Width != 40 || v.Height != 80 {
+		t.Errorf("Expected a 40x80 variant, actual: %+v", v)
+	}
+	b, err := os.ReadFile(filepath.Join(buildPath, "images", "photo.jpg"))
+	if err != nil {
+		t.Fatalf("Expected the image to be written: %s", err)
+	}
+	exif, err := readExif(b, "jpeg")
+	if err != nil {
+		t.Fatalf("Unexpected error from readExif: %s", err)
+	}
+	if m, _ := parseExif(exif); m.Camera != testExif.Camera || !m.DateTaken.IsZero() || m.orientation != 6 {
+		t.Errorf("Expected the camera and orientation to be kept, actual: %+v", m)
+	}
+
+	// Other files are written as they are
+	for _, name := range []string{"nested/empty.jpg", "nested/resume.pdf"} {
+		if _, err := os.Stat(filepath.Join(buildPath, "images", filepath.FromSlash(name))); err != nil {
+			t.Errorf("Expected %s to be written: %s", name, err)
+		}
+	}
+	if _, err := set.Image("images/nested/resume.pdf"); err == nil {
+		t.Errorf("Expected an error for a file that isn't an image")
+	}
+
+	// A truncated photo whose header still decodes is written as it is
+	truncated := original[:len(original)-10]
+	if err := os.WriteFile(filepath.Join(assetsPath, "images", "nested", "truncated.jpg"), truncated, 0644); err != nil {
+		t.Fatal(err)
+	}
+	set, err = Process(assetsPath, buildPath, images, 1, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error from Process: %s", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(buildPath, "images", "nested", "truncated.jpg")); err != nil || !bytes.Equal(b, truncated) {
+		t.Errorf("Expected the truncated photo to be written as it is: %v", err)
+	}
+	if _, ok := set.Lookup("/images/nested/truncated.jpg"); ok {
+		t.Errorf("Expected no variants of the truncated photo")
+	}
+
+	images.Metadata = map[string][]string{"*.jpg": {"location"}}
+	if _, err := Process(assetsPath, buildPath, images, 1, nil); err == nil {
+		t.Errorf("Expected an error for an unknown metadata field")
+	}
+}
+
+func TestProcessCached(t *testing.T) {
+	assetsPath, buildPath, cachePath := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTestImages(t, assetsPath)
+	images := config.ImagesConfig{Widths: []int{40}, Cwebp: fakeCwebp(t)}
+	build := func() {
+		t.Helper()
+		buildCache, err := cache.Open(cachePath, buildPath, "test", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Process(assetsPath, buildPath, images, 1, buildCache); err != nil {
+			t.Fatalf("Unexpected error from Process: %s", err)
+		}
+		if err := buildCache.RemoveStale(); err != nil {
+			t.Fatal(err)
+		}
+		if err := buildCache.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	build()
+	variant := filepath.Join(buildPath, "images", "photo-40w.webp")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(variant, old, old); err != nil {
+		t.Fatal(err)
+	}
+	build()
+	if info, err := os.Stat(variant); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("Expected %s to be kept from the previous build", variant)
+	}
+
+	// A variant stored in the cache is written again without being encoded
+	if err := os.RemoveAll(buildPath); err != nil {
+		t.Fatal(err)
+	}
+	build()
+	if _, err := os.Stat(variant); err != nil {
+		t.Errorf("Expected %s to be written from the cache: %s", variant, err)
+	}
+
+	// Variants at widths that are no longer configured are removed
+	images.Widths = []int{20}
+	build()
+	if _, err := os.Stat(variant); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, actual: %v", variant, err)
+	}
+}
+
+func TestVariantWidths(t *testing.T) {
+	cases := []struct {
+		width    int
+		widths   []int
+		expected []int
+	}{
+		{2000, []int{480, 960, 1440}, []int{480, 960, 1440}},
+		{1000, []int{1440, 480, 960}, []int{480, 960, 1000}},
+		{960, []int{480, 960, 1440}, []int{480, 960}},
+		{300, []int{480, 960}, []int{300}},
+		{2000, []int{480, 480}, []int{480}},
+	}
+	for _, c := range cases {
+		if actual := variantWidths(c.width, c.widths); !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("Expected widths of %d from %v: %v, actual: %v", c.width, c.widths, c.expected, actual)
+		}
+	}
+}
+
+// testSet has a JPEG and a PNG with two variants
+func testSet() *Set {
+	return &Set{images: map[string]Image{
+		"/images/c.png": {
+			URL: "/images/c.png", Type: "image/png", Width: 1200, Height: 600, sizes: "100vw",
+			Variants: []Variant{
+				{URL: "/images/c-480w.png", Type: "image/png", Width: 480, Height: 240},
+				{URL: "/images/c-960w.png", Type: "image/png", Width: 960, Height: 480},
+			},
+		},
+		"/images/a.jpg": {
+			URL: "/images/a.jpg", Type: "image/jpeg", Width: 1200, Height: 800, sizes: "100vw",
+			Variants: []Variant{
+				{URL: "/images/a-480w.jpg", Type: "image/jpeg", Width: 480, Height: 320},
+				{URL: "/images/a-480w.webp", Type: "image/webp", Width: 480, Height: 320},
+				{URL: "/images/a-960w.jpg", Type: "image/jpeg", Width: 960, Height: 640},
+				{URL: "/images/a-960w.webp", Type: "image/webp", Width: 960, Height: 640},
+			},
+		},
+	}}
+}
+
+const testPicture = `<picture><source type="image/webp" srcset="/images/a-480w.webp 480w, /images/a-960w.webp 960w" sizes="100vw">` +
+	`<img src="/images/a-960w.jpg" srcset="/images/a-480w.jpg 480w, /images/a-960w.jpg 960w" sizes="100vw" width="960" height="640" alt="A &#34;photo&#34;"%s loading="lazy" decoding="async"></picture>`
+
+func TestFigure(t *testing.T) {
+	cases := []struct {
+		src      string
+		args     []string
+		expected string
+	}{
+		{
+			"images/a.jpg",
+			[]string{"alt", `A "photo"`},
+			"<figure>" + strings.Replace(testPicture, "%s", "", 1) + "</figure>",
+		},
+		{
+			"/images/a.jpg",
+			[]string{"caption", `A "photo"`},
+			"<figure>" + strings.Replace(testPicture, "%s", "", 1) + "<figcaption>A &#34;photo&#34;</figcaption></figure>",
+		},
+		{
+			"images/c.png",
+			[]string{"alt", "A screenshot"},
+			`<figure><img src="/images/c-960w.png" srcset="/images/c-480w.png 480w, /images/c-960w.png 960w" sizes="100vw" width="960" height="480" alt="A screenshot" loading="lazy" decoding="async"></figure>`,
+		},
+		{
+			"images/b.gif",
+			[]string{"alt", "Not resized"},
+			`<figure><img src="/images/b.gif" alt="Not resized"></figure>`,
+		},
+	}
+	for _, c := range cases {
+		actual, err := testSet().Figure(c.src, c.args...)
+		if err != nil {
+			t.Fatalf("Unexpected error from Figure: %s", err)
+		}
+		if string(actual) != c.expected {
+			t.Errorf("Expected: %s, actual: %s", c.expected, actual)
+		}
+	}
+	if _, err := testSet().Figure("images/a.jpg", "alt"); err == nil {
+		t.Errorf("Expected an error for an argument without a value")
+	}
+	if _, err := testSet().Figure("images/a.jpg", "width", "10"); err == nil {
+		t.Errorf("Expected an error for an unknown argument")
+	}
+}
+
+func TestPictures(t *testing.T) {
+	cases := []struct {
+		markdown string
+		pageURL  string
+		expected string
+	}{
+		{
+			`![A "photo"](../images/a.jpg "Title")`,
+			"/posts/a.html",
+			"<p>" + strings.Replace(testPicture, "%s", ` title="Title"`, 1) + "</p>\n",
+		},
+		{
+			`![A *"photo"*](/images/a.jpg)`,
+			"/index.html",
+			"<p>" + strings.Replace(testPicture, "%s", "", 1) + "</p>\n",
+		},
+		{
+			"![Not resized](images/b.png) ![Elsewhere](https://example.com/images/a.jpg)",
+			"/index.html",
+			`<p><img src="images/b.png" alt="Not resized"> <img src="https://example.com/images/a.jpg" alt="Elsewhere"></p>` + "\n",
+		},
+	}
+	gm := goldmark.New(goldmark.WithExtensions(Extension()))
+	for _, c := range cases {
+		source := []byte(c.markdown)
+		doc := gm.Parser().Parse(text.NewReader(source))
+		testSet().Pictures(doc, source, c.pageURL)
+		b := bytes.Buffer{}
+		if err := gm.Renderer().Render(&b, source, doc); err != nil {
+			t.Fatalf("Unexpected error from Render: %s", err)
+		}
+		if actual := b.String(); actual != c.expected {
+			t.Errorf("Expected: %s, actual: %s", c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The metadata fields that can be kept, by their name in the config
+const (
+	fieldDateTaken = "dateTaken"
+	fieldCamera    = "camera"
+)
+
+var metadataFields = []string{fieldDateTaken, fieldCamera}
+
+// Metadata is what an image's EXIF says about it, limited to the fields the
+// config keeps for it
+type Metadata struct {
+	DateTaken time.Time // When the photo was taken, in the camera's time zone when it says so
+	Camera    string    // The make and model, e.g. Apple iPhone 13 mini
+}
+
+// exifMetadata is the part of an image's EXIF that's understood here
+type exifMetadata struct {
+	Metadata
+	orientation int // How the image is rotated or flipped, from 1 to 8 where 1 is as stored
+}
+
+// The EXIF tags that are read and written
+const (
+	tagMake               = 0x010f
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagExifIFD            = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+)
+
+// The types of the values of EXIF tags
+const (
+	typeASCII = 2
+	typeShort = 3
+	typeLong  = 4
+)
+
+// exifDateLayout is how EXIF writes dates
+const exifDateLayout = "2006:01:02 15:04:05"
+
+// allowedFields returns the metadata fields the config keeps for the image at
+// name, a path under the images directory like steam_deck/oled.jpg. Every
+// pattern the name matches adds its fields
+func allowedFields(allow map[string][]string, name string) ([]string, error) {
+	fields := []string{}
+	for pattern, patternFields := range allow {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return nil, fmt.Errorf("images.metadata pattern %q: %s", pattern, err)
+		}
+		if !matched {
+			continue
+		}
+		for _, field := range patternFields {
+			if !slices.Contains(metadataFields, field) {
+				return nil, fmt.Errorf("images.metadata field %q for %q is unknown, it should be one of %s", field, pattern, strings.Join(metadataFields, ", "))
+			}
+			if !slices.Contains(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	slices.Sort(fields)
+	return fields, nil
+}
+
+// keep returns the metadata with only the fields that are allowed
+func (m exifMetadata) keep(fields []string) exifMetadata {
+	kept := exifMetadata{orientation: m.orientation}
+	if slices.Contains(fields, fieldDateTaken) {
+		kept.DateTaken = m.DateTaken
+	}
+	if slices.Contains(fields, fieldCamera) {
+		kept.Camera = m.Camera
+	}
+	return kept
+}
+
+// parseExif reads the fields that are understood from the TIFF structure that
+// EXIF is stored in. Fields that are missing or malformed are left empty
+func parseExif(b []byte) (exifMetadata, error) {
+	m := exifMetadata{orientation: 1}
+	if len(b) < 8 {
+		return m, errors.New("EXIF is too short")
+	}
+	var order binary.ByteOrder
+	switch string(b[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return m, errors.New("EXIF doesn't start with a TIFF header")
+	}
+	ifd0 := readIFD(b, order, order.Uint32(b[4:]))
+	make_, model := ifd0.ascii(tagMake), ifd0.ascii(tagModel)
+	if strings.HasPrefix(model, make_) {
+		make_ = ""
+	}
+	m.Camera = strings.TrimSpace(make_ + " " + model)
+	if orientation, ok := ifd0.short(tagOrientation); ok && orientation >= 1 && orientation <= 8 {
+		m.orientation = int(orientation)
+	}
+	if offset, ok := ifd0.long(tagExifIFD); ok {
+		exif := readIFD(b, order, offset)
+		date := exif.ascii(tagDateTimeOriginal)
+		if zone := exif.ascii(tagOffsetTimeOriginal); zone != "" {
+			if t, err := time.Parse(exifDateLayout+"-07:00", date+zone); err == nil {
+				m.DateTaken = t
+			}
+		}
+		if t, err := time.Parse(exifDateLayout, date); err == nil && m.DateTaken.IsZero() {
+			m.DateTaken = t
+		}
+	}
+	return m, nil
+}
+
+// ifd is the entries of an image file directory by their tag
+type ifd struct {
+	b       []byte
+	order   binary.ByteOrder
+	entries map[uint16][]byte // The 12 bytes of each entry
+}
+
+func readIFD(b []byte, order binary.ByteOrder, offset uint32) ifd {
+	d := ifd{b: b, order: order, entries: map[uint16][]byte{}}
+	if uint64(offset)+2 > uint64(len(b)) {
+		return d
+	}
+	n := int(order.Uint16(b[offset:]))
+	for i := 0; i < n; i++ {
+		start := int(offset) + 2 + 12*i
+		if start+12 > len(b) {
+			break
+		}
+		d.entries[order.Uint16(b[start:])] = b[start : start+12]
+	}
+	return d
+}
+
+// value returns the bytes of a tag's value, which are in the entry itself when
+// they fit in 4 bytes
+func (d ifd) value(tag uint16, typ uint16, size int) ([]byte, bool) {
+	entry, ok := d.entries[tag]
+	if !ok || d.order.Uint16(entry[2:]) != typ {
+		return nil, false
+	}
+	length := uint64(d.order.Uint32(entry[4:])) * uint64(size)
+	if length <= 4 {
+		return entry[8 : 8+length], true
+	}
+	offset := uint64(d.order.Uint32(entry[8:]))
+	if offset+length > uint64(len(d.b)) {
+		return nil, false
+	}
+	return d.b[offset : offset+length], true
+}
+
+func (d ifd) ascii(tag uint16) string {
+	v, _ := d.value(tag, typeASCII, 1)
+	return strings.TrimSpace(strings.TrimRight(string(v), "\x00"))
+}
+
+func (d ifd) short(tag uint16) (uint16, bool) {
+	v, ok := d.value(tag, typeShort, 2)
+	if !ok || len(v) < 2 {
+		return 0, false
+	}
+	return d.order.Uint16(v), true
+}
+
+func (d ifd) long(tag uint16) (uint32, bool) {
+	v, ok := d.value(tag, typeLong, 4)
+	if !ok || len(v) < 4 {
+		return 0, false
+	}
+	return d.order.Uint32(v), true
+}
+
+// encodeExif returns EXIF with just the metadata, or nil when there's nothing
+// to keep. The orientation is kept whenever it isn't 1, since the image would
+// look different without it
+func encodeExif(m exifMetadata) []byte {
+	ifd0, exif := []ifdEntry{}, []ifdEntry{}
+	if m.Camera != "" {
+		// The make and model are kept together in the model
+		ifd0 = append(ifd0, ifdEntry{tag: tagModel, typ: typeASCII, value: []byte(m.Camera + "\x00")})
+	}
+	if m.orientation > 1 {
+		ifd0 = append(ifd0, ifdEntry{tag: tagOrientation, typ: typeShort, value: binary.BigEndian.AppendUint16(nil, uint16(m.orientation))})
+	}
+	if !m.DateTaken.IsZero() {
+		exif = append(exif,
+			ifdEntry{tag: tagDateTimeOriginal, typ: typeASCII, value: []byte(m.DateTaken.Format(exifDateLayout) + "\x00")},
+			ifdEntry{tag: tagOffsetTimeOriginal, typ: typeASCII, value: []byte(m.DateTaken.Format("-07:00") + "\x00")},
+		)
+	}
+	if len(ifd0) == 0 && len(exif) == 0 {
+		return nil
+	}
+
+	// The Exif IFD follows IFD0, each with the values that don't fit in their
+	// entries after it
+	ifdSize := func(entries []ifdEntry) int {
+		size := 2 + 12*len(entries) + 4
+		for _, e := range entries {
+			if len(e.value) > 4 {
+				size += len(e.value)
+			}
+		}
+		return size
+	}
+	if len(exif) > 0 {
+		ifd0 = append(ifd0, ifdEntry{tag: tagExifIFD, typ: typeLong, value: make([]byte, 4)})
+		binary.BigEndian.PutUint32(ifd0[len(ifd0)-1].value, uint32(8+ifdSize(ifd0)))
+	}
+	b := bytes.NewBufferString("MM\x00*\x00\x00\x00\x08")
+	writeIFD(b, ifd0)
+	if len(exif) > 0 {
+		writeIFD(b, exif)
+	}
+	return b.Bytes()
+}
+
+// ifdEntry is a tag with a big endian value
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	value []byte
+}
+
+// writeIFD writes entries, which are in order of their tags, as the last image
+// file directory
+func writeIFD(b *bytes.Buffer, entries []ifdEntry) {
+	start := b.Len()
+	binary.Write(b, binary.BigEndian, uint16(len(entries)))
+	values := start + 2 + 12*len(entries) + 4
+	extra := []byte{}
+	for _, e := range entries {
+		count := len(e.value)
+		if e.typ == typeShort {
+			count /= 2
+		} else if e.typ == typeLong {
+			count /= 4
+		}
+		binary.Write(b, binary.BigEndian, e.tag)
+		binary.Write(b, binary.BigEndian, e.typ)
+		binary.Write(b, binary.BigEndian, uint32(count))
+		if len(e.value) > 4 {
+			binary.Write(b, binary.BigEndian, uint32(values+len(extra)))
+			extra = append(extra, e.value...)
+		} else {
+			b.Write(e.value)
+			b.Write(make([]byte, 4-len(e.value)))
+		}
+	}
+	binary.Write(b, binary.BigEndian, uint32(0)) // No next IFD
+	b.Write(extra)
+}
@@ -0,0 +1,183 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testExif is EXIF with every field that's understood
+var testExif = exifMetadata{
+	Metadata: Metadata{
+		DateTaken: time.Date(2024, 6, 3, 12, 59, 17, 0, time.FixedZone("", -4*60*60)),
+		Camera:    "Apple iPhone 12",
+	},
+	orientation: 6,
+}
+
+func TestExif(t *testing.T) {
+	cases := []exifMetadata{
+		testExif,
+		{Metadata: Metadata{Camera: "Canon EOS R6"}, orientation: 1},
+		{Metadata: Metadata{DateTaken: testExif.DateTaken}, orientation: 1},
+		{orientation: 8},
+	}
+	for _, c := range cases {
+		actual, err := parseExif(encodeExif(c))
+		if err != nil {
+			t.Fatalf("Unexpected error from parseExif: %s", err)
+		}
+		if !actual.DateTaken.Equal(c.DateTaken) || actual.DateTaken.Format(time.RFC3339) != c.DateTaken.Format(time.RFC3339) ||
+			actual.Camera != c.Camera || actual.orientation != c.orientation {
+			t.Errorf("Expected: %+v, actual: %+v", c, actual)
+		}
+	}
+	if exif := encodeExif(exifMetadata{orientation: 1}); exif != nil {
+		t.Errorf("Expected no EXIF without any fields, actual: %q", exif)
+	}
+	if _, err := parseExif([]byte("not EXIF")); err == nil {
+		t.Errorf("Expected an error for EXIF without a TIFF header")
+	}
+}
+
+func TestAllowedFields(t *testing.T) {
+	allow := map[string][]string{"steam_deck/*.jpg": {"camera"}, "*/oled.*": {"dateTaken", "camera"}}
+	cases := map[string][]string{
+		"steam_deck/oled.jpg": {"camera", "dateTaken"},
+		"steam_deck/lcd.jpg":  {"camera"},
+		"steam_deck/lcd.png":  {},
+		"oled.jpg":            {},
+	}
+	for name, expected := range cases {
+		actual, err := allowedFields(allow, name)
+		if err != nil {
+			t.Fatalf("Unexpected error from allowedFields: %s", err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected fields of %s: %v, actual: %v", name, expected, actual)
+		}
+	}
+	if _, err := allowedFields(map[string][]string{"*": {"gps"}}, "a.jpg"); err == nil {
+		t.Errorf("Expected an error for an unknown field")
+	}
+	if _, err := allowedFields(map[string][]string{"[": {"camera"}}, "a.jpg"); err == nil {
+		t.Errorf("Expected an error for a bad pattern")
+	}
+}
+
+// testImage is an opaque 8x4 image
+func testImage() image.Image {
+	m := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			m.Set(x, y, color.RGBA{uint8(x * 30), uint8(y * 60), 0, 255})
+		}
+	}
+	return m
+}
+
+func TestStripJPEG(t *testing.T) {
+	b := bytes.Buffer{}
+	if err := jpeg.Encode(&b, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	withExif, err := stripJPEG(b.Bytes(), encodeExif(testExif))
+	if err != nil {
+		t.Fatalf("Unexpected error from stripJPEG: %s", err)
+	}
+	// A comment, XMP and data after the end of the image are all dropped
+	jpg := join(withExif[:2], []byte("\xff\xfe\x00\x07hello"), []byte("\xff\xe1\x00\x0bhttp://ns"), withExif[2:], []byte("trailing"))
+
+	stripped, err := strip(jpg, "jpeg", encodeExif(testExif.keep(nil)))
+	if err != nil {
+		t.Fatalf("Unexpected error from strip: %s", err)
+	}
+	for _, unexpected := range []string{"hello", "http://ns", "trailing", "iPhone"} {
+		if bytes.Contains(stripped, []byte(unexpected)) {
+			t.Errorf("Expected %q to be stripped from %q", unexpected, stripped)
+		}
+	}
+	exif, err := readExif(stripped, "jpeg")
+	if err != nil {
+		t.Fatalf("Unexpected error from readExif: %s", err)
+	}
+	if m, _ := parseExif(exif); m.orientation != 6 || m.Camera != "" {
+		t.Errorf("Expected only the orientation to be kept, actual: %+v", m)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("Unexpected error decoding the stripped JPEG: %s", err)
+	}
+	if _, err := strip(jpg[:len(jpg)/2], "jpeg", nil); err == nil {
+		t.Errorf("Expected an error for a truncated JPEG")
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	b := bytes.Buffer{}
+	if err := png.Encode(&b, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	chunk := func(typ, data string) []byte {
+		c := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+		c = append(c, typ+data...)
+		return binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE([]byte(typ+data)))
+	}
+	// The header is 8 bytes of signature and 25 of IHDR
+	p := join(b.Bytes()[:33], chunk("tEXt", "Author\x00someone"), chunk("eXIf", string(encodeExif(testExif))), chunk("pHYs", "\x00\x00\x0b\x13\x00\x00\x0b\x13\x01"), b.Bytes()[33:])
+
+	stripped, err := strip(p, "png", encodeExif(testExif.keep([]string{fieldCamera})))
+	if err != nil {
+		t.Fatalf("Unexpected error from strip: %s", err)
+	}
+	chunks, err := pngChunks(stripped)
+	if err != nil {
+		t.Fatalf("Unexpected error from pngChunks: %s", err)
+	}
+	types := []string{}
+	for _, c := range chunks {
+		types = append(types, c.typ)
+	}
+	if expected := []string{"IHDR", "pHYs", "eXIf", "IDAT", "IEND"}; !reflect.DeepEqual(types, expected) {
+		t.Errorf("Expected: %v, actual: %v", expected, types)
+	}
+	exif, err := readExif(stripped, "png")
+	if err != nil {
+		t.Fatalf("Unexpected error from readExif: %s", err)
+	}
+	if m, _ := parseExif(exif); m.Camera != testExif.Camera || !m.DateTaken.IsZero() || m.orientation != 6 {
+		t.Errorf("Expected the camera and orientation to be kept, actual: %+v", m)
+	}
+	if _, err := png.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("Unexpected error decoding the stripped PNG: %s", err)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	m := testImage()
+	for orientation := 1; orientation <= 8; orientation++ {
+		oriented := orient(m, orientation)
+		w, h := 8, 4
+		if orientation >= 5 {
+			w, h = 4, 8
+		}
+		if oriented.Bounds().Dx() != w || oriented.Bounds().Dy() != h {
+			t.Errorf("Expected orientation %d to be %dx%d, actual: %v", orientation, w, h, oriented.Bounds())
+		}
+	}
+	// Turned clockwise, the bottom left corner is at the top left
+	if expected, actual := color.RGBAModel.Convert(m.At(0, 3)), orient(m, 6).At(0, 0); expected != actual {
+		t.Errorf("Expected: %v, actual: %v", expected, actual)
+	}
+}
+
+// join joins byte slices into a new one
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
@@ -0,0 +1,225 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"slices"
+)
+
+// exifHeader starts the APP1 segment of a JPEG that has its EXIF
+const exifHeader = "Exif\x00\x00"
+
+// readExif returns the EXIF of the image b of the format, or nil when it has
+// none
+func readExif(b []byte, format string) ([]byte, error) {
+	switch format {
+	case "jpeg":
+		segments, err := jpegSegments(b)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range segments {
+			if s.marker == 0xe1 && bytes.HasPrefix(s.payload(), []byte(exifHeader)) {
+				return s.payload()[len(exifHeader):], nil
+			}
+		}
+	case "png":
+		chunks, err := pngChunks(b)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range chunks {
+			if c.typ == "eXIf" {
+				// Some encoders put the JPEG header in front of it too
+				return bytes.TrimPrefix(c.data, []byte(exifHeader)), nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("can't read the metadata of %s", format)
+	}
+	return nil, nil
+}
+
+// strip returns the image b of the format without its metadata, and with
+// exif in place of its EXIF when that isn't nil. What's kept is what changes
+// how the image looks, like its color profile
+func strip(b []byte, format string, exif []byte) ([]byte, error) {
+	switch format {
+	case "jpeg":
+		return stripJPEG(b, exif)
+	case "png":
+		return stripPNG(b, exif)
+	}
+	return nil, fmt.Errorf("can't strip the metadata of %s", format)
+}
+
+// jpegSegment is a marker of a JPEG with what follows it, which for the start
+// of a scan includes the scan's data
+type jpegSegment struct {
+	marker byte
+	b      []byte
+}
+
+// payload returns what's in the segment after its marker and length
+func (s jpegSegment) payload() []byte {
+	if len(s.b) < 4 {
+		return nil
+	}
+	return s.b[4:]
+}
+
+// jpegSegments splits a JPEG into its segments up to the end of the image,
+// leaving out anything after that
+func jpegSegments(b []byte) ([]jpegSegment, error) {
+	if len(b) < 2 || b[0] != 0xff || b[1] != 0xd8 {
+		return nil, errors.New("JPEG doesn't start with a start of image marker")
+	}
+	segments := []jpegSegment{{marker: 0xd8, b: b[:2]}}
+	i := 2
+	for {
+		// Markers may be padded with any number of 0xff bytes
+		for i+1 < len(b) && b[i] == 0xff && b[i+1] == 0xff {
+			i++
+		}
+		if i+1 >= len(b) || b[i] != 0xff {
+			return nil, errors.New("JPEG ends before the end of image marker")
+		}
+		marker := b[i+1]
+		if marker == 0xd9 {
+			return append(segments, jpegSegment{marker: marker, b: b[i : i+2]}), nil
+		}
+		if marker == 0x01 || marker >= 0xd0 && marker <= 0xd7 {
+			segments = append(segments, jpegSegment{marker: marker, b: b[i : i+2]})
+			i += 2
+			continue
+		}
+		if i+4 > len(b) {
+			return nil, errors.New("JPEG ends in the middle of a segment")
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(b[i+2:]))
+		if end > len(b) || end < i+4 {
+			return nil, fmt.Errorf("JPEG segment %#x has a length past its end", marker)
+		}
+		if marker == 0xda {
+			// The scan's data runs until a marker other than a stuffed 0xff or a
+			// restart
+			for end+1 < len(b) && (b[end] != 0xff || b[end+1] == 0x00 || b[end+1] >= 0xd0 && b[end+1] <= 0xd7) {
+				end++
+			}
+		}
+		segments = append(segments, jpegSegment{marker: marker, b: b[i:end]})
+		i = end
+	}
+}
+
+// jpegKept are the headers of the application segments of a JPEG that are
+// kept, by their marker
+var jpegKept = map[byte][]string{
+	0xe0: {"JFIF\x00", "JFXX\x00"}, // JFIF, which says how the colors are stored
+	0xe2: {"ICC_PROFILE\x00"},      // Color profile
+	0xee: {"Adobe"},                // Adobe, which also says how the colors are stored
+}
+
+func stripJPEG(b, exif []byte) ([]byte, error) {
+	segments, err := jpegSegments(b)
+	if err != nil {
+		return nil, err
+	}
+	kept := []jpegSegment{}
+	for _, s := range segments {
+		if s.marker == 0xfe || s.marker >= 0xe0 && s.marker <= 0xef && !slices.ContainsFunc(jpegKept[s.marker], func(header string) bool {
+			return bytes.HasPrefix(s.payload(), []byte(header))
+		}) {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	// The EXIF goes after the JFIF segment, which has to come first
+	at := 1
+	if len(kept) > 1 && kept[1].marker == 0xe0 {
+		at = 2
+	}
+	stripped := bytes.Buffer{}
+	for i, s := range kept {
+		if i == at && exif != nil {
+			if len(exif)+len(exifHeader)+2 > 0xffff {
+				return nil, errors.New("EXIF is too long for a JPEG segment")
+			}
+			stripped.Write([]byte{0xff, 0xe1})
+			binary.Write(&stripped, binary.BigEndian, uint16(len(exif)+len(exifHeader)+2))
+			stripped.WriteString(exifHeader)
+			stripped.Write(exif)
+		}
+		stripped.Write(s.b)
+	}
+	return stripped.Bytes(), nil
+}
+
+// pngSignature starts every PNG
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// pngChunk is a chunk of a PNG with its length, type, data and CRC in b
+type pngChunk struct {
+	typ  string
+	data []byte
+	b    []byte
+}
+
+// pngChunks splits a PNG into its chunks up to the end of the image, leaving
+// out anything after that
+func pngChunks(b []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(b, []byte(pngSignature)) {
+		return nil, errors.New("PNG doesn't start with the PNG signature")
+	}
+	chunks := []pngChunk{}
+	for i := len(pngSignature); ; {
+		if i+12 > len(b) {
+			return nil, errors.New("PNG ends before the IEND chunk")
+		}
+		length := uint64(binary.BigEndian.Uint32(b[i:]))
+		if uint64(i)+12+length > uint64(len(b)) {
+			return nil, errors.New("PNG chunk has a length past its end")
+		}
+		end := i + 12 + int(length)
+		c := pngChunk{typ: string(b[i+4 : i+8]), data: b[i+8 : end-4], b: b[i:end]}
+		chunks = append(chunks, c)
+		if c.typ == "IEND" {
+			return chunks, nil
+		}
+		i = end
+	}
+}
+
+// pngKept are the ancillary chunks of a PNG that are kept, along with every
+// critical one
+var pngKept = []string{
+	"tRNS", "cHRM", "gAMA", "iCCP", "sBIT", "sRGB", "cICP", "mDCV", "cLLI", "bKGD", "hIST", "pHYs", "sPLT",
+	"acTL", "fcTL", "fdAT", // Animation
+}
+
+func stripPNG(b, exif []byte) ([]byte, error) {
+	chunks, err := pngChunks(b)
+	if err != nil {
+		return nil, err
+	}
+	stripped := bytes.NewBufferString(pngSignature)
+	for _, c := range chunks {
+		// Ancillary chunks start with a lowercase letter
+		if c.typ[0]&0x20 != 0 && !slices.Contains(pngKept, c.typ) {
+			continue
+		}
+		// The EXIF goes before the image data
+		if c.typ == "IDAT" && exif != nil {
+			binary.Write(stripped, binary.BigEndian, uint32(len(exif)))
+			data := append([]byte("eXIf"), exif...)
+			stripped.Write(data)
+			binary.Write(stripped, binary.BigEndian, crc32.ChecksumIEEE(data))
+			exif = nil
+		}
+		stripped.Write(c.b)
+	}
+	return stripped.Bytes(), nil
+}
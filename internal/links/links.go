@@ -0,0 +1,100 @@
+package links
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// linkPattern matches the URL in href and src attributes. Good enough for the
+// HTML we generate, which always quotes attribute values
+var linkPattern = regexp.MustCompile(`(?i)\s(?:href|src)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// Broken is a link in a built page that doesn't resolve to a file in the build
+type Broken struct {
+	Page string // Page containing the link, relative to the build directory
+	Link string
+}
+
+func (b Broken) String() string {
+	return fmt.Sprintf("%s: broken link %s", b.Page, b.Link)
+}
+
+// Check finds every site relative link in the HTML files under buildPath that
+// doesn't resolve to a file in buildPath. Links with a scheme, such as https:
+// or mailto:, and links to a fragment of the same page aren't checked
+func Check(buildPath string) ([]Broken, error) {
+	broken := []Broken{}
+	err := filepath.WalkDir(buildPath, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(file) != ".html" {
+			return nil
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(buildPath, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, match := range linkPattern.FindAllSubmatch(b, -1) {
+			link := string(match[1]) + string(match[2])
+			target, ok := resolve(rel, link)
+			if !ok {
+				continue
+			}
+			if !exists(buildPath, target) {
+				broken = append(broken, Broken{Page: rel, Link: link})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error checking links in %s: %s", buildPath, err)
+	}
+	slices.SortStableFunc(broken, func(a, b Broken) int {
+		return strings.Compare(a.Page, b.Page)
+	})
+	return broken, nil
+}
+
+// resolve returns the path of the file link points to relative to the build
+// directory, and false when link isn't a site relative link
+func resolve(page, link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	target := u.Path
+	if !strings.HasPrefix(target, "/") {
+		target = path.Join(path.Dir("/"+page), target)
+	}
+	if strings.HasSuffix(u.Path, "/") {
+		target = path.Join(target, "index.html")
+	}
+	return strings.TrimPrefix(path.Clean(target), "/"), true
+}
+
+// exists reports whether target is a file in buildPath, or a directory with
+// an index page
+func exists(buildPath, target string) bool {
+	info, err := os.Stat(filepath.Join(buildPath, filepath.FromSlash(target)))
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		_, err := os.Stat(filepath.Join(buildPath, filepath.FromSlash(target), "index.html"))
+		return err == nil
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package links
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("Unexpected error from MkdirAll: %s", err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error from WriteFile: %s", err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.html": `<html><head><link href="/css/styles.css" rel="stylesheet"></head><body>
+<a href="posts/post.html">Post</a>
+<a href="/posts/">Posts</a>
+<a href="https://example.com/missing.html">External</a>
+<a href="mailto:someone@example.com">Mail</a>
+<a href="#top">Top</a>
+<a href='/missing.html?q=1#section'>Missing</a>
+</body></html>`,
+		"css/styles.css":   "",
+		"posts/index.html": `<a href="/images/">Images</a>`,
+		"posts/post.html": `<script src="../js/post.js"></script>
+<img src="images/photo.jpg">
+<a href="../index.html#top">Home</a>`,
+		"js/post.js": "",
+	})
+	os.MkdirAll(filepath.Join(dir, "images"), 0755)
+
+	expected := []Broken{
+		{Page: "index.html", Link: "/missing.html?q=1#section"},
+		{Page: "posts/index.html", Link: "/images/"},
+		{Page: "posts/post.html", Link: "images/photo.jpg"},
+	}
+	actual, err := Check(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error from Check: %s", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestCheckMissingBuild(t *testing.T) {
+	if _, err := Check(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("Expected an error checking a missing build directory")
+	}
+}
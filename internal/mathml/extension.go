@@ -0,0 +1,254 @@
+package mathml
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindInlineMath is the kind of InlineMath nodes
+var KindInlineMath = ast.NewNodeKind("InlineMath")
+
+// InlineMath is $...$ in a paragraph, or $$...$$ which is displayed on a line of
+// its own
+type InlineMath struct {
+	ast.BaseInline
+	Display  bool
+	Segments []text.Segment // The LaTeX between the dollar signs, one segment per line
+}
+
+func (n *InlineMath) Kind() ast.NodeKind {
+	return KindInlineMath
+}
+
+func (n *InlineMath) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Display": strconv.FormatBool(n.Display)}, nil)
+}
+
+// KindMathBlock is the kind of MathBlock nodes
+var KindMathBlock = ast.NewNodeKind("MathBlock")
+
+// MathBlock is displayed math on the lines between $$ and $$, or on one line
+// between them
+type MathBlock struct {
+	ast.BaseBlock
+	opener int  // Offset of the opening $$ in the source
+	closed bool // Whether the closing $$ was found
+}
+
+func (n *MathBlock) Kind() ast.NodeKind {
+	return KindMathBlock
+}
+
+func (n *MathBlock) IsRaw() bool {
+	return true
+}
+
+func (n *MathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// Extension parses math in $...$ and $$...$$ and renders it to MathML when the
+// markdown is converted, so pages don't need a script to typeset it. Invalid
+// math fails the conversion with an Error at its line and column in the
+// markdown
+func Extension() goldmark.Extender {
+	return extension{}
+}
+
+type extension struct{}
+
+func (e extension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(blockParser{}, 650)),
+		parser.WithInlineParsers(util.Prioritized(inlineParser{}, 150)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(nodeRenderer{}, 500)))
+}
+
+type blockParser struct{}
+
+func (b blockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (b blockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	node := &MathBlock{opener: segment.Start + pos}
+	start := segment.Start + pos + 2
+	rest := line[pos+2:]
+	if end := bytes.Index(rest, []byte("$$")); end >= 0 {
+		// Math on one line is only a block when nothing follows it, otherwise
+		// it's inline in a paragraph
+		if !util.IsBlank(rest[end+2:]) {
+			return nil, parser.NoChildren
+		}
+		node.Lines().Append(text.NewSegment(start, start+end))
+		node.closed = true
+	} else if !util.IsBlank(rest) {
+		node.Lines().Append(text.NewSegment(start, segment.Stop))
+	}
+	reader.Advance(segment.Len() - 1)
+	return node, parser.NoChildren
+}
+
+func (b blockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	n := node.(*MathBlock)
+	if n.closed {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	trimmed := util.TrimRightSpace(line)
+	if bytes.HasSuffix(trimmed, []byte("$$")) {
+		if end := len(trimmed) - 2; !util.IsBlank(trimmed[:end]) {
+			n.Lines().Append(text.NewSegment(segment.Start, segment.Start+end))
+		}
+		n.closed = true
+		reader.Advance(segment.Len() - 1)
+		return parser.Close
+	}
+	n.Lines().Append(segment)
+	reader.Advance(segment.Len() - 1)
+	return parser.Continue | parser.NoChildren
+}
+
+func (b blockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (b blockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (b blockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+type inlineParser struct{}
+
+func (s inlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Parse follows the rules of pandoc for inline math: the opening $ is followed by
+// a character other than a space, and the closing $ comes right after one and
+// isn't followed by a digit. That keeps prices like $5 and $10 as they are
+func (s inlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	opener := 1
+	if len(line) > 1 && line[1] == '$' {
+		opener = 2
+	}
+	if len(line) <= opener || util.IsSpace(line[opener]) || inAction(block.Source(), segment.Start) {
+		return nil
+	}
+	l, pos := block.Position()
+	block.Advance(opener)
+	node := &InlineMath{Display: opener == 2}
+	for {
+		line, segment := block.PeekLine()
+		if line == nil {
+			block.SetPosition(l, pos)
+			return nil
+		}
+		for i := 0; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '$':
+				if closes(line, i, opener) {
+					node.Segments = append(node.Segments, segment.WithStop(segment.Start+i))
+					block.Advance(i + opener)
+					return node
+				}
+			}
+		}
+		node.Segments = append(node.Segments, segment)
+		block.AdvanceLine()
+	}
+}
+
+// closes returns whether the $ at i in line closes math opened by as many
+func closes(line []byte, i int, opener int) bool {
+	if opener == 2 {
+		return i+1 < len(line) && line[i+1] == '$'
+	}
+	return i > 0 && !util.IsSpace(line[i-1]) && (i+1 == len(line) || line[i+1] < '0' || line[i+1] > '9')
+}
+
+// inAction returns whether the offset in source is inside a template action on
+// its line, where $ starts a variable rather than math
+func inAction(source []byte, offset int) bool {
+	lineStart := bytes.LastIndexByte(source[:offset], '\n') + 1
+	before := source[lineStart:offset]
+	return bytes.LastIndex(before, []byte("{{")) > bytes.LastIndex(before, []byte("}}"))
+}
+
+type nodeRenderer struct{}
+
+func (r nodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindInlineMath, r.renderInlineMath)
+	reg.Register(KindMathBlock, r.renderMathBlock)
+}
+
+func (r nodeRenderer) renderInlineMath(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*InlineMath)
+	if err := render(w, source, n.Segments, n.Display); err != nil {
+		return ast.WalkStop, err
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r nodeRenderer) renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*MathBlock)
+	if !n.closed {
+		line, column := position(source, n.opener)
+		return ast.WalkStop, Error{Line: line, Column: column, Err: errors.New("$$ is never closed")}
+	}
+	if err := render(w, source, n.Lines().Sliced(0, n.Lines().Len()), true); err != nil {
+		return ast.WalkStop, err
+	}
+	w.WriteString("\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// render writes the MathML for the LaTeX in segments of source. An error in the
+// LaTeX is moved to its line and column in source
+func render(w util.BufWriter, source []byte, segments []text.Segment, display bool) error {
+	tex := bytes.Buffer{}
+	for _, segment := range segments {
+		tex.Write(segment.Value(source))
+	}
+	markup, err := Convert(tex.String(), display)
+	mathErr := Error{}
+	if errors.As(err, &mathErr) {
+		offset := mathErr.offset
+		for _, segment := range segments {
+			if offset <= segment.Len() {
+				mathErr.Line, mathErr.Column = position(source, segment.Start+offset)
+				return mathErr
+			}
+			offset -= segment.Len()
+		}
+		return mathErr
+	} else if err != nil {
+		return err
+	}
+	w.WriteString(markup)
+	return nil
+}
@@ -0,0 +1,575 @@
+package mathml
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Error is invalid math at a line and column of the source it's in, both
+// counting from 1
+type Error struct {
+	Line   int
+	Column int
+	Err    error
+	offset int // Byte offset of the error in the LaTeX
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("invalid math at line %d, column %d: %s", e.Line, e.Column, e.Err)
+}
+
+// Convert returns the MathML for the LaTeX math in tex, displayed as a block
+// when display is set. It covers the math mode of LaTeX that's used for linear
+// algebra and graphics: scripts, fractions, roots, Greek letters and symbols,
+// fonts, accents, delimiters and matrices. Anything else is an Error at its
+// line and column in tex
+func Convert(tex string, display bool) (string, error) {
+	p := &converter{tex: tex, display: display}
+	items, err := p.row("")
+	if err == nil {
+		if t := p.peek(); t.kind != eof {
+			err = p.errorf(t.pos, "unexpected %s", t)
+		}
+	}
+	if err != nil {
+		mathErr := Error{}
+		if errors.As(err, &mathErr) {
+			mathErr.Line, mathErr.Column = position([]byte(tex), mathErr.offset)
+			return "", mathErr
+		}
+		return "", err
+	}
+	if display {
+		return fmt.Sprintf(`<math display="block">%s</math>`, mrow(items)), nil
+	}
+	return fmt.Sprintf("<math>%s</math>", mrow(items)), nil
+}
+
+// position returns the line and column of the byte offset in source
+func position(source []byte, offset int) (int, int) {
+	offset = min(offset, len(source))
+	line := 1 + strings.Count(string(source[:offset]), "\n")
+	lineStart := strings.LastIndexByte(string(source[:offset]), '\n') + 1
+	return line, 1 + utf8.RuneCount(source[lineStart:offset])
+}
+
+type tokenKind int
+
+const (
+	eof tokenKind = iota
+	char
+	command
+)
+
+type token struct {
+	kind  tokenKind
+	value string // The character, or the name of the command without its backslash
+	pos   int
+	end   int
+}
+
+func (t token) is(c string) bool {
+	return t.kind == char && t.value == c
+}
+
+func (t token) isCommand(name string) bool {
+	return t.kind == command && t.value == name
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case eof:
+		return "end of math"
+	case command:
+		return `\` + t.value
+	}
+	return t.value
+}
+
+type converter struct {
+	tex     string
+	pos     int
+	display bool
+	font    string // The font of \mathbf, \mathbb and the like while their argument is parsed
+}
+
+func (p *converter) errorf(pos int, format string, args ...interface{}) error {
+	return Error{Err: fmt.Errorf(format, args...), offset: pos}
+}
+
+// peek returns the next token, skipping whitespace which math mode ignores
+func (p *converter) peek() token {
+	pos := p.pos
+	for pos < len(p.tex) && strings.IndexByte(" \t\r\n", p.tex[pos]) >= 0 {
+		pos++
+	}
+	if pos == len(p.tex) {
+		return token{kind: eof, pos: pos, end: pos}
+	}
+	if p.tex[pos] == '\\' {
+		end := pos + 1
+		for end < len(p.tex) && isASCIILetter(p.tex[end]) {
+			end++
+		}
+		if end == pos+1 && end < len(p.tex) {
+			// Commands that aren't letters are a single character, like \, or \{
+			_, size := utf8.DecodeRuneInString(p.tex[end:])
+			end += size
+		}
+		return token{kind: command, value: p.tex[pos+1 : end], pos: pos, end: end}
+	}
+	_, size := utf8.DecodeRuneInString(p.tex[pos:])
+	return token{kind: char, value: p.tex[pos : pos+size], pos: pos, end: pos + size}
+}
+
+func (p *converter) next() token {
+	t := p.peek()
+	p.pos = t.end
+	return t
+}
+
+// ends returns whether t ends the current row, which is where a group, a cell
+// of a matrix or the contents of \left and \right finish
+func ends(t token, closer string) bool {
+	switch {
+	case t.kind == eof:
+		return true
+	case t.kind == char:
+		return t.value == "}" || t.value == "&" || t.value == closer
+	}
+	return t.value == `\` || t.value == "right" || t.value == "end"
+}
+
+// row parses terms up to the end of the row, or the closer character such as
+// the ] of an optional argument
+func (p *converter) row(closer string) ([]string, error) {
+	items := []string{}
+	for {
+		t := p.peek()
+		if ends(t, closer) {
+			return items, nil
+		}
+		if t.isCommand("displaystyle") || t.isCommand("textstyle") {
+			// Styles apply to the rest of the row they're in
+			p.next()
+			display := p.display
+			p.display = t.value == "displaystyle"
+			rest, err := p.row(closer)
+			p.display = display
+			if err != nil {
+				return nil, err
+			}
+			return append(items, fmt.Sprintf(`<mstyle displaystyle="%t">%s</mstyle>`, t.value == "displaystyle", mrow(rest))), nil
+		}
+		item, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+// group parses the row inside braces, after the opening brace
+func (p *converter) group(open token) (string, error) {
+	items, err := p.row("")
+	if err != nil {
+		return "", err
+	}
+	if t := p.next(); !t.is("}") {
+		if t.kind == eof {
+			return "", p.errorf(open.pos, "{ is never closed")
+		}
+		return "", p.errorf(t.pos, "unexpected %s", t)
+	}
+	return mrow(items), nil
+}
+
+// argument parses the argument of a command or a script, which is a group in
+// braces or otherwise a single token
+func (p *converter) argument(of token) (string, error) {
+	t := p.peek()
+	if ends(t, "") {
+		return "", p.errorf(t.pos, "missing argument for %s", of)
+	}
+	a, err := p.atom(true)
+	return a.markup, err
+}
+
+// rawArgument returns the text inside the braces after a command like \text
+func (p *converter) rawArgument(of token) (string, error) {
+	t := p.next()
+	if !t.is("{") {
+		return "", p.errorf(t.pos, "missing argument for %s", of)
+	}
+	depth := 1
+	for i := p.pos; i < len(p.tex); i++ {
+		switch p.tex[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				raw := p.tex[p.pos:i]
+				p.pos = i + 1
+				return raw, nil
+			}
+		}
+	}
+	return "", p.errorf(t.pos, "{ is never closed")
+}
+
+type atom struct {
+	markup string
+	limits bool // Whether scripts go under and over it when displayed, like the limits of \sum
+}
+
+// term parses an atom and its subscript, superscript and primes
+func (p *converter) term() (string, error) {
+	base := atom{markup: "<mrow></mrow>"}
+	if t := p.peek(); !t.is("^") && !t.is("_") && !t.is("'") {
+		var err error
+		if base, err = p.atom(false); err != nil {
+			return "", err
+		}
+	}
+	var sub, sup, primes string
+	for {
+		t := p.peek()
+		switch {
+		case t.is("^") || t.is("_"):
+			p.next()
+			script, err := p.argument(t)
+			if err != nil {
+				return "", err
+			}
+			if t.is("^") {
+				if sup != "" {
+					return "", p.errorf(t.pos, "double superscript")
+				}
+				sup = script
+			} else {
+				if sub != "" {
+					return "", p.errorf(t.pos, "double subscript")
+				}
+				sub = script
+			}
+		case t.is("'"):
+			p.next()
+			primes += "′"
+		case t.isCommand("limits") || t.isCommand("nolimits"):
+			p.next()
+			base.limits = t.value == "limits"
+		default:
+			if primes != "" && sup != "" {
+				sup = fmt.Sprintf("<mrow>%s%s</mrow>", mo(primes), sup)
+			} else if primes != "" {
+				sup = mo(primes)
+			}
+			return scripts(base, sub, sup, base.limits && p.display), nil
+		}
+	}
+}
+
+func scripts(base atom, sub, sup string, under bool) string {
+	switch {
+	case sub != "" && sup != "" && under:
+		return fmt.Sprintf("<munderover>%s%s%s</munderover>", base.markup, sub, sup)
+	case sub != "" && sup != "":
+		return fmt.Sprintf("<msubsup>%s%s%s</msubsup>", base.markup, sub, sup)
+	case sub != "" && under:
+		return fmt.Sprintf("<munder>%s%s</munder>", base.markup, sub)
+	case sub != "":
+		return fmt.Sprintf("<msub>%s%s</msub>", base.markup, sub)
+	case sup != "" && under:
+		return fmt.Sprintf("<mover>%s%s</mover>", base.markup, sup)
+	case sup != "":
+		return fmt.Sprintf("<msup>%s%s</msup>", base.markup, sup)
+	}
+	return base.markup
+}
+
+// atom parses a single letter, number, symbol, group or command with its
+// arguments. A single atom is one digit rather than a whole number, as in x^23
+func (p *converter) atom(single bool) (atom, error) {
+	t := p.next()
+	switch t.kind {
+	case eof:
+		return atom{}, p.errorf(t.pos, "unexpected end of math")
+	case command:
+		return p.command(t)
+	}
+	r, _ := utf8.DecodeRuneInString(t.value)
+	switch {
+	case t.value == "{":
+		markup, err := p.group(t)
+		return atom{markup: markup}, err
+	case t.value == "}" || t.value == "&" || t.value == "^" || t.value == "_":
+		return atom{}, p.errorf(t.pos, "unexpected %s", t)
+	case unicode.IsDigit(r) || (t.value == "." && !single && p.pos < len(p.tex) && isDigit(p.tex[p.pos])):
+		number := t.value
+		for !single && p.pos < len(p.tex) {
+			if c := p.tex[p.pos]; isDigit(c) || (c == '.' && p.pos+1 < len(p.tex) && isDigit(p.tex[p.pos+1])) {
+				number += string(c)
+				p.pos++
+			} else {
+				break
+			}
+		}
+		return atom{markup: p.number(number)}, nil
+	case unicode.IsLetter(r):
+		return atom{markup: p.identifier(r)}, nil
+	case t.value == "~":
+		return atom{markup: `<mspace width="0.333em"></mspace>`}, nil
+	}
+	if op, ok := operators[t.value]; ok {
+		return atom{markup: op}, nil
+	}
+	return atom{markup: mo(t.value)}, nil
+}
+
+// command parses the command t and its arguments
+func (p *converter) command(t token) (atom, error) {
+	if markup, ok := symbols[t.value]; ok {
+		return atom{markup: markup}, nil
+	}
+	if op, ok := largeOperators[t.value]; ok {
+		return atom{markup: mo(op), limits: !strings.HasSuffix(t.value, "int")}, nil
+	}
+	if limits, ok := functions[t.value]; ok {
+		return atom{markup: mi(t.value), limits: limits}, nil
+	}
+	if width, ok := spaces[t.value]; ok {
+		return atom{markup: fmt.Sprintf(`<mspace width="%s"></mspace>`, width)}, nil
+	}
+	if accent, ok := accents[t.value]; ok {
+		arg, err := p.argument(t)
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{markup: accent(arg)}, nil
+	}
+	if font, ok := fonts[t.value]; ok {
+		outer := p.font
+		p.font = font
+		arg, err := p.argument(t)
+		p.font = outer
+		return atom{markup: arg}, err
+	}
+	if size, ok := delimiterSizes[strings.TrimRight(t.value, "lmr")]; ok {
+		delim, err := p.delimiter(t)
+		if err != nil || delim == "" {
+			return atom{}, err
+		}
+		return atom{markup: fmt.Sprintf(`<mo minsize="%s" maxsize="%s">%s</mo>`, size, size, delim)}, nil
+	}
+	switch t.value {
+	case "frac", "dfrac", "tfrac", "binom":
+		num, err := p.argument(t)
+		if err != nil {
+			return atom{}, err
+		}
+		den, err := p.argument(t)
+		if err != nil {
+			return atom{}, err
+		}
+		if t.value == "binom" {
+			return atom{markup: fmt.Sprintf(`<mrow><mo>(</mo><mfrac linethickness="0">%s%s</mfrac><mo>)</mo></mrow>`, num, den)}, nil
+		}
+		return atom{markup: fmt.Sprintf("<mfrac>%s%s</mfrac>", num, den)}, nil
+	case "sqrt":
+		if open := p.peek(); open.is("[") {
+			p.next()
+			index, err := p.row("]")
+			if err != nil {
+				return atom{}, err
+			}
+			if t := p.next(); !t.is("]") {
+				return atom{}, p.errorf(open.pos, "[ is never closed")
+			}
+			arg, err := p.argument(t)
+			if err != nil {
+				return atom{}, err
+			}
+			return atom{markup: fmt.Sprintf("<mroot>%s%s</mroot>", arg, mrow(index))}, nil
+		}
+		arg, err := p.argument(t)
+		return atom{markup: fmt.Sprintf("<msqrt>%s</msqrt>", arg)}, err
+	case "text", "textrm", "mbox":
+		text, err := p.rawArgument(t)
+		return atom{markup: fmt.Sprintf("<mtext>%s</mtext>", html.EscapeString(text))}, err
+	case "operatorname":
+		name, err := p.rawArgument(t)
+		return atom{markup: mi(name)}, err
+	case "left":
+		return p.fenced(t)
+	case "begin":
+		return p.environment(t)
+	}
+	return atom{}, p.errorf(t.pos, "unknown command %s", t)
+}
+
+// delimiter parses the delimiter after a command like \left, which is empty
+// for the . that leaves out a side
+func (p *converter) delimiter(of token) (string, error) {
+	t := p.next()
+	if t.is(".") {
+		return "", nil
+	}
+	if d, ok := delimiters[t.String()]; ok {
+		return d, nil
+	}
+	return "", p.errorf(t.pos, "missing delimiter for %s", of)
+}
+
+// fenced parses the math between \left and \right, which sizes its delimiters
+// to fit
+func (p *converter) fenced(left token) (atom, error) {
+	open, err := p.delimiter(left)
+	if err != nil {
+		return atom{}, err
+	}
+	items, err := p.row("")
+	if err != nil {
+		return atom{}, err
+	}
+	right := p.next()
+	if !right.isCommand("right") {
+		if right.kind == eof {
+			return atom{}, p.errorf(left.pos, `\left is never closed by \right`)
+		}
+		return atom{}, p.errorf(right.pos, "unexpected %s", right)
+	}
+	close, err := p.delimiter(right)
+	if err != nil {
+		return atom{}, err
+	}
+	row := []string{}
+	if open != "" {
+		row = append(row, fmt.Sprintf(`<mo fence="true" form="prefix">%s</mo>`, open))
+	}
+	row = append(row, items...)
+	if close != "" {
+		row = append(row, fmt.Sprintf(`<mo fence="true" form="postfix">%s</mo>`, close))
+	}
+	return atom{markup: fmt.Sprintf("<mrow>%s</mrow>", strings.Join(row, ""))}, nil
+}
+
+// environment parses \begin{name} up to its \end{name}. The environments are
+// matrices, cases and aligned equations, whose cells are separated by & and
+// rows by \\
+func (p *converter) environment(begin token) (atom, error) {
+	name, err := p.rawArgument(begin)
+	if err != nil {
+		return atom{}, err
+	}
+	env, ok := environments[name]
+	if !ok {
+		return atom{}, p.errorf(begin.pos, "unknown environment %s", name)
+	}
+	rows := [][]string{}
+	cells := []string{}
+	for {
+		items, err := p.row("")
+		if err != nil {
+			return atom{}, err
+		}
+		cells = append(cells, mrow(items))
+		t := p.next()
+		switch {
+		case t.is("&"):
+			continue
+		case t.isCommand(`\`):
+			rows = append(rows, cells)
+			cells = []string{}
+			continue
+		case t.isCommand("end"):
+			end, err := p.rawArgument(t)
+			if err != nil {
+				return atom{}, err
+			}
+			if end != name {
+				return atom{}, p.errorf(t.pos, `\begin{%s} is ended by \end{%s}`, name, end)
+			}
+		case t.kind == eof:
+			return atom{}, p.errorf(begin.pos, `\begin{%s} is never ended`, name)
+		default:
+			return atom{}, p.errorf(t.pos, "unexpected %s", t)
+		}
+		break
+	}
+	// A \\ after the last row doesn't start another one
+	if len(cells) > 1 || cells[0] != mrow(nil) {
+		rows = append(rows, cells)
+	}
+
+	table := strings.Builder{}
+	fmt.Fprintf(&table, `<mtable columnalign="%s">`, env.align)
+	for _, cells := range rows {
+		table.WriteString("<mtr>")
+		for _, cell := range cells {
+			fmt.Fprintf(&table, "<mtd>%s</mtd>", cell)
+		}
+		table.WriteString("</mtr>")
+	}
+	table.WriteString("</mtable>")
+	if env.open == "" && env.close == "" {
+		return atom{markup: table.String()}, nil
+	}
+	row := mo(env.open) + table.String()
+	if env.close != "" {
+		row += mo(env.close)
+	}
+	return atom{markup: fmt.Sprintf("<mrow>%s</mrow>", row)}, nil
+}
+
+// identifier returns the markup for the letter r in the current font
+func (p *converter) identifier(r rune) string {
+	switch p.font {
+	case "normal":
+		return fmt.Sprintf(`<mi mathvariant="normal">%s</mi>`, html.EscapeString(string(r)))
+	case "":
+		return mi(string(r))
+	}
+	return mi(string(styled(r, p.font)))
+}
+
+// number returns the markup for the number in the current font
+func (p *converter) number(number string) string {
+	if p.font == "" || p.font == "normal" {
+		return fmt.Sprintf("<mn>%s</mn>", number)
+	}
+	styledNumber := strings.Map(func(r rune) rune {
+		return styled(r, p.font)
+	}, number)
+	return fmt.Sprintf("<mn>%s</mn>", styledNumber)
+}
+
+func mi(s string) string {
+	return fmt.Sprintf("<mi>%s</mi>", html.EscapeString(s))
+}
+
+func mo(s string) string {
+	return fmt.Sprintf("<mo>%s</mo>", html.EscapeString(s))
+}
+
+// mrow groups items, unless there's only one
+func mrow(items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return fmt.Sprintf("<mrow>%s</mrow>", strings.Join(items, ""))
+}
+
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,221 @@
+package mathml
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/yuin/goldmark"
+)
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		name     string
+		tex      string
+		display  bool
+		expected string
+	}{
+		{
+			"scripts",
+			`x^2 + y_1^{23}`,
+			false,
+			`<math><mrow><msup><mi>x</mi><mn>2</mn></msup><mo>+</mo><msubsup><mi>y</mi><mn>1</mn><mn>23</mn></msubsup></mrow></math>`,
+		},
+		{
+			"a script is one digit",
+			`x^23`,
+			false,
+			`<math><mrow><msup><mi>x</mi><mn>2</mn></msup><mn>3</mn></mrow></math>`,
+		},
+		{
+			"fractions and roots",
+			`\frac{1}{2} \sqrt{x} \sqrt[3]{y}`,
+			false,
+			`<math><mrow><mfrac><mn>1</mn><mn>2</mn></mfrac><msqrt><mi>x</mi></msqrt><mroot><mi>y</mi><mn>3</mn></mroot></mrow></math>`,
+		},
+		{
+			"limits when displayed",
+			`\sum_{i=1}^n a_i`,
+			true,
+			`<math display="block"><mrow><munderover><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></munderover><msub><mi>a</mi><mi>i</mi></msub></mrow></math>`,
+		},
+		{
+			"limits inline",
+			`\sum_{i=1}^n \int_0^1`,
+			false,
+			`<math><mrow><msubsup><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></msubsup><msubsup><mo>∫</mo><mn>0</mn><mn>1</mn></msubsup></mrow></math>`,
+		},
+		{
+			"symbols and functions",
+			`\theta \Omega \cdot \le \cos \infty`,
+			false,
+			`<math><mrow><mi>θ</mi><mi mathvariant="normal">Ω</mi><mo>⋅</mo><mo>≤</mo><mi>cos</mi><mi>∞</mi></mrow></math>`,
+		},
+		{
+			"fonts",
+			`\mathbf{v} \mathbb{R}^3 \mathcal{L} \mathrm{d}x`,
+			false,
+			`<math><mrow><mi>𝐯</mi><msup><mi>ℝ</mi><mn>3</mn></msup><mi>ℒ</mi><mi mathvariant="normal">d</mi><mi>x</mi></mrow></math>`,
+		},
+		{
+			"accents and primes",
+			`\vec{n} \hat{x} f'(x)`,
+			false,
+			`<math><mrow><mover accent="true"><mi>n</mi><mo stretchy="false">→</mo></mover><mover accent="true"><mi>x</mi><mo stretchy="false">^</mo></mover><msup><mi>f</mi><mo>′</mo></msup><mo stretchy="false">(</mo><mi>x</mi><mo stretchy="false">)</mo></mrow></math>`,
+		},
+		{
+			"delimiters",
+			`\left\langle u, v \right\rangle \left. x \right|`,
+			false,
+			`<math><mrow><mrow><mo fence="true" form="prefix">⟨</mo><mi>u</mi><mo>,</mo><mi>v</mi><mo fence="true" form="postfix">⟩</mo></mrow><mrow><mi>x</mi><mo fence="true" form="postfix">|</mo></mrow></mrow></math>`,
+		},
+		{
+			"matrices",
+			`\begin{bmatrix} 1 & 0 \\ 0 & 1 \\ \end{bmatrix}`,
+			true,
+			`<math display="block"><mrow><mo>[</mo><mtable columnalign="center"><mtr><mtd><mn>1</mn></mtd><mtd><mn>0</mn></mtd></mtr><mtr><mtd><mn>0</mn></mtd><mtd><mn>1</mn></mtd></mtr></mtable><mo>]</mo></mrow></math>`,
+		},
+		{
+			"text",
+			`x < 0 \text{ if <b>}`,
+			false,
+			`<math><mrow><mi>x</mi><mo>&lt;</mo><mn>0</mn><mtext> if &lt;b&gt;</mtext></mrow></math>`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := Convert(c.tex, c.display)
+			if err != nil {
+				t.Fatalf("Unexpected error from Convert: %s", err)
+			}
+			if actual != c.expected {
+				t.Errorf("Expected: %s, actual: %s", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	cases := []struct {
+		tex      string
+		expected string
+	}{
+		{`x + \foo`, `invalid math at line 1, column 5: unknown command \foo`},
+		{"x +\n  {y", "invalid math at line 2, column 3: { is never closed"},
+		{`x}`, "invalid math at line 1, column 2: unexpected }"},
+		{`x^2^3`, "invalid math at line 1, column 4: double superscript"},
+		{`\frac{1}`, `invalid math at line 1, column 9: missing argument for \frac`},
+		{`\left( x`, `invalid math at line 1, column 1: \left is never closed by \right`},
+		{`a & b`, "invalid math at line 1, column 3: unexpected &"},
+		{`\begin{pmatrix} 1 \end{bmatrix}`, `invalid math at line 1, column 19: \begin{pmatrix} is ended by \end{bmatrix}`},
+		{`\begin{array} 1 \end{array}`, "invalid math at line 1, column 1: unknown environment array"},
+	}
+	for _, c := range cases {
+		_, err := Convert(c.tex, false)
+		if err == nil || err.Error() != c.expected {
+			t.Errorf("Expected: %s, actual: %v", c.expected, err)
+		}
+	}
+}
+
+func convert(markdown string) (string, error) {
+	b := bytes.Buffer{}
+	err := goldmark.New(goldmark.WithExtensions(Extension())).Convert([]byte(markdown), &b)
+	return b.String(), err
+}
+
+func TestExtension(t *testing.T) {
+	cases := []struct {
+		name     string
+		markdown string
+		expected string
+	}{
+		{
+			"inline",
+			"The area is $\\pi r^2$.\n",
+			"<p>The area is <math><mrow><mi>π</mi><msup><mi>r</mi><mn>2</mn></msup></mrow></math>.</p>\n",
+		},
+		{
+			"inline over lines",
+			"Let $a +\nb$ be\n",
+			"<p>Let <math><mrow><mi>a</mi><mo>+</mo><mi>b</mi></mrow></math> be</p>\n",
+		},
+		{
+			"prices",
+			"It was $5 and then $10, or $ 5 $ off.\n",
+			"<p>It was $5 and then $10, or $ 5 $ off.</p>\n",
+		},
+		{
+			"escaped",
+			"Not \\$x$ math\n",
+			"<p>Not $x$ math</p>\n",
+		},
+		{
+			"template variables",
+			"{{ range $i, $x := .list }}{{ $x }}{{ end }}\n",
+			"<p>{{ range $i, $x := .list }}{{ $x }}{{ end }}</p>\n",
+		},
+		{
+			"code",
+			"`$x$`\n",
+			"<p><code>$x$</code></p>\n",
+		},
+		{
+			"block",
+			"Before\n$$\n\\mathbf{A}\\mathbf{x}\n= b\n$$\nAfter\n",
+			"<p>Before</p>\n<math display=\"block\"><mrow><mi>𝐀</mi><mi>𝐱</mi><mo>=</mo><mi>b</mi></mrow></math>\n<p>After</p>\n",
+		},
+		{
+			"block on one line",
+			"$$ x_1 $$\n",
+			"<math display=\"block\"><msub><mi>x</mi><mn>1</mn></msub></math>\n",
+		},
+		{
+			"block with math on its delimiter lines",
+			"$$ x\n+ y $$\n",
+			"<math display=\"block\"><mrow><mi>x</mi><mo>+</mo><mi>y</mi></mrow></math>\n",
+		},
+		{
+			"displayed in a paragraph",
+			"So $$x$$ is\n",
+			"<p>So <math display=\"block\"><mi>x</mi></math> is</p>\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := convert(c.markdown)
+			if err != nil {
+				t.Fatalf("Unexpected error converting markdown: %s", err)
+			}
+			if actual != c.expected {
+				t.Errorf("Expected: %s, actual: %s", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestExtensionErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		markdown string
+		line     int
+		column   int
+	}{
+		{"inline", "# Heading\n\nSome $x + \\foo$ here\n", 3, 11},
+		{"inline over lines", "> Quoted $x +\n> \\bar{$\n", 2, 7},
+		{"block", "Text\n\n$$\n\\begin{bmatrix}\n1 & 2 \\\\\n3 & \\x\n\\end{bmatrix}\n$$\n", 6, 5},
+		{"never closed", "Text\n\n$$\nx\n", 3, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := convert(c.markdown)
+			mathErr := Error{}
+			if !errors.As(err, &mathErr) {
+				t.Fatalf("Expected a math error, actual: %v", err)
+			}
+			if mathErr.Line != c.line || mathErr.Column != c.column {
+				t.Errorf("Expected: %d:%d, actual: %d:%d (%s)", c.line, c.column, mathErr.Line, mathErr.Column, err)
+			}
+		})
+	}
+}
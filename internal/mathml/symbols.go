@@ -0,0 +1,188 @@
+package mathml
+
+import "fmt"
+
+// symbols are the commands that stand for a single letter or operator
+var symbols = map[string]string{}
+
+func init() {
+	for name, letter := range map[string]string{
+		"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+		"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+		"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+		"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+		"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω", "ell": "ℓ", "hbar": "ℏ", "infty": "∞",
+		"aleph": "ℵ",
+	} {
+		symbols[name] = mi(letter)
+	}
+	// Capital Greek letters and the like are upright, unlike other letters
+	for name, letter := range map[string]string{
+		"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+		"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω", "partial": "∂",
+		"nabla": "∇", "emptyset": "∅", "varnothing": "∅", "Re": "ℜ", "Im": "ℑ",
+	} {
+		symbols[name] = fmt.Sprintf(`<mi mathvariant="normal">%s</mi>`, letter)
+	}
+	for name, op := range map[string]string{
+		"pm": "±", "mp": "∓", "times": "×", "div": "÷", "cdot": "⋅", "ast": "∗", "star": "⋆",
+		"circ": "∘", "bullet": "∙", "oplus": "⊕", "otimes": "⊗", "odot": "⊙", "cup": "∪",
+		"cap": "∩", "setminus": "∖", "wedge": "∧", "land": "∧", "vee": "∨", "lor": "∨",
+		"neg": "¬", "lnot": "¬", "le": "≤", "leq": "≤", "ge": "≥", "geq": "≥", "ne": "≠",
+		"neq": "≠", "approx": "≈", "sim": "∼", "simeq": "≃", "cong": "≅", "equiv": "≡",
+		"propto": "∝", "ll": "≪", "gg": "≫", "in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂",
+		"subseteq": "⊆", "supset": "⊃", "supseteq": "⊇", "perp": "⊥", "parallel": "∥",
+		"mid": "∣", "to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←",
+		"leftrightarrow": "↔", "Rightarrow": "⇒", "Leftarrow": "⇐", "Leftrightarrow": "⇔",
+		"implies": "⟹", "iff": "⟺", "mapsto": "↦", "uparrow": "↑", "downarrow": "↓",
+		"longrightarrow": "⟶", "forall": "∀", "exists": "∃", "nexists": "∄", "top": "⊤",
+		"bot": "⊥", "angle": "∠", "triangle": "△", "therefore": "∴", "because": "∵",
+		"ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱", "colon": ":",
+		"%": "%", "$": "$", "#": "#", "&": "&", "_": "_",
+		"backslash": "\\",
+	} {
+		symbols[name] = mo(op)
+	}
+	// Delimiters on their own don't grow with what's between them, like in LaTeX
+	for name, delim := range delimiters {
+		if name[0] == '\\' && symbols[name[1:]] == "" {
+			symbols[name[1:]] = fmt.Sprintf(`<mo stretchy="false">%s</mo>`, delim)
+		}
+	}
+}
+
+// operators are the characters that aren't written as they are, or that are
+// written as delimiters
+var operators = map[string]string{
+	"-": mo("−"),
+	"*": mo("∗"),
+	"'": mo("′"),
+	"(": `<mo stretchy="false">(</mo>`,
+	")": `<mo stretchy="false">)</mo>`,
+	"[": `<mo stretchy="false">[</mo>`,
+	"]": `<mo stretchy="false">]</mo>`,
+	"|": `<mo stretchy="false">|</mo>`,
+	"/": `<mo stretchy="false">/</mo>`,
+}
+
+// largeOperators have their limits under and over them when displayed, except
+// for integrals
+var largeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "bigcup": "⋃", "bigcap": "⋂", "bigoplus": "⨁",
+	"bigotimes": "⨂", "bigvee": "⋁", "bigwedge": "⋀", "int": "∫", "iint": "∬", "iiint": "∭",
+	"oint": "∮",
+}
+
+// functions are written upright, and some have their limits under them when
+// displayed, like \lim
+var functions = map[string]bool{
+	"sin": false, "cos": false, "tan": false, "cot": false, "sec": false, "csc": false,
+	"arcsin": false, "arccos": false, "arctan": false, "sinh": false, "cosh": false,
+	"tanh": false, "log": false, "ln": false, "lg": false, "exp": false, "deg": false,
+	"dim": false, "ker": false, "hom": false, "arg": false, "det": true, "gcd": true,
+	"lim": true, "liminf": true, "limsup": true, "max": true, "min": true, "sup": true,
+	"inf": true, "Pr": true,
+}
+
+// spaces are the widths of the spacing commands
+var spaces = map[string]string{
+	",": "0.167em", ":": "0.222em", ">": "0.222em", ";": "0.278em", "!": "-0.167em",
+	" ": "0.333em", "quad": "1em", "qquad": "2em",
+}
+
+// accents put a mark over or under their argument
+var accents = map[string]func(string) string{
+	"vec":            over("→", false),
+	"hat":            over("^", false),
+	"widehat":        over("^", true),
+	"bar":            over("¯", false),
+	"overline":       over("‾", true),
+	"tilde":          over("~", false),
+	"widetilde":      over("~", true),
+	"dot":            over("˙", false),
+	"ddot":           over("¨", false),
+	"overrightarrow": over("→", true),
+	"underline": func(arg string) string {
+		return fmt.Sprintf(`<munder accentunder="true">%s<mo stretchy="true">_</mo></munder>`, arg)
+	},
+}
+
+func over(mark string, stretchy bool) func(string) string {
+	return func(arg string) string {
+		return fmt.Sprintf(`<mover accent="true">%s<mo stretchy="%t">%s</mo></mover>`, arg, stretchy, mark)
+	}
+}
+
+// fonts are the commands that change the font of the letters in their argument
+var fonts = map[string]string{
+	"mathbf":     "bold",
+	"boldsymbol": "bold",
+	"bm":         "bold",
+	"mathbb":     "double-struck",
+	"mathcal":    "script",
+	"mathrm":     "normal",
+	"mathit":     "",
+}
+
+// delimiters are those that \left, \right and \big can size
+var delimiters = map[string]string{
+	"(": "(", ")": ")", "[": "[", "]": "]", "|": "|", "/": "/", `\{`: "{", `\}`: "}",
+	`\|`: "‖", `\langle`: "⟨", `\rangle`: "⟩", `\lvert`: "|", `\rvert`: "|", `\vert`: "|",
+	`\lVert`: "‖", `\rVert`: "‖", `\Vert`: "‖", `\lfloor`: "⌊", `\rfloor`: "⌋",
+	`\lceil`: "⌈", `\rceil`: "⌉", `\uparrow`: "↑", `\downarrow`: "↓",
+}
+
+// delimiterSizes are the heights of the delimiters after \big and the like
+var delimiterSizes = map[string]string{
+	"big": "1.2em", "Big": "1.623em", "bigg": "2.047em", "Bigg": "2.470em",
+}
+
+type environment struct {
+	open, close string // The delimiters around the table
+	align       string // The alignment of its columns
+}
+
+var environments = map[string]environment{
+	"matrix":  {"", "", "center"},
+	"pmatrix": {"(", ")", "center"},
+	"bmatrix": {"[", "]", "center"},
+	"Bmatrix": {"{", "}", "center"},
+	"vmatrix": {"|", "|", "center"},
+	"Vmatrix": {"‖", "‖", "center"},
+	"cases":   {"{", "", "left left"},
+	"aligned": {"", "", "right left"},
+}
+
+// styled returns r in a font of Unicode's mathematical alphanumeric symbols,
+// since MathML in browsers doesn't have fonts other than normal and italic. The
+// letters that Unicode already had elsewhere are holes in those blocks
+func styled(r rune, font string) rune {
+	if s, ok := letterlikeSymbols[font][r]; ok {
+		return s
+	}
+	switch {
+	case 'A' <= r && r <= 'Z':
+		return alphanumericStarts[font][0] + r - 'A'
+	case 'a' <= r && r <= 'z':
+		return alphanumericStarts[font][1] + r - 'a'
+	case '0' <= r && r <= '9' && alphanumericStarts[font][2] != 0:
+		return alphanumericStarts[font][2] + r - '0'
+	}
+	return r
+}
+
+// alphanumericStarts are where the capital letters, small letters and digits of
+// each font start
+var alphanumericStarts = map[string][3]rune{
+	"bold":          {0x1D400, 0x1D41A, 0x1D7CE},
+	"double-struck": {0x1D538, 0x1D552, 0x1D7D8},
+	"script":        {0x1D49C, 0x1D4B6, 0},
+}
+
+var letterlikeSymbols = map[string]map[rune]rune{
+	"double-struck": {'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ'},
+	"script": {
+		'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ', 'R': 'ℛ',
+		'e': 'ℯ', 'g': 'ℊ', 'o': 'ℴ',
+	},
+}
@@ -1,21 +1,83 @@
 package page
 
-import "fmt"
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	yamlDelimiter = "---"
+	tomlDelimiter = "+++"
+)
 
 // Page holds data for templating a page
 type Page struct {
-	Title     string
-	Content   []byte
-	Template  []byte
-	Params    map[string]interface{}
-	AssetPath string
-	BuildPath string
+	Title       string
+	Date        time.Time
+	Description string
+	Tags        []string
+	Draft       bool
+	PublishDate time.Time
+	Lastmod     time.Time
+	NoIndex     bool
+	NoTOC       bool // Leaves out the table of contents
+	Templated   bool // Evaluates the template actions in the content, e.g. {{ .page.Title }}
+	Layout      string
+	Name        string // File name without the extension
+	Section     string // Top level directory under assets/pages, empty for root pages
+	URL         string // Site relative link to the built page
+	Summary     string // Description, or the text of the first paragraph
+	HTML        string // Rendered main content, set once the page is templated
+	Content     []byte
+	LineOffset  int // Lines of front matter before the content in the source file
+	Template    []byte
+	Params      map[string]interface{}
+	AssetPath   string
+	BuildPath   string
+}
+
+// frontMatter is the typed subset of a page's front matter. Every key,
+// including these, is also kept in Page.Params for use in templates
+type frontMatter struct {
+	Title       string    `yaml:"title" toml:"title"`
+	Date        time.Time `yaml:"date" toml:"date"`
+	Description string    `yaml:"description" toml:"description"`
+	Tags        []string  `yaml:"tags" toml:"tags"`
+	Draft       bool      `yaml:"draft" toml:"draft"`
+	PublishDate time.Time `yaml:"publishDate" toml:"publishDate"`
+	Lastmod     time.Time `yaml:"lastmod" toml:"lastmod"`
+	NoIndex     bool      `yaml:"noindex" toml:"noindex"`
+	NoTOC       bool      `yaml:"notoc" toml:"notoc"`
+	Templated   *bool     `yaml:"templated" toml:"templated"`
+	Layout      string    `yaml:"layout" toml:"layout"`
 }
 
 func (p *Page) String() string {
 	return fmt.Sprintf(
-		"Title: %s\nContent: %s\nTemplate: %s\nParams: %v\nAssetPath: %s\nBuildPath: %s",
+		"Title: %s\nDate: %s\nDescription: %s\nTags: %v\nDraft: %t\nPublishDate: %s\nLastmod: %s\nNoIndex: %t\nNoTOC: %t\nTemplated: %t\nLayout: %s\nName: %s\nSection: %s\nURL: %s\nSummary: %s\nContent: %s\nTemplate: %s\nParams: %v\nAssetPath: %s\nBuildPath: %s",
 		p.Title,
+		formatDate(p.Date),
+		p.Description,
+		p.Tags,
+		p.Draft,
+		formatDate(p.PublishDate),
+		formatDate(p.Lastmod),
+		p.NoIndex,
+		p.NoTOC,
+		p.Templated,
+		p.Layout,
+		p.Name,
+		p.Section,
+		p.URL,
+		p.Summary,
 		string(p.Content),
 		string(p.Template),
 		p.Params,
@@ -23,3 +85,208 @@ func (p *Page) String() string {
 		p.BuildPath,
 	)
 }
+
+// formatDate leaves unset dates empty rather than printing the zero time
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// IsFuture reports whether the page is scheduled to be published after now
+func (p *Page) IsFuture(now time.Time) bool {
+	return p.PublishDate.After(now)
+}
+
+// ParseFrontMatter strips a leading front matter block from the page content
+// and decodes it into the page. YAML front matter is delimited by "---" lines
+// and TOML front matter by "+++" lines. Content without front matter is left
+// as is
+func (p *Page) ParseFrontMatter() error {
+	delimiter, raw, body, err := splitFrontMatter(p.Content)
+	if err != nil {
+		return err
+	}
+	if delimiter == "" {
+		return nil
+	}
+
+	fm := frontMatter{}
+	params := map[string]interface{}{}
+	switch delimiter {
+	case yamlDelimiter:
+		if err := yaml.Unmarshal(raw, &fm); err != nil {
+			return fmt.Errorf("error decoding YAML front matter: %s", err)
+		}
+		if err := yaml.Unmarshal(raw, &params); err != nil {
+			return fmt.Errorf("error decoding YAML front matter: %s", err)
+		}
+	case tomlDelimiter:
+		if err := toml.Unmarshal(raw, &fm); err != nil {
+			return fmt.Errorf("error decoding TOML front matter: %s", err)
+		}
+		if err := toml.Unmarshal(raw, &params); err != nil {
+			return fmt.Errorf("error decoding TOML front matter: %s", err)
+		}
+	}
+
+	p.Title = fm.Title
+	p.Date = fm.Date
+	p.Description = fm.Description
+	p.Tags = fm.Tags
+	p.Draft = fm.Draft
+	p.PublishDate = fm.PublishDate
+	p.Lastmod = fm.Lastmod
+	p.NoIndex = fm.NoIndex
+	p.NoTOC = fm.NoTOC
+	// Whether a page is templated by default depends on where it is, so it's
+	// only changed when the front matter says so
+	if fm.Templated != nil {
+		p.Templated = *fm.Templated
+	}
+	p.Layout = fm.Layout
+	p.Params = params
+	p.LineOffset = bytes.Count(p.Content[:len(p.Content)-len(body)], []byte("\n"))
+	p.Content = body
+	return nil
+}
+
+// splitFrontMatter separates content into the raw front matter and the
+// remaining body. The opening delimiter must be the very first line of the
+// content and the closing delimiter must be on a line by itself. The returned
+// delimiter is empty when the content has no front matter
+func splitFrontMatter(content []byte) (string, []byte, []byte, error) {
+	for _, delimiter := range []string{yamlDelimiter, tomlDelimiter} {
+		rest, ok := cutLine(content, delimiter)
+		if !ok {
+			continue
+		}
+		raw := rest
+		for len(rest) > 0 {
+			end := bytes.IndexByte(rest, '\n')
+			line, next := rest, []byte{}
+			if end >= 0 {
+				line, next = rest[:end+1], rest[end+1:]
+			}
+			if string(bytes.TrimRight(line, "\r\n")) == delimiter {
+				return delimiter, raw[:len(raw)-len(rest)], next, nil
+			}
+			rest = next
+		}
+		return "", nil, content, fmt.Errorf("front matter opened with %s is never closed", delimiter)
+	}
+	return "", nil, content, nil
+}
+
+// cutLine returns the content following the first line if that line is
+// exactly the delimiter
+func cutLine(content []byte, delimiter string) ([]byte, bool) {
+	end := bytes.IndexByte(content, '\n')
+	if end < 0 {
+		return nil, false
+	}
+	if string(bytes.TrimRight(content[:end+1], "\r\n")) != delimiter {
+		return nil, false
+	}
+	return content[end+1:], true
+}
+
+// Where returns the pages whose field or front matter param named key equals
+// value. Slice fields such as Tags match when they contain value. Intended for
+// templates, e.g. {{ where .site.Pages "Section" "posts" }}
+func Where(pages []Page, key string, value interface{}) []Page {
+	matches := []Page{}
+	for _, p := range pages {
+		field, ok := p.lookup(key)
+		if !ok {
+			continue
+		}
+		if field.Kind() == reflect.Slice {
+			for i := range field.Len() {
+				if reflect.DeepEqual(field.Index(i).Interface(), value) {
+					matches = append(matches, p)
+					break
+				}
+			}
+		} else if reflect.DeepEqual(field.Interface(), value) {
+			matches = append(matches, p)
+		}
+	}
+	return matches
+}
+
+// SortBy returns a copy of pages sorted by the field named key, ascending by
+// default or descending when order is "desc". Pages that compare equal keep a
+// stable order by URL so output does not depend on directory read order.
+// Unset fields compare as their zero value, so undated posts sort after dated
+// ones when sorting by "Date" "desc".
+// Intended for templates, e.g. {{ sortBy .site.Pages "Date" "desc" }}
+func SortBy(pages []Page, key string, order ...string) ([]Page, error) {
+	desc := false
+	if len(order) > 0 {
+		switch strings.ToLower(order[0]) {
+		case "asc":
+		case "desc":
+			desc = true
+		default:
+			return nil, fmt.Errorf("unknown sort order %q, expected asc or desc", order[0])
+		}
+	}
+	sorted := slices.Clone(pages)
+	var sortErr error
+	slices.SortStableFunc(sorted, func(a, b Page) int {
+		fieldA, okA := a.lookup(key)
+		fieldB, okB := b.lookup(key)
+		if !okA || !okB {
+			sortErr = fmt.Errorf("pages can't be sorted by %q", key)
+			return 0
+		}
+		c, err := compareValues(fieldA, fieldB)
+		if err != nil {
+			sortErr = err
+			return 0
+		}
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			return cmp.Compare(a.URL, b.URL)
+		}
+		return c
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+	return sorted, nil
+}
+
+// lookup finds the exported field named key, falling back to the front matter
+// params so that custom keys can be used with Where and SortBy
+func (p Page) lookup(key string) (reflect.Value, bool) {
+	field := reflect.ValueOf(p).FieldByName(key)
+	if field.IsValid() {
+		return field, true
+	}
+	if param, ok := p.Params[key]; ok && param != nil {
+		return reflect.ValueOf(param), true
+	}
+	return reflect.Value{}, false
+}
+
+func compareValues(a, b reflect.Value) (int, error) {
+	if ta, ok := a.Interface().(time.Time); ok {
+		if tb, ok := b.Interface().(time.Time); ok {
+			return ta.Compare(tb), nil
+		}
+	}
+	switch {
+	case a.CanInt() && b.CanInt():
+		return cmp.Compare(a.Int(), b.Int()), nil
+	case a.CanFloat() && b.CanFloat():
+		return cmp.Compare(a.Float(), b.Float()), nil
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return cmp.Compare(a.String(), b.String()), nil
+	}
+	return 0, fmt.Errorf("can't compare %s with %s", a.Type(), b.Type())
+}
@@ -1,10 +1,21 @@
 package page
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestPageString(t *testing.T) {
 	page := Page{
 		Title:     "Test",
+		Date:      time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC),
+		Tags:      []string{"a", "b"},
+		Draft:     true,
+		Layout:    "post",
+		Name:      "test",
+		Section:   "posts",
+		URL:       "/posts/test.html",
 		Content:   []byte("Test"),
 		Template:  []byte("Test"),
 		Params:    map[string]interface{}{"testKey": "testParam"},
@@ -13,6 +24,20 @@ func TestPageString(t *testing.T) {
 	}
 
 	expected := `Title: Test
+Date: 2024-06-05T00:00:00Z
+Description: 
+Tags: [a b]
+Draft: true
+PublishDate: 
+Lastmod: 
+NoIndex: false
+NoTOC: false
+Templated: false
+Layout: post
+Name: test
+Section: posts
+URL: /posts/test.html
+Summary: 
 Content: Test
 Template: Test
 Params: map[testKey:testParam]
@@ -22,3 +47,184 @@ BuildPath: test/build`
 		t.Errorf("Expected %s, got %s", expected, page.String())
 	}
 }
+
+func TestParseFrontMatter(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		expect  Page
+	}{
+		{
+			"no front matter",
+			"# Heading\nBody",
+			Page{Content: []byte("# Heading\nBody")},
+		},
+		{
+			"yaml",
+			"---\ntitle: YAML Post\ndate: 2024-04-10\ndescription: A post\ntags: [graphics, go]\ndraft: true\nseries: shaders\n---\n# Heading\n",
+			Page{
+				Title:       "YAML Post",
+				Date:        time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC),
+				Description: "A post",
+				Tags:        []string{"graphics", "go"},
+				Draft:       true,
+				Content:     []byte("# Heading\n"),
+				LineOffset:  8,
+				Params: map[string]interface{}{
+					"title":       "YAML Post",
+					"date":        "2024-04-10",
+					"description": "A post",
+					"tags":        []interface{}{"graphics", "go"},
+					"draft":       true,
+					"series":      "shaders",
+				},
+			},
+		},
+		{
+			"toml",
+			"+++\r\ntitle = \"TOML Post\"\r\ndate = 2024-04-10T08:30:00Z\r\n+++\r\nBody",
+			Page{
+				Title:      "TOML Post",
+				Date:       time.Date(2024, 4, 10, 8, 30, 0, 0, time.UTC),
+				Content:    []byte("Body"),
+				LineOffset: 4,
+				Params: map[string]interface{}{
+					"title": "TOML Post",
+					"date":  time.Date(2024, 4, 10, 8, 30, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			"horizontal rule later in content",
+			"Body\n---\nMore",
+			Page{Content: []byte("Body\n---\nMore")},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := Page{Content: []byte(c.content)}
+			if err := actual.ParseFrontMatter(); err != nil {
+				t.Fatalf("Unexpected error from ParseFrontMatter: %s", err)
+			}
+			if !reflect.DeepEqual(actual, c.expect) {
+				t.Errorf("Expected: %#v, actual: %#v", c.expect, actual)
+			}
+		})
+	}
+}
+
+func TestParseFrontMatterTemplated(t *testing.T) {
+	cases := []struct {
+		content   string
+		templated bool
+		expect    bool
+	}{
+		{"---\ntitle: Kept\n---\nBody", true, true},
+		{"---\ntemplated: false\n---\nBody", true, false},
+		{"---\ntemplated: true\n---\nBody", false, true},
+		{"+++\ntemplated = true\n+++\nBody", false, true},
+	}
+	for _, c := range cases {
+		p := Page{Content: []byte(c.content), Templated: c.templated}
+		if err := p.ParseFrontMatter(); err != nil {
+			t.Fatalf("Unexpected error from ParseFrontMatter: %s", err)
+		}
+		if p.Templated != c.expect {
+			t.Errorf("Expected templated to be %t for %q, actual: %t", c.expect, c.content, p.Templated)
+		}
+	}
+}
+
+func TestParseFrontMatterUnclosed(t *testing.T) {
+	p := Page{Content: []byte("---\ntitle: Never closed\n# Heading")}
+	if err := p.ParseFrontMatter(); err == nil {
+		t.Errorf("Expected an error for unclosed front matter")
+	}
+}
+
+func TestIsFuture(t *testing.T) {
+	now := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		publishDate time.Time
+		expect      bool
+	}{
+		{time.Time{}, false},
+		{now.Add(-time.Hour), false},
+		{now, false},
+		{now.Add(time.Hour), true},
+	}
+	for _, c := range cases {
+		p := Page{PublishDate: c.publishDate}
+		if actual := p.IsFuture(now); actual != c.expect {
+			t.Errorf("Expected IsFuture for %s to be %t, actual: %t", c.publishDate, c.expect, actual)
+		}
+	}
+}
+
+func TestWhere(t *testing.T) {
+	pages := []Page{
+		{URL: "/index.html"},
+		{URL: "/posts/a.html", Section: "posts", Tags: []string{"go"}},
+		{URL: "/posts/b.html", Section: "posts", Tags: []string{"graphics", "go"}, Params: map[string]interface{}{"series": "shaders"}},
+	}
+	cases := []struct {
+		key    string
+		value  interface{}
+		expect []string
+	}{
+		{"Section", "posts", []string{"/posts/a.html", "/posts/b.html"}},
+		{"Tags", "graphics", []string{"/posts/b.html"}},
+		{"series", "shaders", []string{"/posts/b.html"}},
+		{"Section", "missing", []string{}},
+	}
+	for _, c := range cases {
+		actual := []string{}
+		for _, p := range Where(pages, c.key, c.value) {
+			actual = append(actual, p.URL)
+		}
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("Expected where %s = %v: %s, actual: %s", c.key, c.value, c.expect, actual)
+		}
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	pages := []Page{
+		{URL: "/c.html", Title: "C"},
+		{URL: "/b.html", Title: "B", Date: time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC)},
+		{URL: "/a.html", Title: "A", Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{URL: "/d.html", Title: "D"},
+	}
+	cases := []struct {
+		key    string
+		order  []string
+		expect []string
+	}{
+		{"Date", []string{"desc"}, []string{"/a.html", "/b.html", "/c.html", "/d.html"}},
+		{"Date", nil, []string{"/c.html", "/d.html", "/b.html", "/a.html"}},
+		{"Title", []string{"asc"}, []string{"/a.html", "/b.html", "/c.html", "/d.html"}},
+		{"Description", nil, []string{"/a.html", "/b.html", "/c.html", "/d.html"}},
+	}
+	for _, c := range cases {
+		sorted, err := SortBy(pages, c.key, c.order...)
+		if err != nil {
+			t.Fatalf("Unexpected error from SortBy: %s", err)
+		}
+		actual := []string{}
+		for _, p := range sorted {
+			actual = append(actual, p.URL)
+		}
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("Expected sort by %s %v: %s, actual: %s", c.key, c.order, c.expect, actual)
+		}
+	}
+	if pages[0].URL != "/c.html" {
+		t.Errorf("Expected SortBy to leave its input unsorted")
+	}
+	if _, err := SortBy(pages, "Date", "sideways"); err == nil {
+		t.Errorf("Expected an error for an unknown sort order")
+	}
+	if _, err := SortBy(pages, "Missing"); err == nil {
+		t.Errorf("Expected an error for an unknown sort key")
+	}
+}
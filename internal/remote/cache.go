@@ -0,0 +1,182 @@
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a cached response is used before fetching it
+// again. The deploy workflow builds twice a day, so it always gets fresh data
+const DefaultCacheTTL = 6 * time.Hour
+
+// ErrOffline is returned for a response that isn't cached when offline
+var ErrOffline = errors.New("offline and no cached response")
+
+// Cache persists responses on disk so that builds don't need remote APIs on
+// every run. A cached response is used while it's younger than the TTL, and
+// an older one is used when fetching a new one fails. Offline never fetches,
+// so an offline build replays exactly what was cached. A nil *Cache fetches
+// every time
+type Cache struct {
+	dir     string
+	ttl     time.Duration
+	offline bool
+	now     func() time.Time
+
+	mu       sync.Mutex // Held while reading and writing files, never while fetching
+	inflight map[string]*fetchCall
+}
+
+// cacheEntry is the file a response is cached in
+type cacheEntry struct {
+	Fetched time.Time `json:"fetched"`
+	Body    []byte    `json:"body"`
+}
+
+// fetchCall is a fetch in progress. Gets of the same key wait for its result
+// rather than fetching it again
+type fetchCall struct {
+	done chan struct{}
+	body []byte
+	err  error
+}
+
+// NewCache returns a cache storing responses in dir. An empty dir stores
+// nothing, which still lets offline builds skip fetching
+func NewCache(dir string, ttl time.Duration, offline bool) *Cache {
+	return &Cache{dir: dir, ttl: ttl, offline: offline, now: time.Now, inflight: map[string]*fetchCall{}}
+}
+
+// Get returns the response cached under key, calling fetch for a new one when
+// the cached response has expired or there isn't one. fetch should fail for a
+// response that can't be used, so that it's never cached. Gets of a key that's
+// being fetched share that fetch, and Gets of other keys don't wait for it
+func (c *Cache) Get(key string, fetch func() ([]byte, error)) ([]byte, error) {
+	if c == nil {
+		return fetch()
+	}
+	c.mu.Lock()
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.body, call.err
+	}
+	entry, cached, err := c.read(key)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	if cached && (c.offline || c.now().Sub(entry.Fetched) < c.ttl) {
+		c.mu.Unlock()
+		return entry.Body, nil
+	}
+	if c.offline {
+		c.mu.Unlock()
+		return nil, ErrOffline
+	}
+	call := &fetchCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.body, call.err = c.fetch(key, entry, cached, fetch)
+	return call.body, call.err
+}
+
+// fetch calls fetch for a new response to cache under key, or returns the
+// expired entry when fetching fails and there's one cached
+func (c *Cache) fetch(key string, entry cacheEntry, cached bool, fetch func() ([]byte, error)) ([]byte, error) {
+	body, err := fetch()
+	if err != nil {
+		if cached {
+			log.Printf("Using response %s cached at %s: %s", key, entry.Fetched.Format(time.RFC3339), err)
+			return entry.Body, nil
+		}
+		return nil, err
+	}
+	return c.store(key, body)
+}
+
+// Refresh calls fetch for a new response to cache under key even when the
+// cached response hasn't expired, for callers that can't use an older one. It
+// never falls back on the cached response, and fails with ErrOffline when offline
+func (c *Cache) Refresh(key string, fetch func() ([]byte, error)) ([]byte, error) {
+	if c == nil {
+		return fetch()
+	}
+	if c.offline {
+		return nil, ErrOffline
+	}
+	body, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	return c.store(key, body)
+}
+
+// store caches body under key as fetched now
+func (c *Cache) store(key string, body []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.write(key, cacheEntry{Fetched: c.now(), Body: body}); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%s.json", key))
+}
+
+func (c *Cache) read(key string) (cacheEntry, bool, error) {
+	entry := cacheEntry{}
+	if c.dir == "" {
+		return entry, false, nil
+	}
+	b, err := os.ReadFile(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return entry, false, nil
+	} else if err != nil {
+		return entry, false, fmt.Errorf("error reading response cache: %s", err)
+	}
+	if err := json.Unmarshal(b, &entry); err != nil {
+		// A corrupt entry is as good as a missing one, it's replaced on the next fetch
+		log.Printf("Ignoring unreadable cached response %s: %s", c.path(key), err)
+		return cacheEntry{}, false, nil
+	}
+	return entry, true, nil
+}
+
+func (c *Cache) write(key string, entry cacheEntry) error {
+	if c.dir == "" {
+		return nil
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding response cache: %s", err)
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("error making response cache directory: %s", err)
+	}
+	// Written to a temporary file first so that a failed write can't leave a
+	// truncated entry behind
+	tmp := fmt.Sprintf("%s.tmp", c.path(key))
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("error writing response cache: %s", err)
+	}
+	if err := os.Rename(tmp, c.path(key)); err != nil {
+		return fmt.Errorf("error writing response cache: %s", err)
+	}
+	return nil
+}
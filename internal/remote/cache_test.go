@@ -0,0 +1,177 @@
+package remote
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestCache(dir string, offline bool, now *time.Time) *Cache {
+	c := NewCache(dir, time.Hour, offline)
+	c.now = func() time.Time { return *now }
+	return c
+}
+
+func TestCacheGet(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(dir, false, &now)
+	fetches := 0
+	fetch := func(body string, err error) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			fetches++
+			return []byte(body), err
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		after   time.Duration
+		fetch   func() ([]byte, error)
+		expect  string
+		fetches int
+		err     bool
+	}{
+		{"fetched when nothing is cached", 0, fetch(`{"v":1}`, nil), `{"v":1}`, 1, false},
+		{"cached within the TTL", 30 * time.Minute, fetch(`{"v":2}`, nil), `{"v":1}`, 1, false},
+		{"fetched after the TTL", time.Hour, fetch(`{"v":2}`, nil), `{"v":2}`, 2, false},
+		{"expired response used when fetching fails", 3 * time.Hour, fetch("", errors.New("unreachable")), `{"v":2}`, 3, false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			now = now.Add(testCase.after)
+			actual, err := c.Get("test", testCase.fetch)
+			if testCase.err != (err != nil) {
+				t.Fatalf("Expected error: %t, actual: %v", testCase.err, err)
+			}
+			if string(actual) != testCase.expect {
+				t.Errorf("Expected: %s, actual: %s", testCase.expect, string(actual))
+			}
+			if fetches != testCase.fetches {
+				t.Errorf("Expected %d fetches, actual: %d", testCase.fetches, fetches)
+			}
+		})
+	}
+
+	if _, err := c.Get("missing", fetch("", errors.New("unreachable"))); err == nil {
+		t.Errorf("Expected an error when fetching fails with nothing cached")
+	}
+}
+
+func TestCacheConcurrentGet(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(dir, false, &now)
+	if _, err := c.Get("cached", func() ([]byte, error) { return []byte(`{"v":1}`), nil }); err != nil {
+		t.Fatalf("Unexpected error from Get: %s", err)
+	}
+
+	fetches := atomic.Int32{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fetch := func() ([]byte, error) {
+		if fetches.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return []byte(`{"v":2}`), nil
+	}
+	results := make([]string, 4)
+	wg := sync.WaitGroup{}
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, err := c.Get("slow", fetch)
+			if err != nil {
+				t.Errorf("Unexpected error from Get: %s", err)
+			}
+			results[i] = string(body)
+		}()
+	}
+
+	// Another key is read while the fetch is in progress
+	<-started
+	cached := make(chan string)
+	go func() {
+		body, _ := c.Get("cached", func() ([]byte, error) { return nil, errors.New("unexpected fetch") })
+		cached <- string(body)
+	}()
+	select {
+	case actual := <-cached:
+		if actual != `{"v":1}` {
+			t.Errorf("Expected: {\"v\":1}, actual: %s", actual)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a cached response to be read while another key is fetched")
+	}
+
+	close(release)
+	wg.Wait()
+	if fetches.Load() != 1 {
+		t.Errorf("Expected 1 fetch, actual: %d", fetches.Load())
+	}
+	for _, actual := range results {
+		if actual != `{"v":2}` {
+			t.Errorf("Expected: {\"v\":2}, actual: %s", actual)
+		}
+	}
+}
+
+func TestCacheRefresh(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(dir, false, &now)
+	if _, err := c.Get("test", func() ([]byte, error) { return []byte(`{"v":1}`), nil }); err != nil {
+		t.Fatalf("Unexpected error from Get: %s", err)
+	}
+
+	// The cached response hasn't expired, but it's fetched again anyway
+	actual, err := c.Refresh("test", func() ([]byte, error) { return []byte(`{"v":2}`), nil })
+	if err != nil {
+		t.Fatalf("Unexpected error from Refresh: %s", err)
+	}
+	if string(actual) != `{"v":2}` {
+		t.Errorf("Expected: {\"v\":2}, actual: %s", actual)
+	}
+	actual, err = c.Get("test", func() ([]byte, error) { return nil, errors.New("unexpected fetch") })
+	if err != nil || string(actual) != `{"v":2}` {
+		t.Errorf("Expected the refreshed response to be cached, actual: %s, %v", actual, err)
+	}
+
+	if actual, err := c.Refresh("test", func() ([]byte, error) { return nil, errors.New("unreachable") }); err == nil {
+		t.Errorf("Expected an error rather than the cached response when fetching fails, actual: %s", actual)
+	}
+	if _, err := newTestCache(dir, true, &now).Refresh("test", nil); !errors.Is(err, ErrOffline) {
+		t.Errorf("Expected: %s, actual: %v", ErrOffline, err)
+	}
+}
+
+func TestCacheOffline(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+	if _, err := newTestCache(dir, false, &now).Get("test", func() ([]byte, error) {
+		return []byte(`{"v":1}`), nil
+	}); err != nil {
+		t.Fatalf("Unexpected error from Get: %s", err)
+	}
+
+	now = now.Add(24 * time.Hour)
+	offline := newTestCache(dir, true, &now)
+	fetch := func() ([]byte, error) {
+		t.Errorf("Expected no fetch when offline")
+		return nil, nil
+	}
+	actual, err := offline.Get("test", fetch)
+	if err != nil {
+		t.Fatalf("Unexpected error from Get: %s", err)
+	}
+	if string(actual) != `{"v":1}` {
+		t.Errorf("Expected the expired response when offline, actual: %s", string(actual))
+	}
+	if _, err := offline.Get("missing", fetch); !errors.Is(err, ErrOffline) {
+		t.Errorf("Expected: %s, actual: %v", ErrOffline, err)
+	}
+}
@@ -0,0 +1,140 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	defaultRetries = 3
+	defaultBackoff = 500 * time.Millisecond
+	maxRetryAfter  = 30 * time.Second
+)
+
+// Fetcher makes HTTP GET requests. Requests that fail with 429 or a 5xx status
+// are retried with exponential backoff
+type Fetcher struct {
+	HTTPClient *http.Client
+	Retries    int           // Attempts after the first one
+	Backoff    time.Duration // Delay before the first retry, doubled for each one after
+	Header     http.Header   // Sent with every request, e.g. an Authorization token
+}
+
+// NewFetcher returns a fetcher with a 10 second timeout and 3 retries
+func NewFetcher() Fetcher {
+	return Fetcher{
+		HTTPClient: &http.Client{Timeout: defaultTimeout},
+		Retries:    defaultRetries,
+		Backoff:    defaultBackoff,
+	}
+}
+
+// StatusError is an unexpected HTTP status from fetching name
+type StatusError struct {
+	Name       string
+	Code       int
+	retryAfter time.Duration
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("error calling %s: unexpected HTTP GET return code: %d", e.Name, e.Code)
+}
+
+func (e StatusError) retryable() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+// FetchError is a request that failed, as opposed to a response that can't be
+// used. Callers build without the data when there's no cached response to fall
+// back on, like when offline, so that an unreachable API doesn't fail the build
+type FetchError struct {
+	Err error
+}
+
+func (e FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Get fetches u until it succeeds, fails with an error that isn't worth
+// retrying, or runs out of retries. name describes u in errors, which leave
+// out u itself since it may hold an API key
+func (f Fetcher) Get(ctx context.Context, name, u string) ([]byte, error) {
+	backoff := f.Backoff
+	for attempt := 0; ; attempt++ {
+		b, err := f.get(ctx, name, u)
+		if err == nil {
+			return b, nil
+		}
+		var status StatusError
+		if !errors.As(err, &status) {
+			return nil, fmt.Errorf("error calling %s: %s", name, err)
+		}
+		if !status.retryable() || attempt >= f.Retries {
+			return nil, status
+		}
+		wait := backoff
+		if status.retryAfter > 0 {
+			wait = min(status.retryAfter, maxRetryAfter)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("error calling %s: %s", name, ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func (f Fetcher) get(ctx context.Context, name, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range f.Header {
+		req.Header[k] = v
+	}
+	httpClient := f.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// The error repeats the URL, which may have an API key in it
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, fmt.Errorf("error in HTTP GET: %s", urlErr.Err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, StatusError{Name: name, Code: resp.StatusCode, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error in reading HTTP response body: %s", err)
+	}
+	return b, nil
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds
+func parseRetryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
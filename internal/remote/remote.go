@@ -0,0 +1,108 @@
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/krmckone/lk-site/internal/data"
+)
+
+// Sources fetches data for templates from the URLs in an allow-list, so that a
+// build only depends on the remote data its config declares
+type Sources struct {
+	Fetcher
+	Cache  *Cache
+	Tokens map[string]string // Host to the bearer token sent with its requests, e.g. api.github.com
+	allow  []string
+}
+
+// NewSources returns sources for the URLs in allow. An entry matches a URL
+// exactly, or every URL starting with it when it ends with *, e.g.
+// https://api.github.com/users/krmckone/*
+func NewSources(allow []string, cache *Cache) *Sources {
+	return &Sources{Fetcher: NewFetcher(), Cache: cache, allow: allow}
+}
+
+// Allowed returns whether u is in the allow-list
+func (s *Sources) Allowed(u string) bool {
+	for _, entry := range s.allow {
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok && strings.HasPrefix(u, prefix) {
+			return true
+		} else if entry == u {
+			return true
+		}
+	}
+	return false
+}
+
+// GetJSON returns the JSON document at u
+func (s *Sources) GetJSON(ctx context.Context, u string) (interface{}, error) {
+	return s.get(ctx, u, ".json")
+}
+
+// GetCSV returns the rows of the CSV file at u keyed by its header row, like a
+// CSV file in the data directory
+func (s *Sources) GetCSV(ctx context.Context, u string) (interface{}, error) {
+	return s.get(ctx, u, ".csv")
+}
+
+// get returns the response at u parsed in the format of ext. The response is
+// parsed before it's cached so that one that can't be used never is. It's nil
+// when the build is offline or fetching fails and nothing is cached, which
+// templates treat as having no data so that the site still builds
+func (s *Sources) get(ctx context.Context, u, ext string) (interface{}, error) {
+	if !s.Allowed(u) {
+		return nil, fmt.Errorf("%s is not in remote.allow in the config", u)
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return nil, fmt.Errorf("%s is not an HTTP URL", u)
+	}
+	fetcher := s.Fetcher
+	if token := s.Tokens[parsed.Hostname()]; token != "" {
+		fetcher.Header = http.Header{"Authorization": {fmt.Sprintf("Bearer %s", token)}}
+	}
+	body, err := s.Cache.Get(cacheKey(parsed), func() ([]byte, error) {
+		body, err := fetcher.Get(ctx, u, u)
+		if err != nil {
+			return nil, FetchError{Err: err}
+		}
+		if _, err := data.Parse(u, ext, body); err != nil {
+			return nil, err
+		}
+		return body, nil
+	})
+	var fetchErr FetchError
+	if errors.Is(err, ErrOffline) || errors.As(err, &fetchErr) {
+		log.Printf("No data for %s, building without it: %s", u, err)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return data.Parse(u, ext, body)
+}
+
+// cacheKey names the cached response of u after its host and a hash of the
+// whole URL, which is the same in every build
+func cacheKey(u *url.URL) string {
+	return fmt.Sprintf("%s_%x", u.Hostname(), sha256.Sum256([]byte(u.String())))
+}
+
+// TemplateFuncs returns the template functions for fetching data from sources,
+// e.g. {{ range getJSON "https://api.github.com/users/krmckone/repos" }}
+func TemplateFuncs(sources *Sources) map[string]interface{} {
+	return map[string]interface{}{
+		"getJSON": func(u string) (interface{}, error) {
+			return sources.GetJSON(context.Background(), u)
+		},
+		"getCSV": func(u string) (interface{}, error) {
+			return sources.GetCSV(context.Background(), u)
+		},
+	}
+}
@@ -0,0 +1,200 @@
+package remote
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestServer(requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/repos.json":
+			w.Write([]byte(`[{"name": "lk-site", "stargazers_count": 3}]`))
+		case "/reading.csv":
+			w.Write([]byte("title,url\nLearnOpenGL,https://learnopengl.com/\n"))
+		case "/broken.json":
+			w.Write([]byte("{\n  \"name\": \n}"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestSourcesAllowed(t *testing.T) {
+	sources := NewSources([]string{"https://example.com/data.json", "https://api.github.com/users/krmckone/*"}, nil)
+	cases := []struct {
+		u       string
+		allowed bool
+	}{
+		{"https://example.com/data.json", true},
+		{"https://example.com/data.json?page=2", false},
+		{"https://example.com/other.json", false},
+		{"https://api.github.com/users/krmckone/repos", true},
+		{"https://api.github.com/users/other/repos", false},
+	}
+	for _, c := range cases {
+		if actual := sources.Allowed(c.u); actual != c.allowed {
+			t.Errorf("Allowed(%s) expected: %t, actual: %t", c.u, c.allowed, actual)
+		}
+	}
+}
+
+func TestSourcesGet(t *testing.T) {
+	requests := atomic.Int32{}
+	server := newTestServer(&requests)
+	defer server.Close()
+	dir := t.TempDir()
+	sources := NewSources([]string{server.URL + "/*"}, NewCache(dir, time.Hour, false))
+
+	repos, err := sources.GetJSON(context.Background(), server.URL+"/repos.json")
+	if err != nil {
+		t.Fatalf("Unexpected error from GetJSON: %s", err)
+	}
+	expected := []interface{}{map[string]interface{}{"name": "lk-site", "stargazers_count": 3.0}}
+	if !reflect.DeepEqual(expected, repos) {
+		t.Errorf("Expected: %v, actual: %v", expected, repos)
+	}
+
+	reading, err := sources.GetCSV(context.Background(), server.URL+"/reading.csv")
+	if err != nil {
+		t.Fatalf("Unexpected error from GetCSV: %s", err)
+	}
+	if expected := []map[string]string{{"title": "LearnOpenGL", "url": "https://learnopengl.com/"}}; !reflect.DeepEqual(expected, reading) {
+		t.Errorf("Expected: %v, actual: %v", expected, reading)
+	}
+
+	// Cached responses are used without another request
+	if _, err := sources.GetJSON(context.Background(), server.URL+"/repos.json"); err != nil {
+		t.Fatalf("Unexpected error from GetJSON: %s", err)
+	}
+	if actual := requests.Load(); actual != 2 {
+		t.Errorf("Expected 2 requests, actual: %d", actual)
+	}
+
+	if _, err := sources.GetJSON(context.Background(), "https://example.com/data.json"); err == nil || !strings.Contains(err.Error(), "not in remote.allow") {
+		t.Errorf("Expected an error for a URL that isn't allowed, actual: %v", err)
+	}
+	// A failed request with nothing cached is built without the data
+	missing, err := sources.GetJSON(context.Background(), server.URL+"/missing.json")
+	if err != nil {
+		t.Fatalf("Unexpected error from GetJSON: %s", err)
+	}
+	if missing != nil {
+		t.Errorf("Expected no data for a missing document, actual: %v", missing)
+	}
+}
+
+func TestSourcesParseError(t *testing.T) {
+	requests := atomic.Int32{}
+	server := newTestServer(&requests)
+	defer server.Close()
+	dir := t.TempDir()
+	sources := NewSources([]string{server.URL + "/*"}, NewCache(dir, time.Hour, false))
+
+	u := server.URL + "/broken.json"
+	_, err := sources.GetJSON(context.Background(), u)
+	if expected := u + ":3: "; err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected: %s, actual: %v", expected, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the response not to be cached, actual: %v", entries)
+	}
+}
+
+func TestSourcesOffline(t *testing.T) {
+	requests := atomic.Int32{}
+	server := newTestServer(&requests)
+	defer server.Close()
+	dir := t.TempDir()
+	allow := []string{server.URL + "/*"}
+	u := server.URL + "/repos.json"
+
+	online, err := NewSources(allow, NewCache(dir, time.Hour, false)).GetJSON(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Unexpected error from GetJSON: %s", err)
+	}
+	offline := NewSources(allow, NewCache(dir, time.Hour, true))
+	offline.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		t.Errorf("Expected no request when offline, got %s", r.URL)
+		return nil, http.ErrServerClosed
+	})}
+	replayed, err := offline.GetJSON(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Unexpected error from GetJSON: %s", err)
+	}
+	if !reflect.DeepEqual(online, replayed) {
+		t.Errorf("Expected: %v, actual: %v", online, replayed)
+	}
+
+	missing, err := offline.GetCSV(context.Background(), server.URL+"/reading.csv")
+	if err != nil || missing != nil {
+		t.Errorf("Expected no data offline with nothing cached, actual: %v, %v", missing, err)
+	}
+}
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestSourcesUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	sources := NewSources([]string{server.URL + "/*"}, NewCache(t.TempDir(), time.Hour, false))
+	sources.Backoff = time.Millisecond
+
+	// A page built while the server is failing and nothing is cached is built
+	// without the data
+	tmpl, err := template.New("page").Funcs(TemplateFuncs(sources)).Parse(`{{ range getJSON "` + server.URL + `/repos.json" }}{{ .name }}{{ else }}No repos{{ end }}`)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing the template: %s", err)
+	}
+	actual := strings.Builder{}
+	if err := tmpl.Execute(&actual, nil); err != nil {
+		t.Fatalf("Unexpected error executing the template: %s", err)
+	}
+	if expected := "No repos"; actual.String() != expected {
+		t.Errorf("Expected: %s, actual: %s", expected, actual.String())
+	}
+}
+
+func TestSourcesTokens(t *testing.T) {
+	authorization := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization <- r.Header.Get("Authorization")
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	other := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	sources := NewSources([]string{server.URL + "/*", other + "/*"}, nil)
+	sources.Tokens = map[string]string{"127.0.0.1": "secret"}
+
+	cases := []struct {
+		u      string
+		expect string
+	}{
+		{server.URL + "/repos.json", "Bearer secret"},
+		// The token is only sent to its own host
+		{other + "/repos.json", ""},
+	}
+	for _, c := range cases {
+		if _, err := sources.GetJSON(context.Background(), c.u); err != nil {
+			t.Fatalf("Unexpected error from GetJSON: %s", err)
+		}
+		if actual := <-authorization; actual != c.expect {
+			t.Errorf("Expected: %s, actual: %s", c.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krmckone/lk-site/internal/utils"
+)
+
+const (
+	eventsPath   = "/_lk/events"
+	pollInterval = 500 * time.Millisecond
+)
+
+// clientScript is injected into every HTML page served so that the browser
+// reloads when the site is rebuilt
+var clientScript = fmt.Sprintf(`<script>
+  new EventSource(%q).onmessage = function () { location.reload(); };
+</script>
+`, eventsPath)
+
+// BuildFunc builds the site for a runtime, e.g. templating.TemplateSite
+type BuildFunc func(utils.RuntimeConfig) error
+
+// Server serves the build directory for local development. It rebuilds the site
+// when the assets or configs change and tells open browsers to reload. A failed
+// build is shown as an overlay on the page rather than stopping the server
+type Server struct {
+	runtime utils.RuntimeConfig
+	build   BuildFunc
+
+	buildMu sync.Mutex // Only one build runs at a time
+
+	mu       sync.Mutex
+	buildErr error
+	clients  map[chan struct{}]struct{}
+}
+
+// New returns a server for the build directory of runtime that builds with build
+func New(runtime utils.RuntimeConfig, build BuildFunc) *Server {
+	return &Server{
+		runtime: runtime,
+		build:   build,
+		clients: map[chan struct{}]struct{}{},
+	}
+}
+
+// ListenAndServe builds the site, then serves it on addr while watching for
+// changes until the server fails
+func ListenAndServe(runtime utils.RuntimeConfig, addr string, build BuildFunc) error {
+	s := New(runtime, build)
+	s.Rebuild()
+	go s.Watch(context.Background(), pollInterval)
+	log.Printf("Serving %s on http://localhost%s\n", utils.MakePath(runtime.BuildPath), addr)
+	return http.ListenAndServe(addr, s)
+}
+
+// Rebuild builds the site and tells every connected browser to reload
+func (s *Server) Rebuild() {
+	s.buildMu.Lock()
+	start := time.Now()
+	err := s.build(s.runtime)
+	s.buildMu.Unlock()
+	if err != nil {
+		log.Printf("Error building site: %s", err)
+	} else {
+		log.Printf("Built site in %s", time.Since(start).Round(time.Millisecond))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buildErr = err
+	for client := range s.clients {
+		select {
+		case client <- struct{}{}:
+		default: // A reload is already pending for this client
+		}
+	}
+}
+
+// Watch polls the assets and configs directories every interval and rebuilds
+// the site when anything in them changes, until ctx is done
+func (s *Server) Watch(ctx context.Context, interval time.Duration) {
+	dirs := []string{utils.MakePath(s.runtime.AssetsPath), utils.MakePath(s.runtime.ConfigsPath)}
+	last, err := snapshot(dirs...)
+	if err != nil {
+		log.Printf("Error watching %s: %s", dirs, err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current, err := snapshot(dirs...)
+		if err != nil {
+			log.Printf("Error watching %s: %s", dirs, err)
+			continue
+		}
+		if !maps.Equal(last, current) {
+			last = current
+			s.Rebuild()
+		}
+	}
+}
+
+// fileState is what a change to a file is detected by
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshot records the state of every file under dirs
+func snapshot(dirs ...string) (map[string]fileState, error) {
+	files := map[string]fileState{}
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == eventsPath {
+		s.serveEvents(w, r)
+		return
+	}
+	name := r.URL.Path
+	if strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+	if path.Ext(name) != ".html" {
+		http.FileServer(http.Dir(utils.MakePath(s.runtime.BuildPath))).ServeHTTP(w, r)
+		return
+	}
+	s.servePage(w, name)
+}
+
+// servePage serves an HTML page from the build directory with the reload
+// script, and the build error overlay when the last build failed
+func (s *Server) servePage(w http.ResponseWriter, name string) {
+	s.mu.Lock()
+	buildErr := s.buildErr
+	s.mu.Unlock()
+
+	b, err := os.ReadFile(filepath.Join(utils.MakePath(s.runtime.BuildPath), filepath.FromSlash(path.Clean("/"+name))))
+	status := http.StatusOK
+	if errors.Is(err, os.ErrNotExist) {
+		status = http.StatusNotFound
+		b = []byte(fmt.Sprintf("<!DOCTYPE html>\n<html>\n<body>\n<p>%s not found</p>\n</body>\n</html>\n", html.EscapeString(name)))
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	inject := clientScript
+	if buildErr != nil {
+		inject = overlay(buildErr) + inject
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(injectBeforeBodyEnd(b, []byte(inject)))
+}
+
+// serveEvents streams a server-sent event to the browser after every rebuild
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	client := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.clients[client] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// overlay renders a build error on top of the page
+func overlay(err error) string {
+	return fmt.Sprintf(`<div style="position: fixed; inset: 0; z-index: 2147483647; overflow: auto; padding: 2rem; background: rgba(20, 20, 20, 0.95); color: #ff6b6b; font-family: monospace;">
+  <h2>Build failed</h2>
+  <pre style="white-space: pre-wrap;">%s</pre>
+  <p style="color: #ccc;">The page will reload once the build succeeds.</p>
+</div>
+`, html.EscapeString(err.Error()))
+}
+
+// injectBeforeBodyEnd inserts b before the closing body tag of page, or at the
+// end when there isn't one
+func injectBeforeBodyEnd(page, b []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if i < 0 {
+		return append(page, b...)
+	}
+	injected := make([]byte, 0, len(page)+len(b))
+	injected = append(injected, page[:i]...)
+	injected = append(injected, b...)
+	return append(injected, page[i:]...)
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/krmckone/lk-site/internal/utils"
+)
+
+func NewTestRuntime() utils.RuntimeConfig {
+	return utils.RuntimeConfig{
+		AssetsPath:  "test/assets",
+		BuildPath:   "test/build",
+		ConfigsPath: "test/configs",
+	}
+}
+
+// newTestServer returns a server whose build writes a single index page, or
+// fails with buildErr when it's set
+func newTestServer(t *testing.T, buildErr *error) (*Server, *atomic.Int32) {
+	runtime := NewTestRuntime()
+	t.Cleanup(func() {
+		if err := utils.Clean(utils.MakePath(runtime.BuildPath)); err != nil {
+			t.Errorf("Unexpected error from Clean: %s", err)
+		}
+	})
+	builds := &atomic.Int32{}
+	build := func(runtime utils.RuntimeConfig) error {
+		builds.Add(1)
+		if *buildErr != nil {
+			return *buildErr
+		}
+		if err := utils.Mkdir(runtime.BuildPath); err != nil {
+			return err
+		}
+		return utils.WriteFile(filepath.Join(runtime.BuildPath, "index.html"), []byte("<html><body><p>Index</p></body></html>"))
+	}
+	return New(runtime, build), builds
+}
+
+func get(t *testing.T, s *Server, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	b, err := io.ReadAll(recorder.Result().Body)
+	if err != nil {
+		t.Fatalf("Unexpected error reading response: %s", err)
+	}
+	return recorder.Code, string(b)
+}
+
+func TestServePage(t *testing.T) {
+	var buildErr error
+	s, _ := newTestServer(t, &buildErr)
+	s.Rebuild()
+
+	for _, path := range []string{"/", "/index.html"} {
+		status, body := get(t, s, path)
+		if status != http.StatusOK {
+			t.Errorf("Expected status %d for %s, actual: %d", http.StatusOK, path, status)
+		}
+		if !strings.Contains(body, "<p>Index</p><script>") || !strings.HasSuffix(body, "</script>\n</body></html>") {
+			t.Errorf("Expected the reload script before </body> for %s, actual: %s", path, body)
+		}
+		if strings.Contains(body, "Build failed") {
+			t.Errorf("Expected no build error overlay for %s, actual: %s", path, body)
+		}
+	}
+
+	status, body := get(t, s, "/missing.html")
+	if status != http.StatusNotFound || !strings.Contains(body, eventsPath) {
+		t.Errorf("Expected a not found page with the reload script, actual: %d, %s", status, body)
+	}
+}
+
+func TestServePageBuildError(t *testing.T) {
+	var buildErr error
+	s, _ := newTestServer(t, &buildErr)
+	s.Rebuild()
+
+	buildErr = errors.New("page <index> is broken")
+	s.Rebuild()
+	_, body := get(t, s, "/index.html")
+	if !strings.Contains(body, "Build failed") || !strings.Contains(body, "page &lt;index&gt; is broken") {
+		t.Errorf("Expected the escaped build error overlay, actual: %s", body)
+	}
+	if !strings.Contains(body, "<p>Index</p>") {
+		t.Errorf("Expected the last successful build under the overlay, actual: %s", body)
+	}
+
+	buildErr = nil
+	s.Rebuild()
+	if _, body := get(t, s, "/index.html"); strings.Contains(body, "Build failed") {
+		t.Errorf("Expected the overlay to go away after a successful build, actual: %s", body)
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	var buildErr error
+	s, _ := newTestServer(t, &buildErr)
+	httpServer := httptest.NewServer(s)
+	defer httpServer.Close()
+
+	resp, err := http.Get(httpServer.URL + eventsPath)
+	if err != nil {
+		t.Fatalf("Unexpected error connecting to events: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+
+	// The client is registered once the response headers are sent
+	s.Rebuild()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Unexpected error reading event: %s", err)
+	}
+	if line != "data: reload\n" {
+		t.Errorf("Expected a reload event, actual: %q", line)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	var buildErr error
+	s, builds := newTestServer(t, &buildErr)
+	dir := "test/watch"
+	if err := utils.Mkdir(dir); err != nil {
+		t.Fatalf("Unexpected error from Mkdir: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := utils.Clean(utils.MakePath(dir)); err != nil {
+			t.Errorf("Unexpected error from Clean: %s", err)
+		}
+	})
+	s.runtime.AssetsPath = dir
+	s.runtime.ConfigsPath = dir
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Watch(ctx, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if builds.Load() != 0 {
+		t.Fatalf("Expected no builds without changes, actual: %d", builds.Load())
+	}
+
+	if err := utils.WriteFile(filepath.Join(dir, "page.md"), []byte("changed")); err != nil {
+		t.Fatalf("Unexpected error from WriteFile: %s", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for builds.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if builds.Load() == 0 {
+		t.Errorf("Expected a build after a file changed")
+	}
+}
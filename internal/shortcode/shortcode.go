@@ -0,0 +1,333 @@
+package shortcode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Error is a shortcode or template action that can't be used, at a line of the content it's in
+type Error struct {
+	Line int
+	Err  error
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// Call is a shortcode in a page's content, e.g. {{< figure src="a.png" >}}, or
+// a region of template actions on a templated page
+type Call struct {
+	Name     string
+	Params   map[string]string
+	Inner    string // The content up to its closing {{< /name >}}, for shortcodes that have one
+	Template string // The actions and the text between them, e.g. {{ range .x }}{{ . }}{{ end }}, instead of a shortcode
+	Line     int
+}
+
+// Options controls what Extract takes out of content
+type Options struct {
+	HasInner  func(name string) bool // Reports whether a shortcode uses inner content
+	Templated bool                   // Also takes out template actions, e.g. {{ .page.Title }}
+	Verbatim  []Region               // Parts of the content left as written, like code
+}
+
+// Region is the bytes of content from Start up to Stop
+type Region struct {
+	Start, Stop int
+}
+
+// Extracted is page content with its shortcodes taken out, so that the rest of it
+// can be converted as markdown
+type Extracted struct {
+	Content []byte // The content with a placeholder in place of each call
+	Calls   []Call
+	nonce   string
+	removed []removal
+}
+
+// removal is the newlines taken out of the content along with a shortcode
+type removal struct {
+	line  int // The line of Content with the placeholder
+	lines int
+}
+
+const (
+	opener = "{{<"
+	closer = ">}}"
+)
+
+var (
+	namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+	// keywordPattern finds the keyword of an action, e.g. range in {{- range .x }}
+	keywordPattern = regexp.MustCompile(`^\{\{-?\s*([a-z]+)`)
+	commentPattern = regexp.MustCompile(`^\{\{-?\s*/\*`)
+)
+
+// Extract takes the shortcodes out of content. A shortcode is written
+// {{< name key=value key="quoted value" >}}, and when it uses inner content,
+// it's closed with {{< /name >}} after that content. On a templated page,
+// template actions are taken out too, with everything from an action like
+// {{ range }} to its {{ end }} in one call. Actions and shortcodes after a
+// backslash, e.g. \{{ .page.Title }}, are left as written
+func Extract(content []byte, options Options) (Extracted, error) {
+	sum := sha256.Sum256(content)
+	extracted := Extracted{nonce: fmt.Sprintf("%x", sum[:4])}
+	b := bytes.Buffer{}
+	s := string(content)
+	written := 0
+	for pos := 0; pos < len(s); {
+		next := strings.Index(s[pos:], "{{")
+		if next < 0 {
+			break
+		}
+		start := pos + next
+		if region, ok := within(options.Verbatim, start); ok {
+			pos = max(region.Stop, start+2)
+			continue
+		}
+		if start > 0 && s[start-1] == '\\' {
+			pos = start + 2
+			continue
+		}
+		line := 1 + strings.Count(s[:start], "\n")
+		call := Call{}
+		length := 0
+		var err error
+		switch {
+		case strings.HasPrefix(s[start:], opener):
+			call, length, err = parseShortcode(s[start:], options.HasInner)
+		case options.Templated:
+			call, length, err = parseTemplate(s[start:])
+		default:
+			pos = start + 2
+			continue
+		}
+		if err != nil {
+			return Extracted{}, Error{Line: line, Err: err}
+		}
+		call.Line = line
+		b.WriteString(s[written:start])
+		if lines := strings.Count(s[start:start+length], "\n"); lines > 0 {
+			extracted.removed = append(extracted.removed, removal{line: 1 + bytes.Count(b.Bytes(), []byte("\n")), lines: lines})
+		}
+		b.WriteString(extracted.placeholder(len(extracted.Calls)))
+		extracted.Calls = append(extracted.Calls, call)
+		pos = start + length
+		written = pos
+	}
+	b.WriteString(s[written:])
+	extracted.Content = b.Bytes()
+	return extracted, nil
+}
+
+// within returns the region that offset is in
+func within(regions []Region, offset int) (Region, bool) {
+	for _, region := range regions {
+		if offset >= region.Start && offset < region.Stop {
+			return region, true
+		}
+	}
+	return Region{}, false
+}
+
+// parseShortcode parses the shortcode at the start of s, along with its inner
+// content and closing tag when it has them, and returns it with its length
+func parseShortcode(s string, hasInner func(name string) bool) (Call, int, error) {
+	call, length, err := parseTag(s)
+	if err != nil {
+		return call, 0, err
+	}
+	if strings.HasPrefix(call.Name, "/") {
+		return call, 0, fmt.Errorf("{{< %s >}} closes a shortcode that isn't open", call.Name)
+	}
+	if hasInner != nil && hasInner(call.Name) {
+		closing := regexp.MustCompile(`\{\{<\s*/\s*` + regexp.QuoteMeta(call.Name) + `\s*>\}\}`)
+		loc := closing.FindStringIndex(s[length:])
+		if loc == nil {
+			return call, 0, fmt.Errorf("{{< %s >}} is never closed with {{< /%s >}}", call.Name, call.Name)
+		}
+		call.Inner = s[length : length+loc[0]]
+		length += loc[1]
+	}
+	return call, length, nil
+}
+
+// parseTemplate parses the template actions at the start of s up to the end of
+// the first action that isn't inside an action like {{ if }} or {{ range }},
+// and returns them with their length
+func parseTemplate(s string) (Call, int, error) {
+	depth := 0
+	first := ""
+	pos := 0
+	for {
+		length, err := actionLength(s[pos:])
+		if err != nil {
+			return Call{}, 0, err
+		}
+		keyword := ""
+		if match := keywordPattern.FindStringSubmatch(s[pos:]); match != nil {
+			keyword = match[1]
+		}
+		if first == "" {
+			first = keyword
+		}
+		switch keyword {
+		case "if", "range", "with", "block", "define":
+			depth++
+		case "end":
+			if depth == 0 {
+				return Call{}, 0, errors.New("{{ end }} doesn't end an action")
+			}
+			depth--
+		}
+		pos += length
+		if depth == 0 {
+			return Call{Template: s[:pos]}, pos, nil
+		}
+		next := strings.Index(s[pos:], "{{")
+		if next < 0 {
+			return Call{}, 0, fmt.Errorf("{{ %s }} is never closed with {{ end }}", first)
+		}
+		pos += next
+	}
+}
+
+// actionLength returns the length of the action at the start of s, skipping
+// over comments and quoted strings that could contain }}
+func actionLength(s string) (int, error) {
+	if commentPattern.MatchString(s) {
+		if end := strings.Index(s, "*/"); end >= 0 {
+			if stop := strings.Index(s[end:], "}}"); stop >= 0 {
+				return end + stop + 2, nil
+			}
+		}
+		return 0, errors.New("{{/* is never closed with */}}")
+	}
+	for i := 2; i < len(s); i++ {
+		switch s[i] {
+		case '"', '`', '\'':
+			quote := s[i]
+			for i++; i < len(s) && s[i] != quote; i++ {
+				if s[i] == '\\' && quote != '`' {
+					i++
+				}
+			}
+		case '}':
+			if strings.HasPrefix(s[i:], "}}") {
+				return i + 2, nil
+			}
+		}
+	}
+	return 0, errors.New("{{ is never closed with }}")
+}
+
+// parseTag parses the shortcode tag at the start of s and returns it along with
+// its length. The name of a closing tag starts with /
+func parseTag(s string) (Call, int, error) {
+	i := len(opener)
+	skipSpaces := func() {
+		for i < len(s) && strings.IndexByte(" \t\r\n", s[i]) >= 0 {
+			i++
+		}
+	}
+	skipSpaces()
+	call := Call{Params: map[string]string{}}
+	closing := strings.HasPrefix(s[i:], "/")
+	if closing {
+		i++
+		skipSpaces()
+	}
+	call.Name = namePattern.FindString(s[i:])
+	if call.Name == "" {
+		return call, 0, errors.New("a shortcode needs a name")
+	}
+	i += len(call.Name)
+	if closing {
+		call.Name = "/" + call.Name
+	}
+	for {
+		skipSpaces()
+		if strings.HasPrefix(s[i:], closer) {
+			return call, i + len(closer), nil
+		}
+		key := namePattern.FindString(s[i:])
+		if key == "" || !strings.HasPrefix(s[i+len(key):], "=") {
+			if i == len(s) {
+				return call, 0, fmt.Errorf("{{< %s is never closed with >}}", call.Name)
+			}
+			return call, 0, fmt.Errorf("arguments of %s are written key=value, not %q", call.Name, strings.Fields(s[i:])[0])
+		}
+		i += len(key) + 1
+		value, length, err := parseValue(s[i:])
+		if err != nil {
+			return call, 0, fmt.Errorf("argument %s of %s: %s", key, call.Name, err)
+		}
+		if _, ok := call.Params[key]; ok {
+			return call, 0, fmt.Errorf("argument %s of %s is given more than once", key, call.Name)
+		}
+		call.Params[key] = value
+		i += length
+	}
+}
+
+// parseValue parses the value of an argument at the start of s, which is quoted
+// like a Go string when it has spaces
+func parseValue(s string) (string, int, error) {
+	if strings.HasPrefix(s, `"`) {
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				value, err := strconv.Unquote(s[:i+1])
+				return value, i + 1, err
+			}
+		}
+		return "", 0, errors.New("the quoted value is never closed")
+	}
+	end := 0
+	for end < len(s) && strings.IndexByte(" \t\r\n", s[end]) < 0 && !strings.HasPrefix(s[end:], closer) {
+		end++
+	}
+	if end == 0 {
+		return "", 0, errors.New("no value")
+	}
+	return s[:end], end, nil
+}
+
+// Line returns the line of the content before its shortcodes were taken out for
+// a line of Content
+func (e Extracted) Line(line int) int {
+	original := line
+	for _, r := range e.removed {
+		if r.line < line {
+			original += r.lines
+		}
+	}
+	return original
+}
+
+func (e Extracted) placeholder(i int) string {
+	return fmt.Sprintf("LKSHORTCODE%sN%dE", e.nonce, i)
+}
+
+// Replace returns html with the output of each call in place of its
+// placeholder. A shortcode on a line of its own is a paragraph by itself once
+// converted, and its output replaces the whole paragraph since it's usually a
+// block like a figure
+func (e Extracted) Replace(html string, outputs []string) string {
+	pairs := []string{}
+	for i, output := range outputs {
+		pairs = append(pairs, fmt.Sprintf("<p>%s</p>", e.placeholder(i)), output)
+	}
+	for i, output := range outputs {
+		pairs = append(pairs, e.placeholder(i), output)
+	}
+	return strings.NewReplacer(pairs...).Replace(html)
+}
@@ -0,0 +1,163 @@
+package shortcode
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func hasInner(name string) bool {
+	return name == "note"
+}
+
+func TestExtract(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  string
+		expected []Call
+	}{
+		{
+			"arguments",
+			"Before\n{{< figure src=images/a.png caption=\"A \\\"quoted\\\" caption\" >}}\nAfter",
+			[]Call{{Name: "figure", Params: map[string]string{"src": "images/a.png", "caption": `A "quoted" caption`}, Line: 2}},
+		},
+		{
+			"no arguments or spaces",
+			"{{<shader>}}",
+			[]Call{{Name: "shader", Params: map[string]string{}, Line: 1}},
+		},
+		{
+			"inner content",
+			"# Title\n\n{{< note kind=tip >}}\nSome *text*\n{{< / note >}}\n{{< figure >}}",
+			[]Call{
+				{Name: "note", Params: map[string]string{"kind": "tip"}, Inner: "\nSome *text*\n", Line: 3},
+				{Name: "figure", Params: map[string]string{}, Line: 6},
+			},
+		},
+		{
+			"arguments over lines",
+			"{{< figure\n  src=a.png\n  alt=\"An image\"\n>}}",
+			[]Call{{Name: "figure", Params: map[string]string{"src": "a.png", "alt": "An image"}, Line: 1}},
+		},
+		{
+			"template actions are left alone",
+			"{{ .page.Title }} and {{/* a comment */}}",
+			nil,
+		},
+		{
+			"escaped",
+			"\\{{< figure >}} and {{< figure >}}",
+			[]Call{{Name: "figure", Params: map[string]string{}, Line: 1}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			extracted, err := Extract([]byte(c.content), Options{HasInner: hasInner})
+			if err != nil {
+				t.Fatalf("Unexpected error from Extract: %s", err)
+			}
+			if !reflect.DeepEqual(c.expected, extracted.Calls) {
+				t.Errorf("Expected: %v, actual: %v", c.expected, extracted.Calls)
+			}
+		})
+	}
+}
+
+func TestExtractTemplated(t *testing.T) {
+	content := "# {{ .page.Title }}\n" +
+		"{{- range .Data.books }}\n<li>{{ if .title }}{{ .title }}{{ else }}{{ .url }}{{ end }}</li>\n{{ end -}}\n" +
+		"{{/* {{ end }} */}}{{ printf \"}}\" }}\n" +
+		"```\n{{ .page.Title }}\n```\n" +
+		"\\{{ .page.Title }} {{< figure >}}"
+	verbatim := strings.Index(content, "```\n")
+	extracted, err := Extract([]byte(content), Options{
+		HasInner:  hasInner,
+		Templated: true,
+		Verbatim:  []Region{{Start: verbatim, Stop: verbatim + len("```\n{{ .page.Title }}\n```")}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error from Extract: %s", err)
+	}
+	expected := []Call{
+		{Template: "{{ .page.Title }}", Line: 1},
+		{Template: "{{- range .Data.books }}\n<li>{{ if .title }}{{ .title }}{{ else }}{{ .url }}{{ end }}</li>\n{{ end -}}", Line: 2},
+		{Template: "{{/* {{ end }} */}}", Line: 5},
+		{Template: `{{ printf "}}" }}`, Line: 5},
+		{Name: "figure", Params: map[string]string{}, Line: 9},
+	}
+	if !reflect.DeepEqual(expected, extracted.Calls) {
+		t.Errorf("Expected: %v, actual: %v", expected, extracted.Calls)
+	}
+	// Trim markers only trim inside the actions they're in
+	expectedContent := fmt.Sprintf("# %s\n%s\n%s%s\n```\n{{ .page.Title }}\n```\n\\{{ .page.Title }} %s",
+		extracted.placeholder(0), extracted.placeholder(1), extracted.placeholder(2), extracted.placeholder(3), extracted.placeholder(4))
+	if actual := string(extracted.Content); actual != expectedContent {
+		t.Errorf("Expected: %s, actual: %s", expectedContent, actual)
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	cases := []struct {
+		content  string
+		expected string
+	}{
+		{"Text\n{{< >}}", "line 2: a shortcode needs a name"},
+		{"{{< figure src >}}", `line 1: arguments of figure are written key=value, not "src"`},
+		{"{{< figure src= >}}", "line 1: argument src of figure: no value"},
+		{`{{< figure src="a.png >}}`, "line 1: argument src of figure: the quoted value is never closed"},
+		{"{{< figure src=a.png src=b.png >}}", "line 1: argument src of figure is given more than once"},
+		{"\n\n{{< figure src=a.png", "line 3: {{< figure is never closed with >}}"},
+		{"{{< /figure >}}", "line 1: {{< /figure >}} closes a shortcode that isn't open"},
+		{"{{< note >}}\nText", "line 1: {{< note >}} is never closed with {{< /note >}}"},
+		{"Text\n\n{{ range .x }}\n{{ . }}", "line 3: {{ range }} is never closed with {{ end }}"},
+		{"{{ .x }}{{ end }}", "line 1: {{ end }} doesn't end an action"},
+		{"{{ .x", "line 1: {{ is never closed with }}"},
+		{"{{/* a comment }}", "line 1: {{/* is never closed with */}}"},
+	}
+	for _, c := range cases {
+		_, err := Extract([]byte(c.content), Options{HasInner: hasInner, Templated: true})
+		if err == nil || err.Error() != c.expected {
+			t.Errorf("Expected: %s, actual: %v", c.expected, err)
+		}
+		if !errors.As(err, &Error{}) {
+			t.Errorf("Expected a shortcode error, actual: %v", err)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	extracted, err := Extract([]byte("{{< figure >}}\n\nA {{< note >}}short{{< /note >}} note"), Options{HasInner: hasInner})
+	if err != nil {
+		t.Fatalf("Unexpected error from Extract: %s", err)
+	}
+	// The markdown around the shortcodes is converted before they're replaced
+	html := fmt.Sprintf("<p>%s</p>\n<p>A %s note</p>\n", extracted.placeholder(0), extracted.placeholder(1))
+	expected := "<figure></figure>\n<p>A <em>short</em> note</p>\n"
+	if actual := extracted.Replace(html, []string{"<figure></figure>", "<em>short</em>"}); actual != expected {
+		t.Errorf("Expected: %s, actual: %s", expected, actual)
+	}
+}
+
+func TestLine(t *testing.T) {
+	extracted, err := Extract([]byte("One\n{{< note >}}\nTwo\nThree\n{{< /note >}}\nSix\n{{< figure\n>}} Eight\nNine"), Options{HasInner: hasInner})
+	if err != nil {
+		t.Fatalf("Unexpected error from Extract: %s", err)
+	}
+	cases := []struct {
+		line     int
+		expected int
+	}{
+		{1, 1},
+		{2, 2},
+		{3, 6},
+		{4, 7},
+		{5, 9},
+	}
+	for _, c := range cases {
+		if actual := extracted.Line(c.line); actual != c.expected {
+			t.Errorf("Expected line %d to be %d, actual: %d", c.line, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package sitemap
+
+import (
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	SitemapFile = "sitemap.xml"
+	RobotsFile  = "robots.txt"
+)
+
+// Entry is a single page listed in the sitemap
+type Entry struct {
+	URL     string    // Site relative link to the page
+	LastMod time.Time // Omitted from the sitemap when zero
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	NS      string   `xml:"xmlns,attr"`
+	URLs    []url    `xml:"url"`
+}
+
+type url struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// XML renders the entries as a sitemap with absolute links under baseURL. Entries
+// are sorted by URL so the output doesn't depend on the order pages were read in
+func XML(baseURL string, entries []Entry) ([]byte, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	sorted := slices.Clone(entries)
+	slices.SortFunc(sorted, func(a, b Entry) int {
+		return cmp.Compare(a.URL, b.URL)
+	})
+	set := urlSet{NS: "http://www.sitemaps.org/schemas/sitemap/0.9", URLs: []url{}}
+	for _, entry := range sorted {
+		u := url{Loc: baseURL + entry.URL}
+		if !entry.LastMod.IsZero() {
+			u.LastMod = entry.LastMod.Format(time.RFC3339)
+		}
+		set.URLs = append(set.URLs, u)
+	}
+	b, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+// Robots renders a robots.txt for all user agents that disallows the given
+// paths and points crawlers at the sitemap when sitemapURL is set
+func Robots(disallow []string, sitemapURL string) []byte {
+	b := strings.Builder{}
+	b.WriteString("User-agent: *\n")
+	if len(disallow) == 0 {
+		b.WriteString("Allow: /\n")
+	}
+	for _, path := range disallow {
+		fmt.Fprintf(&b, "Disallow: %s\n", path)
+	}
+	if sitemapURL != "" {
+		fmt.Fprintf(&b, "\nSitemap: %s\n", sitemapURL)
+	}
+	return []byte(b.String())
+}
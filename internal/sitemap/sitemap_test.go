@@ -0,0 +1,56 @@
+package sitemap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestXML(t *testing.T) {
+	entries := []Entry{
+		{URL: "/posts/b.html"},
+		{URL: "/index.html", LastMod: time.Date(2024, 4, 10, 8, 30, 0, 0, time.UTC)},
+	}
+	actual, err := XML("https://example.com/", entries)
+	if err != nil {
+		t.Fatalf("Unexpected error from XML: %s", err)
+	}
+	expect := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>https://example.com/index.html</loc>
+    <lastmod>2024-04-10T08:30:00Z</lastmod>
+  </url>
+  <url>
+    <loc>https://example.com/posts/b.html</loc>
+  </url>
+</urlset>
+`
+	if string(actual) != expect {
+		t.Errorf("Expected: %s, actual: %s", expect, actual)
+	}
+}
+
+func TestRobots(t *testing.T) {
+	cases := []struct {
+		disallow   []string
+		sitemapURL string
+		expect     string
+	}{
+		{
+			nil,
+			"https://example.com/sitemap.xml",
+			"User-agent: *\nAllow: /\n\nSitemap: https://example.com/sitemap.xml\n",
+		},
+		{
+			[]string{"/drafts/", "/tmp/"},
+			"",
+			"User-agent: *\nDisallow: /drafts/\nDisallow: /tmp/\n",
+		},
+	}
+	for _, c := range cases {
+		actual := string(Robots(c.disallow, c.sitemapURL))
+		if actual != c.expect {
+			t.Errorf("Expected: %q, actual: %q", c.expect, actual)
+		}
+	}
+}
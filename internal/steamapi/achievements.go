@@ -0,0 +1,128 @@
+package steamapi
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Achievement is an achievement of a game and whether the player unlocked it
+type Achievement struct {
+	ApiName     string
+	Name        string // Display name from the game's schema
+	Description string
+	Icon        string // URL of the icon, gray when the achievement is locked
+	Hidden      bool
+	Achieved    bool
+	UnlockTime  time.Time // Zero when the achievement is locked
+}
+
+// GameAchievements are a player's achievements for a game
+type GameAchievements struct {
+	AppId        int
+	GameName     string
+	Achievements []Achievement
+	Unlocked     int
+	Total        int
+	Percent      float64 // Unlocked achievements out of 100
+}
+
+type playerAchievementsResponse struct {
+	PlayerStats struct {
+		GameName     string `json:"gameName"`
+		Achievements []struct {
+			ApiName    string `json:"apiname"`
+			Achieved   int    `json:"achieved"`
+			UnlockTime int64  `json:"unlocktime"`
+		} `json:"achievements"`
+	} `json:"playerstats"`
+}
+
+// SchemaAchievement describes an achievement of a game
+type SchemaAchievement struct {
+	Name         string `json:"name"`
+	DisplayName  string `json:"displayName"`
+	Description  string `json:"description"`
+	Hidden       int    `json:"hidden"`
+	Icon         string `json:"icon"`
+	IconGray     string `json:"icongray"`
+	DefaultValue int    `json:"defaultvalue"`
+}
+
+// GameSchema describes the stats and achievements of a game
+type GameSchema struct {
+	GameName           string `json:"gameName"`
+	GameVersion        string `json:"gameVersion"`
+	AvailableGameStats struct {
+		Achievements []SchemaAchievement `json:"achievements"`
+	} `json:"availableGameStats"`
+}
+
+type schemaForGameResponse struct {
+	Game GameSchema `json:"game"`
+}
+
+// GetSchemaForGame returns the achievements of appId with their English names
+// and descriptions
+func (c *Client) GetSchemaForGame(ctx context.Context, appId int) (GameSchema, error) {
+	params := url.Values{}
+	params.Add("appid", strconv.Itoa(appId))
+	params.Add("l", "english")
+	target := schemaForGameResponse{}
+	if _, err := c.getJSON(ctx, fmt.Sprintf("schema_%d", appId), "ISteamUserStats/GetSchemaForGame/v2", params, &target); err != nil {
+		return GameSchema{}, err
+	}
+	return target.Game, nil
+}
+
+// GetPlayerAchievements returns the achievements steamId unlocked in appId
+// along with their names from the game's schema. It returns nil when there's
+// no data, including for games without achievements, for which the API
+// answers with a 400 status
+func (c *Client) GetPlayerAchievements(ctx context.Context, steamId string, appId int) (*GameAchievements, error) {
+	params := url.Values{}
+	params.Add("steamid", steamId)
+	params.Add("appid", strconv.Itoa(appId))
+	target := playerAchievementsResponse{}
+	ok, err := c.getJSON(ctx, fmt.Sprintf("achievements_%s_%d", steamId, appId), "ISteamUserStats/GetPlayerAchievements/v1", params, &target)
+	if err != nil || !ok || len(target.PlayerStats.Achievements) == 0 {
+		return nil, err
+	}
+
+	schema, err := c.GetSchemaForGame(ctx, appId)
+	if err != nil {
+		return nil, err
+	}
+	described := map[string]SchemaAchievement{}
+	for _, a := range schema.AvailableGameStats.Achievements {
+		described[a.Name] = a
+	}
+
+	achievements := &GameAchievements{AppId: appId, GameName: target.PlayerStats.GameName}
+	for _, a := range target.PlayerStats.Achievements {
+		achievement := Achievement{ApiName: a.ApiName, Name: a.ApiName, Achieved: a.Achieved == 1}
+		if d, ok := described[a.ApiName]; ok {
+			achievement.Name = d.DisplayName
+			achievement.Description = d.Description
+			achievement.Hidden = d.Hidden == 1
+			achievement.Icon = d.IconGray
+			if achievement.Achieved {
+				achievement.Icon = d.Icon
+			}
+		}
+		if achievement.Achieved {
+			achievements.Unlocked++
+			if a.UnlockTime > 0 {
+				achievement.UnlockTime = time.Unix(a.UnlockTime, 0)
+			}
+		}
+		achievements.Achievements = append(achievements.Achievements, achievement)
+	}
+	achievements.Total = len(achievements.Achievements)
+	if achievements.Percent, err = truncateFloat(100 * float64(achievements.Unlocked) / float64(achievements.Total)); err != nil {
+		return nil, err
+	}
+	return achievements, nil
+}
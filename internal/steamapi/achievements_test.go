@@ -0,0 +1,67 @@
+package steamapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/krmckone/lk-site/internal/steamtest"
+	"github.com/krmckone/lk-site/internal/utils"
+)
+
+func TestGetPlayerAchievements(t *testing.T) {
+	server := steamtest.NewServer(utils.MakePath("test/steam"))
+	defer server.Close()
+
+	achievements, err := newTestClient(server).GetPlayerAchievements(context.Background(), "76561197988460908", 1145360)
+	if err != nil {
+		t.Fatalf("Unexpected error from GetPlayerAchievements: %s", err)
+	}
+	if achievements == nil {
+		t.Fatalf("Expected achievements for the game")
+	}
+	if achievements.GameName != "Hades" || achievements.Unlocked != 2 || achievements.Total != 4 || achievements.Percent != 50 {
+		t.Errorf("Unexpected totals: %+v", achievements)
+	}
+	expected := Achievement{
+		ApiName:     "AchBeatHades",
+		Name:        "Is There No Escape?",
+		Description: "Beat Hades.",
+		Icon:        "https://example.com/hades/beat.jpg",
+		Achieved:    true,
+		UnlockTime:  time.Unix(1711929600, 0),
+	}
+	if actual := achievements.Achievements[0]; actual != expected {
+		t.Errorf("Expected: %+v, actual: %+v", expected, actual)
+	}
+	locked := achievements.Achievements[3]
+	if locked.Achieved || !locked.Hidden || !locked.UnlockTime.IsZero() || locked.Icon != "https://example.com/hades/secret_gray.jpg" {
+		t.Errorf("Expected a locked hidden achievement, actual: %+v", locked)
+	}
+}
+
+func TestGetPlayerAchievementsWithoutStats(t *testing.T) {
+	server := steamtest.NewServer(utils.MakePath("test/steam"))
+	defer server.Close()
+	// The API answers 400 for games without stats
+	server.FailNext(http.StatusBadRequest)
+
+	achievements, err := newTestClient(server).GetPlayerAchievements(context.Background(), "76561197988460908", 440)
+	if err != nil {
+		t.Fatalf("Unexpected error from GetPlayerAchievements: %s", err)
+	}
+	if achievements != nil {
+		t.Errorf("Expected no achievements, actual: %+v", achievements)
+	}
+
+	// So does any other failed request with nothing cached
+	server.FailNext(http.StatusForbidden)
+	achievements, err = newTestClient(server).GetPlayerAchievements(context.Background(), "76561197988460908", 620)
+	if err != nil {
+		t.Fatalf("Unexpected error from GetPlayerAchievements: %s", err)
+	}
+	if achievements != nil {
+		t.Errorf("Expected no achievements when the API refuses the request, actual: %+v", achievements)
+	}
+}
@@ -0,0 +1,91 @@
+package steamapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/krmckone/lk-site/internal/remote"
+)
+
+// DefaultBaseURL is the Steam Web API
+const DefaultBaseURL = "https://api.steampowered.com"
+
+// errNoAPIKey is returned when there's no key to call the API with
+var errNoAPIKey = errors.New("STEAM_API_KEY variable not present in env")
+
+// Client calls the Steam Web API through Fetcher, and its responses go through
+// Cache
+type Client struct {
+	remote.Fetcher
+	BaseURL string
+	APIKey  string
+	Cache   *remote.Cache
+	refresh bool // Fetch every response rather than using the cached one
+}
+
+// NewClient returns a client for the Steam Web API using apiKey, usually read
+// from the STEAM_API_KEY environment variable
+func NewClient(apiKey string, cache *remote.Cache) *Client {
+	return &Client{
+		Fetcher: remote.NewFetcher(),
+		BaseURL: DefaultBaseURL,
+		APIKey:  apiKey,
+		Cache:   cache,
+	}
+}
+
+// get calls method, e.g. IPlayerService/GetOwnedGames/v1, with params through
+// the cache under key and returns the response body
+func (c *Client) get(ctx context.Context, key, method string, params url.Values) ([]byte, error) {
+	get := c.Cache.Get
+	if c.refresh {
+		get = c.Cache.Refresh
+	}
+	return get(key, func() ([]byte, error) {
+		if c.APIKey == "" {
+			return nil, errNoAPIKey
+		}
+		u, err := url.Parse(fmt.Sprintf("%s/%s/", strings.TrimSuffix(c.BaseURL, "/"), method))
+		if err != nil {
+			return nil, err
+		}
+		query := url.Values{}
+		for k, v := range params {
+			query[k] = v
+		}
+		query.Set("key", c.APIKey)
+		u.RawQuery = query.Encode()
+		body, err := c.Fetcher.Get(ctx, method, u.String())
+		if err != nil {
+			return nil, remote.FetchError{Err: err}
+		}
+		if !json.Valid(body) {
+			return nil, fmt.Errorf("invalid JSON in Steam response %s", key)
+		}
+		return body, nil
+	})
+}
+
+// getJSON decodes the response for method into target. It returns false without
+// an error when there's no response because there's no API key, the build is
+// offline or the request failed, and nothing is cached, which callers treat as
+// having no data so that the site still builds
+func (c *Client) getJSON(ctx context.Context, key, method string, params url.Values, target interface{}) (bool, error) {
+	body, err := c.get(ctx, key, method, params)
+	var fetchErr remote.FetchError
+	if errors.Is(err, errNoAPIKey) || errors.Is(err, remote.ErrOffline) || errors.As(err, &fetchErr) {
+		log.Printf("No Steam data for %s, building without it: %s", key, err)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(body, target); err != nil {
+		return false, fmt.Errorf("error in reading Steam response %s: %s", key, err)
+	}
+	return true, nil
+}
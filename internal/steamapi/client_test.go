@@ -0,0 +1,208 @@
+package steamapi
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krmckone/lk-site/internal/remote"
+	"github.com/krmckone/lk-site/internal/steamtest"
+	"github.com/krmckone/lk-site/internal/utils"
+)
+
+func newTestClient(server *steamtest.Server) *Client {
+	client := NewClient("key", nil)
+	client.BaseURL = server.URL
+	client.Backoff = time.Millisecond
+	return client
+}
+
+func TestClientGetSteamOwnedGames(t *testing.T) {
+	server := steamtest.NewServer(utils.MakePath("test/steam"))
+	defer server.Close()
+
+	games, err := newTestClient(server).GetSteamOwnedGames(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("Unexpected error from GetSteamOwnedGames: %s", err)
+	}
+	if len(games) != 6 || games[0].Name != "Portal 2" || games[0].PlaytimeDeckForever != 540 {
+		t.Errorf("Expected the games from the fixture, actual: %v", games)
+	}
+	expected := []string{"/IPlayerService/GetOwnedGames/v1/"}
+	if actual := server.Requests(); !slices.Equal(expected, actual) {
+		t.Errorf("Expected: %s, actual: %s", expected, actual)
+	}
+}
+
+func TestClientQueryGames(t *testing.T) {
+	server := steamtest.NewServer(utils.MakePath("test/steam"))
+	defer server.Close()
+
+	q := NewGameQuery()
+	q.Platform = PlatformDeck
+	q.Limit = 50
+	games, err := newTestClient(server).QueryGames(context.Background(), "1", q, time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error from QueryGames: %s", err)
+	}
+	names := []string{}
+	for _, game := range games {
+		names = append(names, game.Name)
+	}
+	// Fewer than 50 games were played on the Deck
+	expected := []string{"Hades", "Hollow Knight", "Stardew Valley", "Portal 2"}
+	if !slices.Equal(expected, names) {
+		t.Errorf("Expected: %s, actual: %s", expected, names)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	testCases := []struct {
+		name     string
+		failures []int
+		requests int
+		err      bool
+	}{
+		{"retried after too many requests", []int{http.StatusTooManyRequests}, 2, false},
+		{"retried after server errors", []int{http.StatusBadGateway, http.StatusServiceUnavailable}, 3, false},
+		{"gives up after the retries", []int{500, 500, 500, 500}, 4, true},
+		{"client errors aren't retried", []int{http.StatusForbidden}, 1, true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			server := steamtest.NewServer(utils.MakePath("test/steam"))
+			defer server.Close()
+			server.FailNext(testCase.failures...)
+
+			_, err := newTestClient(server).get(context.Background(), "test", "IPlayerService/GetOwnedGames/v1", nil)
+			if testCase.err != (err != nil) {
+				t.Errorf("Expected error: %t, actual: %v", testCase.err, err)
+			}
+			if actual := len(server.Requests()); actual != testCase.requests {
+				t.Errorf("Expected %d requests, actual: %d", testCase.requests, actual)
+			}
+		})
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	server := steamtest.NewServer(utils.MakePath("test/steam"))
+	defer server.Close()
+	server.FailNext(http.StatusServiceUnavailable)
+	client := newTestClient(server)
+	client.Backoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := client.get(ctx, "test", "IPlayerService/GetOwnedGames/v1", nil)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("Expected the retry to stop with the context, actual: %v", err)
+	}
+}
+
+func TestClientInvalidJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>"))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	client := NewClient("key", remote.NewCache(dir, time.Hour, false))
+	client.BaseURL = server.URL
+
+	if _, err := client.get(context.Background(), "test", "IPlayerService/GetOwnedGames/v1", nil); err == nil {
+		t.Errorf("Expected an error for a response that isn't JSON")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the response not to be cached, actual: %v", entries)
+	}
+}
+
+func TestClientHidesAPIKey(t *testing.T) {
+	client := NewClient("secret", nil)
+	client.BaseURL = "http://127.0.0.1:0"
+	client.Retries = 0
+	_, err := client.get(context.Background(), "test", "IPlayerService/GetOwnedGames/v1", nil)
+	if err == nil {
+		t.Fatalf("Expected an error calling an unreachable API")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("Expected the error to leave out the API key, actual: %s", err)
+	}
+}
+
+func TestGetSteamOwnedGamesCached(t *testing.T) {
+	dir := t.TempDir()
+	cache := remote.NewCache(dir, time.Hour, false)
+	body := `{"response":{"game_count":1,"games":[{"appid":1,"name":"TestGame1","playtime_deck_forever":120}]}}`
+	if _, err := cache.Get("owned_games_1", func() ([]byte, error) { return []byte(body), nil }); err != nil {
+		t.Fatalf("Unexpected error caching a response: %s", err)
+	}
+
+	client := NewClient("", cache)
+	games, err := client.GetSteamOwnedGames(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("Unexpected error from GetSteamOwnedGames: %s", err)
+	}
+	if len(games) != 1 || games[0].Name != "TestGame1" || games[0].PlaytimeDeckForever != 120 {
+		t.Errorf("Expected the cached game, actual: %v", games)
+	}
+
+	// Nothing cached and no key still builds, without any games
+	queried, err := client.QueryGames(context.Background(), "2", NewGameQuery(), time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error from QueryGames: %s", err)
+	}
+	if len(queried) != 0 {
+		t.Errorf("Expected no games, actual: %v", queried)
+	}
+}
+
+func TestClientUnavailable(t *testing.T) {
+	server := steamtest.NewServer(utils.MakePath("test/steam"))
+	defer server.Close()
+	server.FailNext(500, 500, 500, 500)
+	client := newTestClient(server)
+	client.Cache = remote.NewCache(t.TempDir(), time.Hour, false)
+
+	// A page built while the API is failing and nothing is cached is built
+	// without the games
+	tmpl, err := template.New("page").Funcs(TemplateFuncs(client, t.TempDir(), time.Now())).Parse(`{{ range getSteamGames "1" }}{{ .Name }}{{ else }}No games{{ end }}`)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing the template: %s", err)
+	}
+	actual := strings.Builder{}
+	if err := tmpl.Execute(&actual, nil); err != nil {
+		t.Fatalf("Unexpected error executing the template: %s", err)
+	}
+	if expected := "No games"; actual.String() != expected {
+		t.Errorf("Expected: %s, actual: %s", expected, actual.String())
+	}
+	if actual := len(server.Requests()); actual != 4 {
+		t.Errorf("Expected 4 requests, actual: %d", actual)
+	}
+}
+
+func TestTemplateFuncsBuildTime(t *testing.T) {
+	server := steamtest.NewServer(utils.MakePath("test/steam"))
+	defer server.Close()
+
+	// Played within is counted back from the build time rather than the clock
+	now := time.Date(2024, 4, 12, 0, 0, 0, 0, time.UTC)
+	tmpl, err := template.New("page").Funcs(TemplateFuncs(newTestClient(server), t.TempDir(), now)).Parse(`{{ range getSteamGames "1" "playedWithin" "14d" }}{{ .Name }};{{ end }}`)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing the template: %s", err)
+	}
+	actual := strings.Builder{}
+	if err := tmpl.Execute(&actual, nil); err != nil {
+		t.Fatalf("Unexpected error executing the template: %s", err)
+	}
+	if expected := "Hades;Portal 2;"; actual.String() != expected {
+		t.Errorf("Expected: %s, actual: %s", expected, actual.String())
+	}
+}
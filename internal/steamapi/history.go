@@ -0,0 +1,317 @@
+package steamapi
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// historyVersion is the version of the playtime history file format
+	historyVersion = 1
+
+	sparklineWidth  = 100
+	sparklineHeight = 20
+)
+
+// History records playtime over time, since Steam only reports the total
+// playtime of each game. It's kept in a file in the repo that builds add a
+// snapshot to once a day. A snapshot only holds the games whose playtime
+// changed since the snapshot before it, so the file grows with the days games
+// were played rather than with the size of the library
+type History struct {
+	Version   int        `json:"version"`
+	SteamId   string     `json:"steamId"`
+	Snapshots []Snapshot `json:"snapshots"`
+
+	now time.Time
+}
+
+// Snapshot is the playtime of the games played on a day
+type Snapshot struct {
+	Date  string     `json:"date"` // e.g. 2024-04-10
+	Games []Playtime `json:"games"`
+}
+
+// Playtime is the total playtime of a game in minutes on each platform
+type Playtime struct {
+	AppId   int     `json:"appid"`
+	Name    string  `json:"name"`
+	Total   float64 `json:"total"`
+	Windows float64 `json:"windows,omitempty"`
+	Mac     float64 `json:"mac,omitempty"`
+	Linux   float64 `json:"linux,omitempty"`
+	Deck    float64 `json:"deck,omitempty"`
+}
+
+func newPlaytime(g SteamOwnedGame) Playtime {
+	return Playtime{
+		AppId:   g.AppId,
+		Name:    g.Name,
+		Total:   g.PlaytimeForever,
+		Windows: g.PlaytimeWindowsForever,
+		Mac:     g.PlaytimeMacForever,
+		Linux:   g.PlaytimeLinuxForever,
+		Deck:    g.PlaytimeDeckForever,
+	}
+}
+
+func (p Playtime) minutes(platform Platform) (float64, error) {
+	return SteamOwnedGame{
+		PlaytimeForever:        p.Total,
+		PlaytimeWindowsForever: p.Windows,
+		PlaytimeMacForever:     p.Mac,
+		PlaytimeLinuxForever:   p.Linux,
+		PlaytimeDeckForever:    p.Deck,
+	}.minutes(platform)
+}
+
+// Trend is how much a game was played over a window of days
+type Trend struct {
+	AppId      int
+	Name       string
+	Hours      float64 // Playtime within the window
+	TotalHours float64
+}
+
+// HistoryPath returns the path of the playtime history of steamId in dir
+func HistoryPath(dir, steamId string) string {
+	return filepath.Join(dir, fmt.Sprintf("playtime_%s.json", steamId))
+}
+
+// ReadHistory reads the playtime history of steamId from path, which is empty
+// when the file doesn't exist yet. Deltas and sparklines end on the day of now
+func ReadHistory(path, steamId string, now time.Time) (*History, error) {
+	h := &History{Version: historyVersion, SteamId: steamId, Snapshots: []Snapshot{}, now: now}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading playtime history: %s", err)
+	}
+	if err := json.Unmarshal(b, h); err != nil {
+		return nil, fmt.Errorf("error reading playtime history %s: %s", path, err)
+	}
+	if h.Version != historyVersion {
+		return nil, fmt.Errorf("playtime history %s has version %d, expected %d", path, h.Version, historyVersion)
+	}
+	if h.SteamId != steamId {
+		return nil, fmt.Errorf("playtime history %s is for %s, expected %s", path, h.SteamId, steamId)
+	}
+	return h, nil
+}
+
+// Record adds the playtime of games to the snapshot for the day of now,
+// replacing an earlier snapshot from the same day. Returns whether the history
+// changed, which it doesn't when nothing was played since the last snapshot
+func (h *History) Record(games []SteamOwnedGame) bool {
+	date := h.now.Format(time.DateOnly)
+	snapshots := slices.Clone(h.Snapshots)
+	if len(snapshots) > 0 && snapshots[len(snapshots)-1].Date == date {
+		snapshots = snapshots[:len(snapshots)-1]
+	}
+	previous := state(snapshots, date)
+
+	changed := []Playtime{}
+	for _, g := range games {
+		if g.PlaytimeForever <= 0 {
+			continue
+		}
+		if p := newPlaytime(g); previous[g.AppId] != p {
+			changed = append(changed, p)
+		}
+	}
+	slices.SortFunc(changed, func(a, b Playtime) int {
+		return cmp.Compare(a.AppId, b.AppId)
+	})
+	if len(changed) > 0 {
+		snapshots = append(snapshots, Snapshot{Date: date, Games: changed})
+	}
+
+	if slices.EqualFunc(h.Snapshots, snapshots, func(a, b Snapshot) bool {
+		return a.Date == b.Date && slices.Equal(a.Games, b.Games)
+	}) {
+		return false
+	}
+	h.Snapshots = snapshots
+	return true
+}
+
+// Write saves the history to path with one game per line, so that the diff of
+// a new snapshot is easy to review
+func (h *History) Write(path string) error {
+	b := bytes.Buffer{}
+	fmt.Fprintf(&b, "{\n  \"version\": %d,\n  \"steamId\": %q,\n  \"snapshots\": [", h.Version, h.SteamId)
+	for i, snapshot := range h.Snapshots {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, "\n    {\n      \"date\": %q,\n      \"games\": [", snapshot.Date)
+		for j, game := range snapshot.Games {
+			line, err := json.Marshal(game)
+			if err != nil {
+				return fmt.Errorf("error encoding playtime history: %s", err)
+			}
+			if j > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, "\n        %s", line)
+		}
+		b.WriteString("\n      ]\n    }")
+	}
+	b.WriteString("\n  ]\n}\n")
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error making playtime history directory: %s", err)
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing playtime history: %s", err)
+	}
+	return nil
+}
+
+// state returns the playtime of every game as of the end of date
+func state(snapshots []Snapshot, date string) map[int]Playtime {
+	games := map[int]Playtime{}
+	for _, snapshot := range snapshots {
+		if snapshot.Date > date {
+			break
+		}
+		for _, game := range snapshot.Games {
+			games[game.AppId] = game
+		}
+	}
+	return games
+}
+
+// played returns the minutes appId was played on platform between the end of
+// from and the end of to. Days before the first snapshot count as the first
+// snapshot, since the playtime before the history started isn't known
+func (h *History) played(appId int, platform Platform, from, to time.Time) (float64, error) {
+	if len(h.Snapshots) == 0 {
+		return 0, nil
+	}
+	first := h.Snapshots[0].Date
+	fromDate := max(from.Format(time.DateOnly), first)
+	toDate := max(to.Format(time.DateOnly), first)
+	start, err := state(h.Snapshots, fromDate)[appId].minutes(platform)
+	if err != nil {
+		return 0, err
+	}
+	end, err := state(h.Snapshots, toDate)[appId].minutes(platform)
+	if err != nil {
+		return 0, err
+	}
+	return end - start, nil
+}
+
+// Delta returns the hours appId was played on platform in the last days days
+func (h *History) Delta(appId int, platform string, days int) (float64, error) {
+	minutes, err := h.played(appId, Platform(platform), h.now.AddDate(0, 0, -days), h.now)
+	if err != nil {
+		return 0, err
+	}
+	return truncateFloat(minutes / 60.0)
+}
+
+// Trending returns the games played the most on platform in the last days
+// days, at most limit of them when limit is above 0
+func (h *History) Trending(platform string, days, limit int) ([]Trend, error) {
+	trends := []Trend{}
+	for appId, game := range state(h.Snapshots, h.now.Format(time.DateOnly)) {
+		hours, err := h.Delta(appId, platform, days)
+		if err != nil {
+			return nil, err
+		}
+		if hours <= 0 {
+			continue
+		}
+		total, err := game.minutes(Platform(platform))
+		if err != nil {
+			return nil, err
+		}
+		totalHours, err := truncateFloat(total / 60.0)
+		if err != nil {
+			return nil, err
+		}
+		trends = append(trends, Trend{AppId: appId, Name: game.Name, Hours: hours, TotalHours: totalHours})
+	}
+	slices.SortFunc(trends, func(a, b Trend) int {
+		return cmp.Or(cmp.Compare(b.Hours, a.Hours), strings.Compare(a.Name, b.Name), cmp.Compare(a.AppId, b.AppId))
+	})
+	if limit > 0 && len(trends) > limit {
+		trends = trends[:limit]
+	}
+	return trends, nil
+}
+
+// Sparkline renders the minutes appId was played on platform each day for the
+// last days days as an inline SVG line, scaled to the most played day
+func (h *History) Sparkline(appId int, platform string, days int) (template.HTML, error) {
+	if days < 2 {
+		return "", fmt.Errorf("a sparkline needs at least 2 days, got %d", days)
+	}
+	values := make([]float64, days)
+	peak := 0.0
+	for i := range values {
+		day := h.now.AddDate(0, 0, i-days+1)
+		minutes, err := h.played(appId, Platform(platform), day.AddDate(0, 0, -1), day)
+		if err != nil {
+			return "", err
+		}
+		values[i] = minutes
+		peak = max(peak, minutes)
+	}
+
+	points := []string{}
+	for i, v := range values {
+		x := float64(i) * sparklineWidth / float64(days-1)
+		y := float64(sparklineHeight)
+		if peak > 0 {
+			y -= v / peak * sparklineHeight
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	return template.HTML(fmt.Sprintf(
+		`<svg class="sparkline" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" preserveAspectRatio="none" role="img" aria-label="Playtime per day over the last %d days"><polyline fill="none" stroke="currentColor" stroke-width="1" points="%s"/></svg>`,
+		sparklineWidth, sparklineHeight, sparklineWidth, sparklineHeight, days, strings.Join(points, " "),
+	)), nil
+}
+
+// RecordPlaytime adds a snapshot of the games owned by steamId to the history
+// at path for the day of now. The owned games are fetched from the API rather
+// than the cache, since a cached response would be recorded as the playtime of
+// the wrong day. Nothing is recorded when there's no data, e.g. without an API
+// key, offline or when the API fails, so that a Steam outage doesn't fail the
+// build. Only reading and writing the history itself return errors. Returns
+// whether the history changed
+func (c *Client) RecordPlaytime(ctx context.Context, steamId, path string, now time.Time) (bool, error) {
+	fresh := *c
+	fresh.refresh = true
+	games, err := fresh.GetSteamOwnedGames(ctx, steamId)
+	if err != nil {
+		log.Printf("Not recording Steam playtime for %s: %s", steamId, err)
+		return false, nil
+	}
+	if len(games) == 0 {
+		return false, nil
+	}
+	h, err := ReadHistory(path, steamId, now)
+	if err != nil {
+		return false, err
+	}
+	if !h.Record(games) {
+		return false, nil
+	}
+	return true, h.Write(path)
+}
@@ -0,0 +1,305 @@
+package steamapi
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krmckone/lk-site/internal/remote"
+	"github.com/krmckone/lk-site/internal/steamtest"
+	"github.com/krmckone/lk-site/internal/utils"
+)
+
+func day(date string) time.Time {
+	t, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		panic(err)
+	}
+	return t.Add(20 * time.Hour)
+}
+
+// testHistory has Hades played on the Deck on 2024-04-02 and 2024-04-05, and
+// Portal 2 played on 2024-04-05
+func testHistory(t *testing.T) *History {
+	h := &History{Version: historyVersion, SteamId: "1", Snapshots: []Snapshot{}}
+	records := []struct {
+		date  string
+		games []SteamOwnedGame
+	}{
+		{"2024-04-01", []SteamOwnedGame{
+			{AppId: 1145360, Name: "Hades", PlaytimeForever: 600, PlaytimeDeckForever: 300},
+			{AppId: 620, Name: "Portal 2", PlaytimeForever: 120},
+			{AppId: 1, Name: "Unplayed"},
+		}},
+		{"2024-04-02", []SteamOwnedGame{
+			{AppId: 1145360, Name: "Hades", PlaytimeForever: 720, PlaytimeDeckForever: 420},
+			{AppId: 620, Name: "Portal 2", PlaytimeForever: 120},
+		}},
+		{"2024-04-05", []SteamOwnedGame{
+			{AppId: 1145360, Name: "Hades", PlaytimeForever: 780, PlaytimeDeckForever: 480},
+			{AppId: 620, Name: "Portal 2", PlaytimeForever: 300},
+		}},
+	}
+	for _, r := range records {
+		h.now = day(r.date)
+		if !h.Record(r.games) {
+			t.Fatalf("Expected a change recording %s", r.date)
+		}
+	}
+	h.now = day("2024-04-06")
+	return h
+}
+
+func TestHistoryRecord(t *testing.T) {
+	h := testHistory(t)
+	expected := []Snapshot{
+		{Date: "2024-04-01", Games: []Playtime{
+			{AppId: 620, Name: "Portal 2", Total: 120},
+			{AppId: 1145360, Name: "Hades", Total: 600, Deck: 300},
+		}},
+		{Date: "2024-04-02", Games: []Playtime{
+			{AppId: 1145360, Name: "Hades", Total: 720, Deck: 420},
+		}},
+		{Date: "2024-04-05", Games: []Playtime{
+			{AppId: 620, Name: "Portal 2", Total: 300},
+			{AppId: 1145360, Name: "Hades", Total: 780, Deck: 480},
+		}},
+	}
+	if !reflect.DeepEqual(expected, h.Snapshots) {
+		t.Errorf("Expected: %+v, actual: %+v", expected, h.Snapshots)
+	}
+
+	games := []SteamOwnedGame{
+		{AppId: 1145360, Name: "Hades", PlaytimeForever: 780, PlaytimeDeckForever: 480},
+		{AppId: 620, Name: "Portal 2", PlaytimeForever: 300},
+	}
+	if h.Record(games) {
+		t.Errorf("Expected no change when nothing was played")
+	}
+
+	// A later build on the same day replaces that day's snapshot
+	h.now = day("2024-04-05")
+	games[1].PlaytimeForever = 360
+	if !h.Record(games) {
+		t.Fatalf("Expected a change recording the same day again")
+	}
+	last := h.Snapshots[len(h.Snapshots)-1]
+	expectedLast := Snapshot{Date: "2024-04-05", Games: []Playtime{
+		{AppId: 620, Name: "Portal 2", Total: 360},
+		{AppId: 1145360, Name: "Hades", Total: 780, Deck: 480},
+	}}
+	if len(h.Snapshots) != 3 || !reflect.DeepEqual(expectedLast, last) {
+		t.Errorf("Expected: %+v, actual: %+v", expectedLast, h.Snapshots)
+	}
+}
+
+func TestHistoryWriteRead(t *testing.T) {
+	defer utils.Clean("test/history")
+	path := HistoryPath(utils.MakePath("test/history"), "1")
+	h := testHistory(t)
+	if err := h.Write(path); err != nil {
+		t.Fatalf("Unexpected error from Write: %s", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reading the history: %s", err)
+	}
+	if expected := `        {"appid":620,"name":"Portal 2","total":120},`; !strings.Contains(string(b), expected+"\n") {
+		t.Errorf("Expected one game per line, actual: %s", b)
+	}
+
+	read, err := ReadHistory(path, "1", h.now)
+	if err != nil {
+		t.Fatalf("Unexpected error from ReadHistory: %s", err)
+	}
+	if !reflect.DeepEqual(h, read) {
+		t.Errorf("Expected: %+v, actual: %+v", h, read)
+	}
+
+	if _, err := ReadHistory(path, "2", h.now); err == nil {
+		t.Errorf("Expected an error reading another Steam ID's history")
+	}
+	if err := os.WriteFile(path, []byte(`{"version": 2, "steamId": "1", "snapshots": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadHistory(path, "1", h.now); err == nil {
+		t.Errorf("Expected an error reading an unknown version")
+	}
+
+	empty, err := ReadHistory(HistoryPath(utils.MakePath("test/history"), "3"), "3", h.now)
+	if err != nil || len(empty.Snapshots) != 0 {
+		t.Errorf("Expected an empty history when there's no file, actual: %+v, %v", empty, err)
+	}
+}
+
+func TestHistoryDelta(t *testing.T) {
+	h := testHistory(t)
+	cases := []struct {
+		appId    int
+		platform string
+		days     int
+		expected float64
+	}{
+		{1145360, "total", 1, 0},
+		{1145360, "total", 2, 1},
+		{1145360, "total", 7, 3},
+		{1145360, "deck", 7, 3},
+		{620, "total", 7, 3},
+		{620, "deck", 7, 0},
+		{1145360, "total", 365, 3}, // Before the history started
+		{2, "total", 7, 0},
+	}
+	for _, c := range cases {
+		actual, err := h.Delta(c.appId, c.platform, c.days)
+		if err != nil {
+			t.Fatalf("Unexpected error from Delta: %s", err)
+		}
+		if actual != c.expected {
+			t.Errorf("Delta(%d, %s, %d) expected: %v, actual: %v", c.appId, c.platform, c.days, c.expected, actual)
+		}
+	}
+	if _, err := h.Delta(620, "switch", 7); err == nil {
+		t.Errorf("Expected an error for an unknown platform")
+	}
+}
+
+func TestHistoryTrending(t *testing.T) {
+	h := testHistory(t)
+	trends, err := h.Trending("total", 7, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error from Trending: %s", err)
+	}
+	expected := []Trend{
+		{AppId: 1145360, Name: "Hades", Hours: 3, TotalHours: 13},
+		{AppId: 620, Name: "Portal 2", Hours: 3, TotalHours: 5},
+	}
+	if !reflect.DeepEqual(expected, trends) {
+		t.Errorf("Expected: %+v, actual: %+v", expected, trends)
+	}
+
+	trends, err = h.Trending("deck", 2, 5)
+	if err != nil {
+		t.Fatalf("Unexpected error from Trending: %s", err)
+	}
+	if expected := []Trend{{AppId: 1145360, Name: "Hades", Hours: 1, TotalHours: 8}}; !reflect.DeepEqual(expected, trends) {
+		t.Errorf("Expected: %+v, actual: %+v", expected, trends)
+	}
+}
+
+func TestHistorySparkline(t *testing.T) {
+	h := testHistory(t)
+	svg, err := h.Sparkline(1145360, "total", 5)
+	if err != nil {
+		t.Fatalf("Unexpected error from Sparkline: %s", err)
+	}
+	// 2024-04-02 to 2024-04-06, with 120 minutes played on the 2nd and 60 on the 5th
+	if expected := `points="0.0,0.0 25.0,20.0 50.0,20.0 75.0,10.0 100.0,20.0"`; !strings.Contains(string(svg), expected) {
+		t.Errorf("Expected: %s, actual: %s", expected, svg)
+	}
+
+	svg, err = h.Sparkline(2, "total", 3)
+	if err != nil {
+		t.Fatalf("Unexpected error from Sparkline: %s", err)
+	}
+	if expected := `points="0.0,20.0 50.0,20.0 100.0,20.0"`; !strings.Contains(string(svg), expected) {
+		t.Errorf("Expected: %s, actual: %s", expected, svg)
+	}
+
+	if _, err := h.Sparkline(1145360, "total", 1); err == nil {
+		t.Errorf("Expected an error for a single day")
+	}
+}
+
+func TestRecordPlaytime(t *testing.T) {
+	server := steamtest.NewServer(utils.MakePath("test/steam"))
+	defer server.Close()
+	defer utils.Clean("test/history")
+	client := newTestClient(server)
+	path := HistoryPath(utils.MakePath("test/history"), "1")
+	now := day("2024-04-10")
+
+	changed, err := client.RecordPlaytime(context.Background(), "1", path, now)
+	if err != nil || !changed {
+		t.Fatalf("Expected the first snapshot to be recorded, actual: %v, %v", changed, err)
+	}
+	changed, err = client.RecordPlaytime(context.Background(), "1", path, now.AddDate(0, 0, 1))
+	if err != nil || changed {
+		t.Errorf("Expected no change when nothing was played, actual: %v, %v", changed, err)
+	}
+	h, err := ReadHistory(path, "1", now)
+	if err != nil {
+		t.Fatalf("Unexpected error from ReadHistory: %s", err)
+	}
+	if len(h.Snapshots) != 1 || h.Snapshots[0].Date != "2024-04-10" || len(h.Snapshots[0].Games) != 5 {
+		t.Errorf("Expected one snapshot of the played games, actual: %+v", h.Snapshots)
+	}
+
+	// Nor when the API fails, which doesn't fail the build
+	server.FailNext(http.StatusForbidden)
+	failed := HistoryPath(utils.MakePath("test/history"), "3")
+	changed, err = client.RecordPlaytime(context.Background(), "3", failed, now)
+	if err != nil || changed {
+		t.Errorf("Expected nothing recorded when the API fails, actual: %v, %v", changed, err)
+	}
+	if _, err := os.Stat(failed); err == nil {
+		t.Errorf("Expected no history written when the API fails")
+	}
+
+	client.APIKey = ""
+	other := HistoryPath(utils.MakePath("test/history"), "2")
+	changed, err = client.RecordPlaytime(context.Background(), "2", other, now)
+	if err != nil || changed {
+		t.Errorf("Expected nothing recorded without data, actual: %v, %v", changed, err)
+	}
+	if _, err := os.Stat(other); err == nil {
+		t.Errorf("Expected no history written without data")
+	}
+}
+
+func TestRecordPlaytimeCached(t *testing.T) {
+	server := steamtest.NewServer(utils.MakePath("test/steam"))
+	defer server.Close()
+	defer utils.Clean("test/history")
+	client := newTestClient(server)
+	client.Cache = remote.NewCache(t.TempDir(), remote.DefaultCacheTTL, false)
+	path := HistoryPath(utils.MakePath("test/history"), "1")
+	now := day("2024-04-10")
+
+	// A response cached by an earlier build hasn't expired, but it has the
+	// playtime from then
+	stale := `{"response":{"game_count":1,"games":[{"appid":1,"name":"Stale","playtime_forever":60}]}}`
+	if _, err := client.Cache.Get("owned_games_1", func() ([]byte, error) { return []byte(stale), nil }); err != nil {
+		t.Fatalf("Unexpected error from Get: %s", err)
+	}
+	changed, err := client.RecordPlaytime(context.Background(), "1", path, now)
+	if err != nil || !changed {
+		t.Fatalf("Expected a snapshot to be recorded, actual: %v, %v", changed, err)
+	}
+	h, err := ReadHistory(path, "1", now)
+	if err != nil {
+		t.Fatalf("Unexpected error from ReadHistory: %s", err)
+	}
+	if len(h.Snapshots) != 1 || len(h.Snapshots[0].Games) != 5 {
+		t.Errorf("Expected a snapshot of the games from the API, actual: %+v", h.Snapshots)
+	}
+	// Pages rendered after recording show the same playtime
+	games, err := client.GetSteamOwnedGames(context.Background(), "1")
+	if err != nil || len(games) == 1 {
+		t.Errorf("Expected the recorded response to be cached, actual: %+v, %v", games, err)
+	}
+
+	// Without an API key the cached response isn't recorded either
+	client.APIKey = ""
+	other := HistoryPath(utils.MakePath("test/history"), "2")
+	if _, err := client.Cache.Get("owned_games_2", func() ([]byte, error) { return []byte(stale), nil }); err != nil {
+		t.Fatalf("Unexpected error from Get: %s", err)
+	}
+	changed, err = client.RecordPlaytime(context.Background(), "2", other, now)
+	if err != nil || changed {
+		t.Errorf("Expected nothing recorded without an API key, actual: %v, %v", changed, err)
+	}
+}
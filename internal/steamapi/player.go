@@ -0,0 +1,99 @@
+package steamapi
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RecentGame is a game played in the last two weeks
+type RecentGame struct {
+	AppId           int     `json:"appid"`
+	Name            string  `json:"name"`
+	Playtime2Weeks  float64 `json:"playtime_2weeks"`
+	PlaytimeForever float64 `json:"playtime_forever"`
+	ImgIconUrl      string  `json:"img_icon_url"`
+	Hours2Weeks     float64 `json:"-"` // Playtime in the last two weeks in hours
+	HoursForever    float64 `json:"-"`
+}
+
+type recentlyPlayedGamesResponse struct {
+	Response struct {
+		TotalCount int          `json:"total_count"`
+		Games      []RecentGame `json:"games"`
+	} `json:"response"`
+}
+
+// GetRecentlyPlayedGames returns the games steamId played in the last two
+// weeks, most played first
+func (c *Client) GetRecentlyPlayedGames(ctx context.Context, steamId string) ([]RecentGame, error) {
+	params := url.Values{}
+	params.Add("steamid", steamId)
+	target := recentlyPlayedGamesResponse{}
+	ok, err := c.getJSON(ctx, fmt.Sprintf("recent_games_%s", steamId), "IPlayerService/GetRecentlyPlayedGames/v1", params, &target)
+	if err != nil || !ok {
+		return []RecentGame{}, err
+	}
+	games := target.Response.Games
+	for i := range games {
+		if games[i].Hours2Weeks, err = truncateFloat(games[i].Playtime2Weeks / 60.0); err != nil {
+			return []RecentGame{}, err
+		}
+		if games[i].HoursForever, err = truncateFloat(games[i].PlaytimeForever / 60.0); err != nil {
+			return []RecentGame{}, err
+		}
+	}
+	return games, nil
+}
+
+// PlayerSummary is the public profile of a Steam user
+type PlayerSummary struct {
+	SteamId       string `json:"steamid"`
+	PersonaName   string `json:"personaname"`
+	ProfileUrl    string `json:"profileurl"`
+	Avatar        string `json:"avatar"`
+	AvatarMedium  string `json:"avatarmedium"`
+	AvatarFull    string `json:"avatarfull"`
+	PersonaState  int    `json:"personastate"` // 0 is offline, 1 online, 2 busy, 3 away
+	TimeCreated   int64  `json:"timecreated"`
+	LastLogoff    int64  `json:"lastlogoff"`
+	GameId        string `json:"gameid"`        // Set while the user is in a game
+	GameExtraInfo string `json:"gameextrainfo"` // Name of the game the user is in
+}
+
+// Created returns when the account was created, zero when the profile is private
+func (p PlayerSummary) Created() time.Time {
+	if p.TimeCreated == 0 {
+		return time.Time{}
+	}
+	return time.Unix(p.TimeCreated, 0)
+}
+
+type playerSummariesResponse struct {
+	Response struct {
+		Players []PlayerSummary `json:"players"`
+	} `json:"response"`
+}
+
+// GetPlayerSummaries returns the profiles of steamIds. Profiles are returned in
+// the order of steamIds, leaving out any that don't exist
+func (c *Client) GetPlayerSummaries(ctx context.Context, steamIds ...string) ([]PlayerSummary, error) {
+	params := url.Values{}
+	params.Add("steamids", strings.Join(steamIds, ","))
+	target := playerSummariesResponse{}
+	ok, err := c.getJSON(ctx, fmt.Sprintf("player_summaries_%s", strings.Join(steamIds, "_")), "ISteamUser/GetPlayerSummaries/v2", params, &target)
+	if err != nil || !ok {
+		return []PlayerSummary{}, err
+	}
+	players := []PlayerSummary{}
+	for _, steamId := range steamIds {
+		for _, player := range target.Response.Players {
+			if player.SteamId == steamId {
+				players = append(players, player)
+			}
+		}
+	}
+	return players, nil
+}
@@ -0,0 +1,54 @@
+package steamapi
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/krmckone/lk-site/internal/steamtest"
+	"github.com/krmckone/lk-site/internal/utils"
+)
+
+func TestGetRecentlyPlayedGames(t *testing.T) {
+	server := steamtest.NewServer(utils.MakePath("test/steam"))
+	defer server.Close()
+
+	games, err := newTestClient(server).GetRecentlyPlayedGames(context.Background(), "76561197988460908")
+	if err != nil {
+		t.Fatalf("Unexpected error from GetRecentlyPlayedGames: %s", err)
+	}
+	expected := []RecentGame{
+		{AppId: 1145360, Name: "Hades", Playtime2Weeks: 390, PlaytimeForever: 3900, ImgIconUrl: "5f7e9ec7a9c1d8d8b6b0e8a0d3e1b8a6e9b1c2d3", Hours2Weeks: 6.5, HoursForever: 65},
+		{AppId: 620, Name: "Portal 2", Playtime2Weeks: 95, PlaytimeForever: 1820, ImgIconUrl: "2e478fc6874d06ae5baf0d147f6f21203291aa02", Hours2Weeks: 1.58, HoursForever: 30.33},
+	}
+	if !reflect.DeepEqual(expected, games) {
+		t.Errorf("Expected: %+v, actual: %+v", expected, games)
+	}
+}
+
+func TestGetPlayerSummaries(t *testing.T) {
+	server := steamtest.NewServer(utils.MakePath("test/steam"))
+	defer server.Close()
+	client := newTestClient(server)
+
+	players, err := client.GetPlayerSummaries(context.Background(), "1", "76561197988460908")
+	if err != nil {
+		t.Fatalf("Unexpected error from GetPlayerSummaries: %s", err)
+	}
+	if len(players) != 1 || players[0].PersonaName != "krmckone" {
+		t.Fatalf("Expected only the existing player, actual: %+v", players)
+	}
+	if expected := time.Unix(1176940800, 0); !players[0].Created().Equal(expected) {
+		t.Errorf("Expected: %s, actual: %s", expected, players[0].Created())
+	}
+	if !(PlayerSummary{}).Created().IsZero() {
+		t.Errorf("Expected a zero creation time for a private profile")
+	}
+
+	client.APIKey = ""
+	players, err = client.GetPlayerSummaries(context.Background(), "76561197988460908")
+	if err != nil || len(players) != 0 {
+		t.Errorf("Expected no players without a key, actual: %+v, %v", players, err)
+	}
+}
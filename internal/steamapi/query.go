@@ -0,0 +1,231 @@
+package steamapi
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Platform selects which playtime a query filters and sorts games by
+type Platform string
+
+const (
+	PlatformTotal   Platform = "total"
+	PlatformWindows Platform = "windows"
+	PlatformMac     Platform = "mac"
+	PlatformLinux   Platform = "linux"
+	PlatformDeck    Platform = "deck"
+)
+
+// Sort keys for a query
+const (
+	SortPlaytime   = "playtime"
+	SortLastPlayed = "lastPlayed"
+	SortName       = "name"
+)
+
+// Game is an owned game as returned by a query
+type Game struct {
+	SteamOwnedGame
+	Hours      float64   // Playtime in hours on the queried platform
+	LastPlayed time.Time // Zero when the game was never played
+}
+
+// HoursOn returns the playtime in hours on platform, for showing more than one
+// platform's playtime in a table
+func (g Game) HoursOn(platform string) (float64, error) {
+	minutes, err := g.minutes(Platform(platform))
+	if err != nil {
+		return 0, err
+	}
+	return truncateFloat(minutes / 60.0)
+}
+
+// minutes returns the playtime on platform as reported by the API
+func (g SteamOwnedGame) minutes(platform Platform) (float64, error) {
+	switch platform {
+	case PlatformTotal:
+		return g.PlaytimeForever, nil
+	case PlatformWindows:
+		return g.PlaytimeWindowsForever, nil
+	case PlatformMac:
+		return g.PlaytimeMacForever, nil
+	case PlatformLinux:
+		return g.PlaytimeLinuxForever, nil
+	case PlatformDeck:
+		return g.PlaytimeDeckForever, nil
+	}
+	return 0, fmt.Errorf("unknown platform %q, expected one of total, windows, mac, linux or deck", platform)
+}
+
+// GameQuery selects and orders owned games. Only games with playtime on the
+// platform are included
+type GameQuery struct {
+	Platform     Platform
+	MinHours     float64       // Least playtime on the platform for a game to be included
+	PlayedWithin time.Duration // Only games last played within this long of now, when set
+	PlayedAfter  time.Time     // Only games last played after this, when set
+	PlayedBefore time.Time     // Only games last played before this, when set
+	Sort         string        // SortPlaytime, SortLastPlayed or SortName
+	Desc         bool
+	Limit        int // Most games returned, all of them when 0
+}
+
+// NewGameQuery returns the default query, the games most played overall
+func NewGameQuery() GameQuery {
+	return GameQuery{Platform: PlatformTotal, Sort: SortPlaytime, Desc: true}
+}
+
+// ParseGameQuery reads a query from the key and value pairs given to a template
+// function, e.g. "platform" "linux" "limit" 10. The keys are:
+//
+//	platform: total, windows, mac, linux or deck, total by default
+//	minHours: least playtime on the platform
+//	playedWithin: e.g. "30d" or "12h", games last played within this long
+//	playedAfter, playedBefore: dates such as "2024-04-10"
+//	sort: playtime, lastPlayed or name, playtime by default
+//	order: asc or desc, desc by default except when sorting by name
+//	limit: most games returned
+func ParseGameQuery(args ...interface{}) (GameQuery, error) {
+	q := NewGameQuery()
+	if len(args)%2 != 0 {
+		return q, fmt.Errorf("expected key and value pairs, got %d arguments", len(args))
+	}
+	order := ""
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			return q, fmt.Errorf("expected a string key, got %v", args[i])
+		}
+		value := args[i+1]
+		var err error
+		switch key {
+		case "platform":
+			q.Platform = Platform(fmt.Sprint(value))
+			_, err = SteamOwnedGame{}.minutes(q.Platform)
+		case "minHours":
+			q.MinHours, err = toFloat(value)
+		case "limit":
+			var limit float64
+			limit, err = toFloat(value)
+			q.Limit = int(limit)
+			if err == nil && (limit < 0 || limit != float64(q.Limit)) {
+				err = fmt.Errorf("limit must be a whole number of games, got %v", value)
+			}
+		case "playedWithin":
+			q.PlayedWithin, err = parseWithin(fmt.Sprint(value))
+		case "playedAfter":
+			q.PlayedAfter, err = time.Parse(time.DateOnly, fmt.Sprint(value))
+		case "playedBefore":
+			q.PlayedBefore, err = time.Parse(time.DateOnly, fmt.Sprint(value))
+		case "sort":
+			q.Sort = fmt.Sprint(value)
+			if q.Sort != SortPlaytime && q.Sort != SortLastPlayed && q.Sort != SortName {
+				err = fmt.Errorf("unknown sort %q, expected playtime, lastPlayed or name", q.Sort)
+			}
+		case "order":
+			order = strings.ToLower(fmt.Sprint(value))
+			if order != "asc" && order != "desc" {
+				err = fmt.Errorf("unknown order %q, expected asc or desc", order)
+			}
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return q, fmt.Errorf("error in game query %s: %s", key, err)
+		}
+	}
+	q.Desc = q.Sort != SortName
+	if order != "" {
+		q.Desc = order == "desc"
+	}
+	return q, nil
+}
+
+// Query returns the games matching q as of now. Games that sort equally are
+// ordered by name and app ID, so the result doesn't depend on the API's order
+func (q GameQuery) Query(games []SteamOwnedGame, now time.Time) ([]Game, error) {
+	matches := []Game{}
+	for _, g := range games {
+		minutes, err := g.minutes(q.Platform)
+		if err != nil {
+			return nil, err
+		}
+		hours, err := truncateFloat(minutes / 60.0)
+		if err != nil {
+			return nil, err
+		}
+		lastPlayed := time.Time{}
+		if g.RTimeLastPlayed > 0 {
+			lastPlayed = time.Unix(g.RTimeLastPlayed, 0)
+		}
+		if minutes <= 0 || hours < q.MinHours {
+			continue
+		}
+		if q.PlayedWithin > 0 && (lastPlayed.IsZero() || now.Sub(lastPlayed) > q.PlayedWithin) {
+			continue
+		}
+		if !q.PlayedAfter.IsZero() && !lastPlayed.After(q.PlayedAfter) {
+			continue
+		}
+		if !q.PlayedBefore.IsZero() && (lastPlayed.IsZero() || !lastPlayed.Before(q.PlayedBefore)) {
+			continue
+		}
+		g.FormattedTimeLastPlayed = formatLastPlayed(g.RTimeLastPlayed)
+		matches = append(matches, Game{SteamOwnedGame: g, Hours: hours, LastPlayed: lastPlayed})
+	}
+
+	slices.SortFunc(matches, func(a, b Game) int {
+		c := 0
+		switch q.Sort {
+		case SortPlaytime:
+			c = cmp.Compare(a.Hours, b.Hours)
+		case SortLastPlayed:
+			c = a.LastPlayed.Compare(b.LastPlayed)
+		case SortName:
+			c = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}
+		if q.Desc {
+			c = -c
+		}
+		return cmp.Or(c, strings.Compare(a.Name, b.Name), cmp.Compare(a.AppId, b.AppId))
+	})
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+	return matches, nil
+}
+
+func formatLastPlayed(rtime int64) string {
+	lastPlayed := time.Unix(rtime, 0)
+	return fmt.Sprintf("%s %d %d", lastPlayed.Month(), lastPlayed.Day(), lastPlayed.Year())
+}
+
+// parseWithin parses a duration that may also be given in days, e.g. "30d"
+func parseWithin(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("expected a number, got %v", value)
+}
@@ -0,0 +1,132 @@
+package steamapi
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseGameQuery(t *testing.T) {
+	testCases := []struct {
+		name   string
+		args   []interface{}
+		expect GameQuery
+		err    bool
+	}{
+		{"defaults", nil, GameQuery{Platform: PlatformTotal, Sort: SortPlaytime, Desc: true}, false},
+		{
+			"every key",
+			[]interface{}{"platform", "linux", "minHours", 1.5, "limit", 10, "playedWithin", "30d", "playedAfter", "2024-01-01", "playedBefore", "2024-04-10", "sort", "lastPlayed", "order", "asc"},
+			GameQuery{
+				Platform:     PlatformLinux,
+				MinHours:     1.5,
+				PlayedWithin: 30 * 24 * time.Hour,
+				PlayedAfter:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				PlayedBefore: time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC),
+				Sort:         SortLastPlayed,
+				Limit:        10,
+			},
+			false,
+		},
+		{"names sort ascending", []interface{}{"sort", "name"}, GameQuery{Platform: PlatformTotal, Sort: SortName}, false},
+		{"duration", []interface{}{"playedWithin", "12h"}, GameQuery{Platform: PlatformTotal, Sort: SortPlaytime, Desc: true, PlayedWithin: 12 * time.Hour}, false},
+		{"unknown platform", []interface{}{"platform", "switch"}, GameQuery{}, true},
+		{"unknown key", []interface{}{"platforms", "linux"}, GameQuery{}, true},
+		{"missing value", []interface{}{"limit"}, GameQuery{}, true},
+		{"negative limit", []interface{}{"limit", -1}, GameQuery{}, true},
+		{"fractional limit", []interface{}{"limit", 2.5}, GameQuery{}, true},
+		{"invalid date", []interface{}{"playedAfter", "April 10"}, GameQuery{}, true},
+		{"unknown sort", []interface{}{"sort", "appid"}, GameQuery{}, true},
+		{"unknown order", []interface{}{"order", "up"}, GameQuery{}, true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, err := ParseGameQuery(testCase.args...)
+			if testCase.err {
+				if err == nil {
+					t.Errorf("Expected an error, actual: %+v", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error from ParseGameQuery: %s", err)
+			}
+			if !reflect.DeepEqual(testCase.expect, actual) {
+				t.Errorf("Expected: %+v, actual: %+v", testCase.expect, actual)
+			}
+		})
+	}
+}
+
+func TestGameQuery(t *testing.T) {
+	now := time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) int64 {
+		return now.Add(-time.Duration(days) * 24 * time.Hour).Unix()
+	}
+	games := []SteamOwnedGame{
+		{AppId: 1, Name: "Alpha", PlaytimeForever: 600, PlaytimeLinuxForever: 600, RTimeLastPlayed: daysAgo(60)},
+		{AppId: 2, Name: "Bravo", PlaytimeForever: 120, PlaytimeWindowsForever: 60, PlaytimeDeckForever: 60, RTimeLastPlayed: daysAgo(2)},
+		{AppId: 3, Name: "charlie", PlaytimeForever: 300, PlaytimeDeckForever: 300, RTimeLastPlayed: daysAgo(10)},
+		{AppId: 4, Name: "Delta", PlaytimeForever: 120, PlaytimeMacForever: 120, RTimeLastPlayed: daysAgo(400)},
+		{AppId: 5, Name: "Echo"},
+	}
+	testCases := []struct {
+		name   string
+		args   []interface{}
+		expect []string
+	}{
+		{"most played overall", nil, []string{"Alpha", "charlie", "Bravo", "Delta"}},
+		{"most played on the Deck", []interface{}{"platform", "deck"}, []string{"charlie", "Bravo"}},
+		{"most played on Linux", []interface{}{"platform", "linux"}, []string{"Alpha"}},
+		{"limit", []interface{}{"limit", 2}, []string{"Alpha", "charlie"}},
+		{"limit above the number of games", []interface{}{"platform", "deck", "limit", 50}, []string{"charlie", "Bravo"}},
+		{"recently played", []interface{}{"sort", "lastPlayed", "limit", 3}, []string{"Bravo", "charlie", "Alpha"}},
+		{"played within", []interface{}{"playedWithin", "30d"}, []string{"charlie", "Bravo"}},
+		{"played between", []interface{}{"playedAfter", "2024-01-01", "playedBefore", "2024-04-05"}, []string{"Alpha", "charlie"}},
+		{"minimum hours", []interface{}{"minHours", 5}, []string{"Alpha", "charlie"}},
+		{"by name", []interface{}{"sort", "name"}, []string{"Alpha", "Bravo", "charlie", "Delta"}},
+		{"least played", []interface{}{"order", "asc"}, []string{"Bravo", "Delta", "charlie", "Alpha"}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			q, err := ParseGameQuery(testCase.args...)
+			if err != nil {
+				t.Fatalf("Unexpected error from ParseGameQuery: %s", err)
+			}
+			result, err := q.Query(games, now)
+			if err != nil {
+				t.Fatalf("Unexpected error from Query: %s", err)
+			}
+			actual := []string{}
+			for _, g := range result {
+				actual = append(actual, g.Name)
+			}
+			if !slices.Equal(testCase.expect, actual) {
+				t.Errorf("Expected: %s, actual: %s", testCase.expect, actual)
+			}
+		})
+	}
+}
+
+func TestGameHours(t *testing.T) {
+	q := NewGameQuery()
+	q.Platform = PlatformDeck
+	result, err := q.Query([]SteamOwnedGame{{Name: "Game", PlaytimeForever: 125, PlaytimeDeckForever: 5, RTimeLastPlayed: 1712764800}}, time.Now())
+	if err != nil || len(result) != 1 {
+		t.Fatalf("Unexpected result from Query: %v, %v", result, err)
+	}
+	game := result[0]
+	if game.Hours != 0.08 {
+		t.Errorf("Expected: %f, actual: %f", 0.08, game.Hours)
+	}
+	if total, err := game.HoursOn("total"); err != nil || total != 2.08 {
+		t.Errorf("Expected: %f, actual: %f, %v", 2.08, total, err)
+	}
+	if _, err := game.HoursOn("switch"); err == nil {
+		t.Errorf("Expected an error for an unknown platform")
+	}
+	if game.FormattedTimeLastPlayed == "" || game.LastPlayed.Unix() != 1712764800 {
+		t.Errorf("Expected the last played time to be set, actual: %+v", game)
+	}
+}
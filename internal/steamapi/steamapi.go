@@ -1,13 +1,9 @@
 package steamapi
 
 import (
-	"cmp"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
 	"net/url"
-	"os"
-	"slices"
 	"strconv"
 	"time"
 )
@@ -32,77 +28,67 @@ type SteamOwnedGamesResponse struct {
 	}
 }
 
-func GetSteamOwnedGames(steamId string) ([]SteamOwnedGame, error) {
-	steamApiKey, present := os.LookupEnv("STEAM_API_KEY")
-	if !present || steamApiKey == "" {
-		return []SteamOwnedGame{}, fmt.Errorf("STEAM_API_KEY variable not present in env")
-	}
-	baseUrl, err := url.Parse("https://api.steampowered.com/IPlayerService/GetOwnedGames/v1/")
-	if err != nil {
-		return []SteamOwnedGame{}, err
-	}
+// GetSteamOwnedGames returns the games owned by steamId. Responses go through
+// the client's cache, so the last response is used when there's no API key or
+// the API can't be reached. Without a key or network and nothing cached, no
+// games are returned so that the site still builds
+func (c *Client) GetSteamOwnedGames(ctx context.Context, steamId string) ([]SteamOwnedGame, error) {
 	params := url.Values{}
-	params.Add("key", steamApiKey)
 	params.Add("steamid", steamId)
 	params.Add("include_appinfo", "true")
 	params.Add("include_extended_appinfo", "true")
 	params.Add("include_played_free_games", "true")
 	params.Add("include_free_sub", "true")
 	params.Add("skip_unvetted_apps", "true")
-	baseUrl.RawQuery = params.Encode()
-	resp, err := httpGet(baseUrl.String())
-	if err != nil {
-		return []SteamOwnedGame{}, err
-	}
 	target := SteamOwnedGamesResponse{}
-	readHttpRespBody(resp, &target)
-	return target.Response.Games, nil
-}
-
-func GetSteamDeckTop50Games(steamId string) ([]SteamOwnedGame, error) {
-	games, err := GetSteamOwnedGames(steamId)
-	if err != nil {
+	ok, err := c.getJSON(ctx, fmt.Sprintf("owned_games_%s", steamId), "IPlayerService/GetOwnedGames/v1", params, &target)
+	if err != nil || !ok {
 		return []SteamOwnedGame{}, err
 	}
-	if err := ProcessOwnedGames(games); err != nil {
-		return []SteamOwnedGame{}, err
-	}
-	steamDeckGames := filter(games, func(g SteamOwnedGame) bool {
-		if g.PlaytimeDeckForever > 0.0 {
-			return true
-		} else {
-			return false
-		}
-	})
-	slices.SortFunc(steamDeckGames, func(a, b SteamOwnedGame) int {
-		return cmp.Compare(b.PlaytimeDeckForever, a.PlaytimeDeckForever)
-	})
-	return steamDeckGames[:50], nil
+	return target.Response.Games, nil
 }
 
-func GetSteamDeckTop50Wrapper(steamId string) []SteamOwnedGame {
-	games, err := GetSteamDeckTop50Games(steamId)
+// QueryGames returns the games owned by steamId that match q as of now
+func (c *Client) QueryGames(ctx context.Context, steamId string, q GameQuery, now time.Time) ([]Game, error) {
+	games, err := c.GetSteamOwnedGames(ctx, steamId)
 	if err != nil {
-		panic(err)
+		return []Game{}, err
 	}
-	return games
+	return q.Query(games, now)
 }
 
-// For adding any additional processing/formatting to the owned games data
-func ProcessOwnedGames(games []SteamOwnedGame) error {
-	for i := range games {
-		// Steam deck played time from minutes to hours
-		hours := games[i].PlaytimeDeckForever / 60.0
-		truncated, err := truncateFloat(hours)
-		if err != nil {
-			return err
-		}
-		games[i].PlaytimeDeckForever = truncated
-
-		lastPlayed := time.Unix(games[i].RTimeLastPlayed, 0)
-		games[i].FormattedTimeLastPlayed = fmt.Sprintf("%s %d %d", lastPlayed.Month(), lastPlayed.Day(), lastPlayed.Year())
+// TemplateFuncs returns the template functions for Steam data, which call the
+// API with client and read playtime histories from historyDir, as of the build
+// time now. getSteamGames
+// takes a Steam ID followed by the query as key and value pairs, see
+// ParseGameQuery, e.g. {{ range getSteamGames .steamId "platform" "linux" "limit" 10 }}
+func TemplateFuncs(client *Client, historyDir string, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"getSteamGames": func(steamId string, args ...interface{}) ([]Game, error) {
+			q, err := ParseGameQuery(args...)
+			if err != nil {
+				return nil, err
+			}
+			return client.QueryGames(context.Background(), steamId, q, now)
+		},
+		"getSteamRecentGames": func(steamId string) ([]RecentGame, error) {
+			return client.GetRecentlyPlayedGames(context.Background(), steamId)
+		},
+		"getSteamAchievements": func(steamId string, appId int) (*GameAchievements, error) {
+			return client.GetPlayerAchievements(context.Background(), steamId, appId)
+		},
+		// getSteamPlayer returns nil when the profile isn't available
+		"getSteamPlayer": func(steamId string) (*PlayerSummary, error) {
+			players, err := client.GetPlayerSummaries(context.Background(), steamId)
+			if err != nil || len(players) == 0 {
+				return nil, err
+			}
+			return &players[0], nil
+		},
+		"getSteamPlaytimeHistory": func(steamId string) (*History, error) {
+			return ReadHistory(HistoryPath(historyDir, steamId), steamId, now)
+		},
 	}
-	return nil
 }
 
 func truncateFloat(f float64) (float64, error) {
@@ -112,35 +98,3 @@ func truncateFloat(f float64) (float64, error) {
 	}
 	return t, nil
 }
-
-func httpGet(url string) (*http.Response, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected HTTP GET return code: %d", resp.StatusCode)
-	}
-	return resp, nil
-}
-
-func readHttpRespBody(resp *http.Response, target interface{}) error {
-	defer resp.Body.Close()
-	err := json.NewDecoder(resp.Body).Decode(target)
-	if err != nil {
-		return fmt.Errorf("error in reading HTTP response body: %s", err)
-	}
-	return nil
-}
-
-func filter[S ~[]E, E any](s S, f func(E) bool) []E {
-	result := []E{}
-
-	for i := range s {
-		if f(s[i]) {
-			result = append(result, s[i])
-		}
-	}
-
-	return result
-}
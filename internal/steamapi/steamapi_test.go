@@ -6,56 +6,46 @@ import (
 	"time"
 )
 
-func TestProcessOwnedGames(t *testing.T) {
-	now := time.Now()
-	truncated, err := truncateFloat(5 / 60.0)
-	if err != nil {
-		t.Fatalf("Unable to truncate %f: %s", 5/60.0, err)
+func TestTruncateFloat(t *testing.T) {
+	cases := []struct {
+		f      float64
+		expect float64
+	}{
+		{5 / 60.0, 0.08},
+		{100 / 60.0, 1.67},
+		{2.0, 2.0},
+		{0, 0},
 	}
+
+	for i, c := range cases {
+		tName := fmt.Sprintf("%v: %v,%v", i, c.f, c.expect)
+		t.Run(tName, func(t *testing.T) {
+			actual, err := truncateFloat(c.f)
+			if err != nil {
+				t.Fatalf("Unable to truncate %f: %s", c.f, err)
+			}
+			if actual != c.expect {
+				t.Errorf("Expected: %v, actual: %v", c.expect, actual)
+			}
+		})
+	}
+}
+
+func TestFormatLastPlayed(t *testing.T) {
+	now := time.Now()
 	cases := []struct {
-		games  []SteamOwnedGame
-		expect []SteamOwnedGame
+		rtime  int64
+		expect string
 	}{
-		{
-			[]SteamOwnedGame{
-				{
-					1,
-					"TestGame1",
-					100.0,
-					"img_icon_url",
-					0,
-					0,
-					5,
-					5,
-					now.Unix(),
-					"",
-				},
-			},
-			[]SteamOwnedGame{
-				{
-					1,
-					"TestGame1",
-					100.0,
-					"img_icon_url",
-					0,
-					0,
-					5,
-					truncated,
-					time.Now().Unix(),
-					fmt.Sprintf("%s %d %d", now.Month(), now.Day(), now.Year()),
-				},
-			},
-		},
+		{now.Unix(), fmt.Sprintf("%s %d %d", now.Month(), now.Day(), now.Year())},
+		{time.Date(2024, 6, 5, 12, 0, 0, 0, time.Local).Unix(), "June 5 2024"},
 	}
 
 	for i, c := range cases {
-		tName := fmt.Sprintf("%v: %v,%v", i, c.games, c.expect)
+		tName := fmt.Sprintf("%v: %v,%v", i, c.rtime, c.expect)
 		t.Run(tName, func(t *testing.T) {
-			ProcessOwnedGames(c.games)
-			for j := range c.games {
-				if c.games[j] != c.expect[j] {
-					t.Errorf("Expected: %v, actual: %v", c.games[j], c.expect[j])
-				}
+			if actual := formatLastPlayed(c.rtime); actual != c.expect {
+				t.Errorf("Expected: %v, actual: %v", c.expect, actual)
 			}
 		})
 	}
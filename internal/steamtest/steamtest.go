@@ -0,0 +1,113 @@
+package steamtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Handler fakes the Steam Web API with fixture responses from a directory. A
+// request for /IPlayerService/GetOwnedGames/v1/ is answered with the file
+// IPlayerService/GetOwnedGames.json. A request with an appid parameter first
+// looks for a file for that app, e.g. ISteamUserStats/GetSchemaForGame_440.json.
+// Like the real API, requests without a key are forbidden
+type Handler struct {
+	dir string
+
+	mu       sync.Mutex
+	failures []int
+	requests []string
+}
+
+func NewHandler(dir string) *Handler {
+	return &Handler{dir: dir}
+}
+
+// FailNext makes the next requests fail with statuses, one per request, before
+// fixtures are served again
+func (h *Handler) FailNext(statuses ...int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures = append(h.failures, statuses...)
+}
+
+// Requests returns the path of every request made so far
+func (h *Handler) Requests() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string{}, h.requests...)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.requests = append(h.requests, r.URL.Path)
+	status := 0
+	if len(h.failures) > 0 {
+		status, h.failures = h.failures[0], h.failures[1:]
+	}
+	h.mu.Unlock()
+
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if r.URL.Query().Get("key") == "" {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	// The path is /<interface>/<method>/<version>/
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+	names := []string{fmt.Sprintf("%s.json", parts[1])}
+	if appId := r.URL.Query().Get("appid"); appId != "" {
+		names = append([]string{fmt.Sprintf("%s_%s.json", parts[1], appId)}, names...)
+	}
+	for _, name := range names {
+		b, err := os.ReadFile(filepath.Join(h.dir, filepath.Clean("/"+parts[0]), name))
+		if err == nil {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.Write(b)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// Server is a fake Steam Web API listening on a local port
+type Server struct {
+	*httptest.Server
+	*Handler
+}
+
+// NewServer starts a fake Steam Web API serving fixtures from dir. Point a
+// client's base URL at Server.URL and close the server when done
+func NewServer(dir string) *Server {
+	h := NewHandler(dir)
+	return &Server{Server: httptest.NewServer(h), Handler: h}
+}
+
+// transport answers requests with a handler without going over the network
+type transport struct {
+	handler http.Handler
+}
+
+// NewTransport returns a transport answering every request with fixtures from
+// dir, for an http.Client that fakes the Steam Web API without a server
+func NewTransport(dir string) http.RoundTripper {
+	return transport{handler: NewHandler(dir)}
+}
+
+func (t transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	t.handler.ServeHTTP(recorder, r)
+	resp := recorder.Result()
+	resp.Request = r
+	return resp, nil
+}
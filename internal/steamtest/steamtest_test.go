@@ -0,0 +1,66 @@
+package steamtest
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "ISteamUserStats"), 0755)
+	os.WriteFile(filepath.Join(dir, "ISteamUserStats", "GetSchemaForGame.json"), []byte(`{"app":"any"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "ISteamUserStats", "GetSchemaForGame_440.json"), []byte(`{"app":"440"}`), 0644)
+	client := &http.Client{Transport: NewTransport(dir)}
+
+	testCases := []struct {
+		name   string
+		url    string
+		status int
+		body   string
+	}{
+		{"fixture for the method", "http://steam/ISteamUserStats/GetSchemaForGame/v2/?key=k&appid=620", http.StatusOK, `{"app":"any"}`},
+		{"fixture for the app", "http://steam/ISteamUserStats/GetSchemaForGame/v2/?key=k&appid=440", http.StatusOK, `{"app":"440"}`},
+		{"missing key", "http://steam/ISteamUserStats/GetSchemaForGame/v2/?appid=440", http.StatusForbidden, ""},
+		{"missing fixture", "http://steam/IPlayerService/GetOwnedGames/v1/?key=k", http.StatusNotFound, ""},
+		{"outside of the fixtures", "http://steam/../../GetSchemaForGame/v2/?key=k", http.StatusNotFound, ""},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			resp, err := client.Get(testCase.url)
+			if err != nil {
+				t.Fatalf("Unexpected error from Get: %s", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != testCase.status {
+				t.Errorf("Expected: %d, actual: %d", testCase.status, resp.StatusCode)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			if testCase.body != "" && string(b) != testCase.body {
+				t.Errorf("Expected: %s, actual: %s", testCase.body, string(b))
+			}
+		})
+	}
+}
+
+func TestServerFailNext(t *testing.T) {
+	server := NewServer(t.TempDir())
+	defer server.Close()
+	server.FailNext(http.StatusTooManyRequests)
+
+	for _, expected := range []int{http.StatusTooManyRequests, http.StatusForbidden} {
+		resp, err := http.Get(server.URL + "/IPlayerService/GetOwnedGames/v1/")
+		if err != nil {
+			t.Fatalf("Unexpected error from Get: %s", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("Expected: %d, actual: %d", expected, resp.StatusCode)
+		}
+	}
+	if actual := len(server.Requests()); actual != 2 {
+		t.Errorf("Expected 2 requests, actual: %d", actual)
+	}
+}
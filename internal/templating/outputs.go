@@ -0,0 +1,182 @@
+package templating
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/krmckone/lk-site/internal/cache"
+	"github.com/krmckone/lk-site/internal/config"
+	"github.com/krmckone/lk-site/internal/feeds"
+	"github.com/krmckone/lk-site/internal/fingerprint"
+	"github.com/krmckone/lk-site/internal/highlight"
+	"github.com/krmckone/lk-site/internal/page"
+	"github.com/krmckone/lk-site/internal/sitemap"
+	"github.com/krmckone/lk-site/internal/utils"
+)
+
+// writeFeeds writes the RSS, Atom and JSON feeds of the posts section to the
+// root of the build directory. Feeds need absolute links, so they are skipped
+// when the config has no site.baseURL
+func writeFeeds(runtime utils.RuntimeConfig, c config.Config, pages []page.Page, buildCache *cache.Cache) error {
+	if c.Site.BaseURL == "" {
+		log.Printf("Skipping feeds since site.baseURL is not set in %s", filepath.Join(runtime.ConfigsPath, "config.yaml"))
+		return nil
+	}
+	posts := page.Where(pages, "Section", postsSection)
+	for _, p := range posts {
+		if p.Date.IsZero() {
+			log.Printf("Leaving %s out of the feeds since it has no date in its front matter", filepath.Join(p.AssetPath, p.Name+".md"))
+		}
+	}
+	title, _ := c.Template.Params["title"].(string)
+	description, _ := c.Template.Params["subtitle"].(string)
+	feed, err := feeds.NewFeed(title, description, c.Site.Author, c.Site.BaseURL, posts)
+	if err != nil {
+		return err
+	}
+	outputs := []struct {
+		name   string
+		render func() ([]byte, error)
+	}{
+		{feeds.RSSFile, feed.RSS},
+		{feeds.AtomFile, feed.Atom},
+		{feeds.JSONFile, feed.JSON},
+	}
+	for _, output := range outputs {
+		b, err := output.render()
+		if err != nil {
+			return fmt.Errorf("error rendering %s: %s", output.name, err)
+		}
+		if err := utils.WriteFile(filepath.Join(runtime.BuildPath, output.name), b); err != nil {
+			return err
+		}
+		buildCache.Put(output.name, "")
+	}
+	return nil
+}
+
+// writeHighlightStylesheet writes the stylesheet for the classes of highlighted
+// code blocks in the styles set in the config, or the default ones, and returns
+// what it wrote
+func writeHighlightStylesheet(runtime utils.RuntimeConfig, c config.Config, buildCache *cache.Cache) ([]byte, error) {
+	light := cmp.Or(c.Template.Styles.Highlight.Light, highlight.DefaultLightStyle)
+	dark := cmp.Or(c.Template.Styles.Highlight.Dark, highlight.DefaultDarkStyle)
+	b, err := highlight.Stylesheet(light, dark)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering %s: %s", highlight.StylesheetFile, err)
+	}
+	path := filepath.Join(runtime.BuildPath, highlight.StylesheetFile)
+	if err := utils.Mkdir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	if err := utils.WriteFile(path, b); err != nil {
+		return nil, err
+	}
+	buildCache.Put(highlight.StylesheetFile, "")
+	return b, nil
+}
+
+// fingerprintedDirs are the directories of assets that get fingerprinted copies
+var fingerprintedDirs = []string{"css", "js", "shaders"}
+
+// writeAssets writes a fingerprinted copy of each stylesheet, script and shader
+// next to the copy under its own name, along with the stylesheet for
+// highlighted code, and the manifest of them. Pages link to the fingerprinted
+// copies, so they're written before any page is rendered
+func writeAssets(runtime utils.RuntimeConfig, c config.Config, highlightStylesheet []byte, buildCache *cache.Cache) (*fingerprint.Manifest, error) {
+	assets := map[string][]byte{highlight.StylesheetFile: highlightStylesheet}
+	for _, dir := range fingerprintedDirs {
+		files, err := utils.ReadDir(filepath.Join(runtime.AssetsPath, dir))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			name, err := filepath.Rel(runtime.AssetsPath, file)
+			if err != nil {
+				return nil, err
+			}
+			b, err := utils.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			assets[filepath.ToSlash(name)] = b
+		}
+	}
+
+	manifest := fingerprint.NewManifest(c.Assets.Integrity)
+	for name, b := range assets {
+		f := manifest.Add(name, b)
+		key := cache.Hash(b)
+		if buildCache.Fresh(f.Path, key) {
+			continue
+		}
+		path := filepath.Join(runtime.BuildPath, filepath.FromSlash(f.Path))
+		if err := utils.Mkdir(filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+		if err := utils.WriteFile(path, b); err != nil {
+			return nil, err
+		}
+		buildCache.Put(f.Path, key)
+	}
+	b, err := manifest.JSON()
+	if err != nil {
+		return nil, fmt.Errorf("error rendering %s: %s", fingerprint.ManifestFile, err)
+	}
+	if err := utils.WriteFile(filepath.Join(runtime.BuildPath, fingerprint.ManifestFile), b); err != nil {
+		return nil, err
+	}
+	buildCache.Put(fingerprint.ManifestFile, "")
+	return manifest, nil
+}
+
+// writeSitemap writes sitemap.xml for every indexable page along with a robots.txt
+// that points to it. The sitemap needs absolute links, so only robots.txt is
+// written when the config has no site.baseURL
+func writeSitemap(runtime utils.RuntimeConfig, c config.Config, pages []page.Page, buildCache *cache.Cache) error {
+	sitemapURL := ""
+	if c.Site.BaseURL != "" {
+		entries := []sitemap.Entry{}
+		for _, p := range pages {
+			if p.NoIndex {
+				continue
+			}
+			entries = append(entries, sitemap.Entry{URL: p.URL, LastMod: lastModified(p)})
+		}
+		b, err := sitemap.XML(c.Site.BaseURL, entries)
+		if err != nil {
+			return fmt.Errorf("error rendering %s: %s", sitemap.SitemapFile, err)
+		}
+		if err := utils.WriteFile(filepath.Join(runtime.BuildPath, sitemap.SitemapFile), b); err != nil {
+			return err
+		}
+		buildCache.Put(sitemap.SitemapFile, "")
+		sitemapURL = strings.TrimSuffix(c.Site.BaseURL, "/") + "/" + sitemap.SitemapFile
+	} else {
+		log.Printf("Skipping sitemap since site.baseURL is not set in %s", filepath.Join(runtime.ConfigsPath, "config.yaml"))
+	}
+	buildCache.Put(sitemap.RobotsFile, "")
+	return utils.WriteFile(
+		filepath.Join(runtime.BuildPath, sitemap.RobotsFile),
+		sitemap.Robots(c.Site.Robots.Disallow, sitemapURL),
+	)
+}
+
+// lastModified prefers the lastmod declared in front matter, then the last commit
+// to the page's markdown source, then the page's date
+func lastModified(p page.Page) time.Time {
+	if !p.Lastmod.IsZero() {
+		return p.Lastmod
+	}
+	if t := utils.GitLastModified(filepath.Join(p.AssetPath, fmt.Sprintf("%s.md", p.Name))); !t.IsZero() {
+		return t
+	}
+	return p.Date
+}
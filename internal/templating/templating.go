@@ -2,95 +2,677 @@ package templating
 
 import (
 	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	gohtml "html"
 	"html/template"
 	"log"
+	"maps"
+	"net/http"
 	"os"
+	gopath "path"
 	"path/filepath"
+	"reflect"
+	goruntime "runtime"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/krmckone/lk-site/internal/cache"
 	"github.com/krmckone/lk-site/internal/config"
+	"github.com/krmckone/lk-site/internal/data"
+	"github.com/krmckone/lk-site/internal/fingerprint"
+	"github.com/krmckone/lk-site/internal/highlight"
+	"github.com/krmckone/lk-site/internal/images"
+	"github.com/krmckone/lk-site/internal/mathml"
 	"github.com/krmckone/lk-site/internal/page"
+	"github.com/krmckone/lk-site/internal/remote"
+	"github.com/krmckone/lk-site/internal/shortcode"
+	"github.com/krmckone/lk-site/internal/steamapi"
+	"github.com/krmckone/lk-site/internal/steamtest"
+	"github.com/krmckone/lk-site/internal/toc"
 	"github.com/krmckone/lk-site/internal/utils"
 	attributes "github.com/mdigger/goldmark-attributes"
 	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
 )
 
+// postsSection is the directory under assets/pages holding the blog posts
+const postsSection = "posts"
+
+// Site holds data about the whole site for templating. It is available to every
+// page as "site", e.g. {{ range .site.Pages }}
+type Site struct {
+	Pages   []page.Page            // Every page in this build
+	Data    map[string]interface{} // The files under assets/data, also available as "Data"
+	BaseURL string                 // site.baseURL from the config, empty when the feeds aren't written
+}
+
 // BuildSite is for building the site. This includes templating HTML with markdown and
 // putting images in the expected locations in the output
 func TemplateSite(runtime utils.RuntimeConfig) error {
-	utils.SetupBuild(runtime)
+	buildCache, err := openCache(runtime)
+	if err != nil {
+		return err
+	}
+	if err := utils.SetupBuild(runtime, buildCache); err != nil {
+		return err
+	}
 
 	c, err := config.ReadConfig(runtime)
 	if err != nil {
 		return err
 	}
+	// Images are resized before the pages are rendered, since the markup for
+	// an image refers to its variants
+	imageSet, err := images.Process(
+		utils.MakePath(runtime.AssetsPath),
+		utils.MakePath(runtime.BuildPath),
+		c.Images,
+		runtime.Workers,
+		buildCache,
+	)
+	if err != nil {
+		return err
+	}
+	highlightStylesheet, err := writeHighlightStylesheet(runtime, c, buildCache)
+	if err != nil {
+		return err
+	}
+	manifest, err := writeAssets(runtime, c, highlightStylesheet, buildCache)
+	if err != nil {
+		return err
+	}
+
+	pages, err := getAssetPages(runtime, "", "")
+	if err != nil {
+		return err
+	}
+	pages = publishedPages(runtime, pages, runtime.Now())
 
-	pages, err := getAssetPages(runtime, "", c.Template.Params)
+	siteData, err := data.Load(utils.MakePath(filepath.Join(runtime.AssetsPath, "data")))
 	if err != nil {
 		return err
 	}
+	// The Steam playtime histories change with every recording, so they're only
+	// read through getSteamPlaytimeHistory, which renders the pages that call it
+	// again every build, rather than being part of the data every page is keyed by
+	delete(siteData, filepath.Base(steamHistoryDir(runtime)))
 
 	assetTemplatePaths := utils.GetBasePageFiles(runtime)
 
-	// The main content of each page can refer to other templates that are defined separately,
-	// so we need to template the main content as well against any component templates. We'll
-	// pass this list of component files to the setupPageParams function so that it can
-	// template the main content against them
+	// Shortcodes in the main content of each page are templated against the component
+	// templates, so a shortcode can be a thin wrapper around a component
 	componentFiles, err := utils.GetComponentFiles(runtime)
 	if err != nil {
 		return err
 	}
+	shortcodeFiles, err := utils.GetShortcodeFiles(runtime)
+	if err != nil {
+		return err
+	}
+	steam := newSteamClient(runtime)
+	if err := recordPlaytime(runtime, c, steam, runtime.Now()); err != nil {
+		return err
+	}
+	fetchers := fetchFuncs(runtime, steam, newRemoteSources(runtime, c))
+	funcs := templateFuncs(runtime, fetchers, imageSet, manifest)
+	components, err := template.New("components").Funcs(funcs).ParseFiles(componentFiles...)
+	if err != nil {
+		log.Printf("Error parsing files: %s, %s", componentFiles, err)
+		return err
+	}
+	shortcodes, err := parseShortcodes(components, shortcodeFiles)
+	if err != nil {
+		return err
+	}
+
+	gm := newGoldmark()
+	for i := range pages {
+		pages[i].Summary = summarize(gm, pages[i], func(name string) bool { return hasInner(shortcodes, name) })
+	}
+	site := Site{Pages: slices.Clone(pages), Data: siteData, BaseURL: c.Site.BaseURL}
 
 	tmpl := template.New("base_page.html")
-	tmpl, err = tmpl.Funcs(runtime.TemplateFuncs).ParseFiles(assetTemplatePaths...)
+	tmpl, err = tmpl.Funcs(funcs).ParseFiles(assetTemplatePaths...)
 	if err != nil {
 		log.Printf("Error parsing files: %s, %s", assetTemplatePaths, err)
 		return err
 	}
+	layouts, err := parseLayouts(runtime, tmpl)
+	if err != nil {
+		return err
+	}
+	keys, err := newPageKeys(runtime, c, site, imageSet, manifest, slices.Concat(assetTemplatePaths, componentFiles, shortcodeFiles))
+	if err != nil {
+		return err
+	}
 
-	gm := newGoldmark()
-	for _, page := range pages {
-		mdBuffer := bytes.Buffer{}
-		if err := gm.Convert(page.Content, &mdBuffer); err != nil {
+	renderer := siteRenderer{
+		runtime:    runtime,
+		config:     c,
+		site:       site,
+		components: components,
+		shortcodes: shortcodes,
+		images:     imageSet,
+		layouts:    layouts,
+		keys:       keys,
+		buildCache: buildCache,
+		fetchers:   fetchers,
+	}
+	if err := renderer.renderPages(pages); err != nil {
+		return err
+	}
+
+	if err := writeFeeds(runtime, c, pages, buildCache); err != nil {
+		return err
+	}
+	if err := writeSitemap(runtime, c, pages, buildCache); err != nil {
+		return err
+	}
+	if err := buildCache.RemoveStale(); err != nil {
+		return err
+	}
+	return buildCache.Save()
+}
+
+// siteRenderer holds everything shared by the pages of a build
+type siteRenderer struct {
+	runtime    utils.RuntimeConfig
+	config     config.Config
+	site       Site
+	components *template.Template // Cloned for the template actions of templated pages
+	shortcodes *template.Template // The shortcode templates, each named after its file
+	images     *images.Set
+	layouts    map[string]*template.Template
+	keys       pageKeys
+	buildCache *cache.Cache
+	fetchers   template.FuncMap // The template functions that fetch data, see forWorker
+	fetched    *bool            // Set when the page being rendered called one of fetchers
+}
+
+// renderPages renders pages concurrently with runtime.Workers workers, or one per
+// CPU when that isn't set. Each page is written to its own file and its rendered
+// content is stored at its own index, so the output doesn't depend on the number
+// of workers. Every page is attempted and all of their errors are returned
+func (r siteRenderer) renderPages(pages []page.Page) error {
+	workers := r.runtime.Workers
+	if workers < 1 {
+		workers = goruntime.GOMAXPROCS(0)
+	}
+	// The templates are all cloned before any of them are executed, since a
+	// template can't be cloned after that
+	workerRenderers := []siteRenderer{}
+	for range min(workers, len(pages)) {
+		w, err := r.forWorker()
+		if err != nil {
 			return err
 		}
+		workerRenderers = append(workerRenderers, w)
+	}
+	errs := make([]error, len(pages))
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for _, w := range workerRenderers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each worker has its own goldmark instance rather than sharing one
+			gm := newGoldmark()
+			for i := range jobs {
+				if err := w.renderPage(gm, &pages[i]); err != nil {
+					errs[i] = fmt.Errorf("error building %s: %s", pages[i].BuildPath, err)
+				}
+			}
+		}()
+	}
+	for i := range pages {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// forWorker returns a copy of r for a worker of renderPages, with its own clones
+// of the templates in which the fetchers note when a page calls them. A page
+// built from fetched data isn't reused by the next build, since the data may
+// have changed without anything the page's key covers changing
+func (r siteRenderer) forWorker() (siteRenderer, error) {
+	w := r
+	w.fetched = new(bool)
+	funcs := template.FuncMap{}
+	for name, fn := range r.fetchers {
+		funcs[name] = noteCalls(fn, w.fetched)
+	}
+	var err error
+	if w.components, err = r.components.Clone(); err != nil {
+		return w, err
+	}
+	w.components.Funcs(funcs)
+	if w.shortcodes, err = r.shortcodes.Clone(); err != nil {
+		return w, err
+	}
+	w.shortcodes.Funcs(funcs)
+	w.layouts = map[string]*template.Template{}
+	for name, layout := range r.layouts {
+		if w.layouts[name], err = layout.Clone(); err != nil {
+			return w, err
+		}
+		w.layouts[name].Funcs(funcs)
+	}
+	return w, nil
+}
+
+// noteCalls wraps the template function fn so that it sets called whenever
+// it's called
+func noteCalls(fn interface{}, called *bool) interface{} {
+	v := reflect.ValueOf(fn)
+	return reflect.MakeFunc(v.Type(), func(args []reflect.Value) []reflect.Value {
+		*called = true
+		if v.Type().IsVariadic() {
+			return v.CallSlice(args)
+		}
+		return v.Call(args)
+	}).Interface()
+}
 
-		pageParams, err := setupPageParams(
-			runtime,
-			componentFiles,
-			c,
-			mdBuffer.String(),
+// renderPage writes p to its build path unless the build cache has it from a
+// previous build, and fills in its rendered content
+func (r siteRenderer) renderPage(gm goldmark.Markdown, p *page.Page) error {
+	layout, ok := r.layouts[p.Layout]
+	if !ok {
+		return fmt.Errorf("layout %q is not in %s", p.Layout, filepath.Join(r.runtime.AssetsPath, "layouts"))
+	}
+
+	output, err := filepath.Rel(utils.MakePath(r.runtime.BuildPath), p.BuildPath)
+	if err != nil {
+		return err
+	}
+	key := r.keys.key(*p)
+	if r.buildCache.Fresh(output, key) {
+		// The page is stored without the build time, so it's written again
+		// with this build's time. Its content is also needed for outputs
+		// built from every page, like feeds
+		if b, ok := r.buildCache.ReadContent(key); ok {
+			rendered := renderedPage{}
+			if err := json.Unmarshal(b, &rendered); err == nil {
+				return r.writePage(p, rendered)
+			}
+		}
+	}
+
+	*r.fetched = false
+
+	// Shortcodes and template actions are taken out before converting the markdown,
+	// so that their output is never mistaken for markdown, and put back into the
+	// HTML after
+	extracted, err := extract(gm, *p, r.hasInner)
+	if err != nil {
+		return sourceError(*p, extracted, err)
+	}
+	doc := gm.Parser().Parse(text.NewReader(extracted.Content))
+	// Images that were resized are shown as a picture of their variants
+	r.images.Pictures(doc, extracted.Content, p.URL)
+	mdBuffer := bytes.Buffer{}
+	if err := gm.Renderer().Render(&mdBuffer, extracted.Content, doc); err != nil {
+		return sourceError(*p, extracted, err)
+	}
+
+	var contents *toc.TableOfContents
+	if !p.NoTOC {
+		contents = toc.Collect(
+			doc,
+			extracted.Content,
+			cmp.Or(r.config.Template.TableOfContents.MinLevel, toc.DefaultMinLevel),
+			cmp.Or(r.config.Template.TableOfContents.MaxLevel, toc.DefaultMaxLevel),
 		)
-		if err != nil {
-			return err
+	}
+
+	pageParams := setupPageParams(r.config, r.site, *p, contents)
+	pageParams[config.BuildTimeParam] = template.HTML(buildTimePlaceholder)
+	outputs, err := r.renderShortcodes(extracted.Calls, pageParams)
+	if err != nil {
+		return sourceError(*p, extracted, err)
+	}
+	rendered := renderedPage{HTML: extracted.Replace(mdBuffer.String(), outputs)}
+	pageParams["main_content"] = template.HTML(rendered.HTML)
+	pageBuffer := bytes.Buffer{}
+	if err := layout.ExecuteTemplate(&pageBuffer, "base_page.html", pageParams); err != nil {
+		log.Printf("Error executing template: %s, %s", pageParams, err)
+		return err
+	}
+	rendered.Page = pageBuffer.String()
+	if err := r.writePage(p, rendered); err != nil {
+		return err
+	}
+	if *r.fetched {
+		// Only the output is recorded, so that it isn't removed as stale
+		r.buildCache.Put(output, "")
+		return nil
+	}
+	b, err := json.Marshal(rendered)
+	if err != nil {
+		return err
+	}
+	if err := r.buildCache.WriteContent(key, b); err != nil {
+		return err
+	}
+	r.buildCache.Put(output, key)
+	return nil
+}
+
+// buildTimePlaceholder stands in for the build time while a page is rendered,
+// so that the stored page doesn't depend on when it was built
+const buildTimePlaceholder = "lk-site-build-time-placeholder"
+
+// renderedPage is a page as it's stored in the build cache, with
+// buildTimePlaceholder in place of the build time
+type renderedPage struct {
+	HTML string `json:"html"` // The main content, for outputs built from every page
+	Page string `json:"page"` // The whole page
+}
+
+// writePage writes rendered to p's build path and keeps its content, with the
+// build time filled in, so that a page reused from the cache is the same as
+// one rendered by this build
+func (r siteRenderer) writePage(p *page.Page, rendered renderedPage) error {
+	buildTime, _ := r.config.Template.Params[config.BuildTimeParam].(string)
+	p.HTML = strings.ReplaceAll(rendered.HTML, buildTimePlaceholder, buildTime)
+	if err := os.MkdirAll(
+		filepath.Dir(p.BuildPath),
+		os.ModePerm,
+	); err != nil {
+		return err
+	}
+	return os.WriteFile(p.BuildPath, []byte(strings.ReplaceAll(rendered.Page, buildTimePlaceholder, buildTime)), 0644)
+}
+
+func (r siteRenderer) hasInner(name string) bool {
+	return hasInner(r.shortcodes, name)
+}
+
+// hasInner reports whether the shortcode called name uses inner content, which
+// is when its template refers to .Inner
+func hasInner(shortcodes *template.Template, name string) bool {
+	tmpl := shortcodes.Lookup(name + ".html")
+	return tmpl != nil && tmpl.Tree != nil && strings.Contains(tmpl.Tree.Root.String(), ".Inner")
+}
+
+// renderShortcodes executes the template of each call with the page's params.
+// A shortcode also gets its arguments as "Params" and its inner content as
+// "Inner", e.g. {{ .Params.src }} or {{ .page.Title }}
+func (r siteRenderer) renderShortcodes(calls []shortcode.Call, pageParams map[string]interface{}) ([]string, error) {
+	outputs := []string{}
+	for _, call := range calls {
+		if call.Template != "" {
+			output, err := r.renderActions(call.Template, pageParams)
+			if err != nil {
+				return nil, shortcode.Error{Line: call.Line, Err: err}
+			}
+			outputs = append(outputs, output)
+			continue
 		}
-		if err := os.MkdirAll(
-			filepath.Dir(page.BuildPath),
-			os.ModePerm,
-		); err != nil {
-			return err
+		tmpl := r.shortcodes.Lookup(call.Name + ".html")
+		if tmpl == nil {
+			return nil, shortcode.Error{
+				Line: call.Line,
+				Err:  fmt.Errorf("unknown shortcode %s, which would be %s", call.Name, filepath.Join(r.runtime.AssetsPath, "shortcodes", call.Name+".html")),
+			}
 		}
-		file, err := os.Create(page.BuildPath)
-		if err != nil {
-			return err
+		params := maps.Clone(pageParams)
+		params["Params"] = call.Params
+		// The inner content is written by the page's author, so it's trusted
+		// like the raw HTML in markdown
+		params["Inner"] = template.HTML(call.Inner)
+		b := bytes.Buffer{}
+		if err := tmpl.Execute(&b, params); err != nil {
+			return nil, shortcode.Error{Line: call.Line, Err: err}
 		}
-		defer file.Close()
+		outputs = append(outputs, b.String())
+	}
+	return outputs, nil
+}
 
-		if err := tmpl.ExecuteTemplate(file, "base_page.html", pageParams); err != nil {
-			log.Printf("Error executing template: %s, %s", pageParams, err)
-			return err
+// renderActions executes template actions from a templated page against the
+// components, which is parsed into a clone since templates can't be parsed
+// into once they're executed
+func (r siteRenderer) renderActions(actions string, pageParams map[string]interface{}) (string, error) {
+	tmpl, err := r.components.Clone()
+	if err != nil {
+		return "", err
+	}
+	tmpl, err = tmpl.New("content").Parse(actions)
+	if err != nil {
+		return "", err
+	}
+	b := bytes.Buffer{}
+	if err := tmpl.Execute(&b, pageParams); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// extract takes the shortcodes out of the content of p, and its template
+// actions when it's templated. Code and math are left as written, so that a
+// page can show them
+func extract(gm goldmark.Markdown, p page.Page, hasInner func(name string) bool) (shortcode.Extracted, error) {
+	doc := gm.Parser().Parse(text.NewReader(p.Content))
+	verbatim := []shortcode.Region{}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.FencedCodeBlock, *ast.CodeBlock, *mathml.MathBlock:
+			lines := node.Lines()
+			if lines.Len() > 0 {
+				verbatim = append(verbatim, shortcode.Region{Start: lines.At(0).Start, Stop: lines.At(lines.Len() - 1).Stop})
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.CodeSpan:
+			for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+				if t, ok := child.(*ast.Text); ok {
+					verbatim = append(verbatim, shortcode.Region{Start: t.Segment.Start, Stop: t.Segment.Stop})
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		case *mathml.InlineMath:
+			for _, segment := range node.Segments {
+				verbatim = append(verbatim, shortcode.Region{Start: segment.Start, Stop: segment.Stop})
+			}
+			return ast.WalkSkipChildren, nil
 		}
+		return ast.WalkContinue, nil
+	})
+	return shortcode.Extract(p.Content, shortcode.Options{HasInner: hasInner, Templated: p.Templated, Verbatim: verbatim})
+}
+
+// sourceError points an error in the content of p at its line in the page's
+// markdown file, which is counted from the end of the front matter
+func sourceError(p page.Page, extracted shortcode.Extracted, err error) error {
+	source := filepath.Join(p.AssetPath, fmt.Sprintf("%s.md", p.Name))
+	mathErr := mathml.Error{}
+	if errors.As(err, &mathErr) {
+		mathErr.Line = extracted.Line(mathErr.Line) + p.LineOffset
+		return fmt.Errorf("%s: %s", source, mathErr)
+	}
+	shortcodeErr := shortcode.Error{}
+	if errors.As(err, &shortcodeErr) {
+		shortcodeErr.Line += p.LineOffset
+		return fmt.Errorf("%s: %s", source, shortcodeErr)
 	}
+	return err
+}
+
+// openCache opens the build cache for the runtime, which is nil when caching is
+// turned off
+func openCache(runtime utils.RuntimeConfig) (*cache.Cache, error) {
+	if runtime.CachePath == "" {
+		return nil, nil
+	}
+	return cache.Open(
+		utils.MakePath(runtime.CachePath),
+		utils.MakePath(runtime.BuildPath),
+		cache.GeneratorKey(),
+		runtime.Force,
+	)
+}
 
+// newSteamClient returns the Steam API client for the runtime. Its responses
+// are cached with the build, or come from fixtures when the runtime asks for them
+func newSteamClient(runtime utils.RuntimeConfig) *steamapi.Client {
+	if runtime.SteamFixture != "" {
+		// Fixture responses aren't cached so that they can't stand in for real
+		// ones in a later build
+		steam := steamapi.NewClient("fixture", nil)
+		steam.HTTPClient = &http.Client{Transport: steamtest.NewTransport(utils.MakePath(runtime.SteamFixture))}
+		return steam
+	}
+	steamCacheDir := ""
+	if runtime.CachePath != "" {
+		steamCacheDir = filepath.Join(utils.MakePath(runtime.CachePath), "steam")
+	}
+	return steamapi.NewClient(
+		os.Getenv("STEAM_API_KEY"),
+		remote.NewCache(steamCacheDir, remote.DefaultCacheTTL, runtime.Offline),
+	)
+}
+
+// newRemoteSources returns the sources of remote data allowed by the config,
+// whose responses are cached with the build
+func newRemoteSources(runtime utils.RuntimeConfig, c config.Config) *remote.Sources {
+	cacheDir := ""
+	if runtime.CachePath != "" {
+		cacheDir = filepath.Join(utils.MakePath(runtime.CachePath), "remote")
+	}
+	ttl := c.Remote.TTL
+	if ttl <= 0 {
+		ttl = remote.DefaultCacheTTL
+	}
+	sources := remote.NewSources(c.Remote.Allow, remote.NewCache(cacheDir, ttl, runtime.Offline))
+	// Unauthenticated requests to the GitHub API are limited to 60 an hour,
+	// which CI runners share
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		sources.Tokens = map[string]string{"api.github.com": token}
+	}
+	return sources
+}
+
+// steamHistoryDir is where the Steam playtime histories are kept in the repo
+func steamHistoryDir(runtime utils.RuntimeConfig) string {
+	return filepath.Join(utils.MakePath(runtime.AssetsPath), "data", "steam")
+}
+
+// fetchFuncs returns the template functions for the Steam and remote data,
+// which is fetched while rendering rather than read from the assets
+func fetchFuncs(runtime utils.RuntimeConfig, steam *steamapi.Client, sources *remote.Sources) template.FuncMap {
+	funcs := template.FuncMap{}
+	maps.Copy(funcs, steamapi.TemplateFuncs(steam, steamHistoryDir(runtime), runtime.Now()))
+	maps.Copy(funcs, remote.TemplateFuncs(sources))
+	return funcs
+}
+
+// templateFuncs returns runtime.TemplateFuncs along with the functions that
+// depend on the build, like the fetchers of data that is cached with it and
+// the images and fingerprinted assets written for it
+func templateFuncs(runtime utils.RuntimeConfig, fetchers template.FuncMap, imageSet *images.Set, manifest *fingerprint.Manifest) template.FuncMap {
+	funcs := template.FuncMap{}
+	maps.Copy(funcs, runtime.TemplateFuncs)
+	maps.Copy(funcs, fetchers)
+	maps.Copy(funcs, fingerprint.TemplateFuncs(manifest))
+	funcs["lookup"] = data.Lookup
+	funcs["figure"] = imageSet.Figure
+	funcs["image"] = imageSet.Image
+	return funcs
+}
+
+// recordPlaytime adds today's snapshot to the Steam playtime history of the
+// configured Steam ID when the runtime asks for it. Fixture data is never
+// recorded since the history is kept in the repo
+func recordPlaytime(runtime utils.RuntimeConfig, c config.Config, steam *steamapi.Client, now time.Time) error {
+	if !runtime.RecordPlaytime {
+		return nil
+	}
+	steamId, _ := c.Env.Params["steamId"].(string)
+	if steamId == "" || runtime.SteamFixture != "" {
+		log.Printf("Not recording Steam playtime without a Steam ID or with fixtures")
+		return nil
+	}
+	path := steamapi.HistoryPath(steamHistoryDir(runtime), steamId)
+	changed, err := steam.RecordPlaytime(context.Background(), steamId, path, now)
+	if err != nil {
+		return err
+	}
+	if changed {
+		log.Printf("Recorded Steam playtime in %s", path)
+	}
 	return nil
 }
 
-func setupPageParams(runtime utils.RuntimeConfig, componentFiles []string, config config.Config, mainContent string) (map[string]interface{}, error) {
+// pageKeys computes build cache keys for pages. The part of the key shared by
+// every page covers the base page and component templates, the config, the data
+// files, the resized images, the fingerprinted assets, and the metadata of every page since it's available
+// to all of them through .site.Pages.
+// The build time shown in the footer is left out of the config, since it's filled
+// in when a page is written, see renderedPage. Pages built from data fetched while
+// rendering, like the Steam API, are never reused, see forWorker
+type pageKeys struct {
+	shared  string
+	layouts map[string]string // Layout name to the hash of its file
+}
+
+func newPageKeys(runtime utils.RuntimeConfig, c config.Config, site Site, imageSet *images.Set, manifest *fingerprint.Manifest, templateFiles []string) (pageKeys, error) {
+	keys := pageKeys{layouts: map[string]string{}}
+	templates, err := cache.HashFiles(templateFiles...)
+	if err != nil {
+		return keys, err
+	}
+	metadata := []byte{}
+	for _, p := range site.Pages {
+		metadata = append(metadata, pageMetadata(p)...)
+	}
+	// Pages are stored without the build time, see renderedPage
+	c.Template.Params = maps.Clone(c.Template.Params)
+	delete(c.Template.Params, config.BuildTimeParam)
+	keys.shared = cache.Hash([]byte(templates), []byte(fmt.Sprintf("%+v", c)), []byte(fmt.Sprintf("%+v", site.Data)), []byte(imageSet.Key()), []byte(manifest.Key()), metadata)
+
+	layoutFiles, err := utils.GetLayoutFiles(runtime)
+	if err != nil {
+		return keys, err
+	}
+	for _, layoutFile := range layoutFiles {
+		key, err := cache.HashFiles(layoutFile)
+		if err != nil {
+			return keys, err
+		}
+		keys.layouts[layoutName(layoutFile)] = key
+	}
+	return keys, nil
+}
+
+// key is the build cache key for p, which adds its source and layout to the
+// shared key
+func (k pageKeys) key(p page.Page) string {
+	return cache.Hash([]byte(k.shared), []byte(k.layouts[p.Layout]), pageMetadata(p), p.Content)
+}
+
+// pageMetadata is everything about a page other than its content, formatted
+// deterministically for hashing
+func pageMetadata(p page.Page) []byte {
+	p.Content = nil
+	p.HTML = ""
+	return []byte(fmt.Sprintf("%+v\n", p))
+}
+
+func setupPageParams(config config.Config, site Site, p page.Page, contents *toc.TableOfContents) map[string]interface{} {
 	pageParams := map[string]interface{}{}
 	for k, v := range config.Template.Params {
 		pageParams[k] = template.HTML(v.(string))
@@ -98,28 +680,151 @@ func setupPageParams(runtime utils.RuntimeConfig, componentFiles []string, confi
 	for k, v := range config.Env.Params {
 		pageParams[k] = v.(string)
 	}
-	mainContentTemplate, err := template.Must(
-		template.New("main_content").Funcs(runtime.TemplateFuncs).Parse(gohtml.UnescapeString(mainContent)),
-	).ParseFiles(
-		componentFiles...,
-	)
+	// The page's own front matter is available to shortcodes, components
+	// and the base page under "page", e.g. {{ .page.Date }} or {{ .page.Params.key }}
+	pageParams["page"] = p
+	pageParams["site"] = site
+	pageParams["Data"] = site.Data
+	// The table of contents is nil when the page has too few headings or opts
+	// out of it, e.g. {{ with .TableOfContents }}<nav>{{ .HTML }}</nav>{{ end }}
+	pageParams["TableOfContents"] = contents
+	// The title is plain text in both cases so templates escape it the same
+	// way whether it comes from the page or the site
+	title := config.Template.Params["title"].(string)
+	if p.Title != "" {
+		title = p.Title
+	}
+	pageParams["title"] = title
+	return pageParams
+}
+
+// publishedPages filters out the pages that are not part of this build. Drafts
+// and pages with a publish date after now are only kept when the runtime asks
+// for them, which is meant for previewing locally
+func publishedPages(runtime utils.RuntimeConfig, pages []page.Page, now time.Time) []page.Page {
+	published := []page.Page{}
+	for _, p := range pages {
+		if p.Draft && !runtime.BuildDrafts {
+			log.Printf("Skipping draft page %s", p.BuildPath)
+			continue
+		}
+		if p.IsFuture(now) && !runtime.BuildFuture {
+			log.Printf("Skipping page %s scheduled for %s", p.BuildPath, p.PublishDate.Format(time.RFC822))
+			continue
+		}
+		published = append(published, p)
+	}
+	return published
+}
+
+// summarize returns the page's description, falling back to the plain text of
+// the first paragraph in its markdown content other than shortcodes. hasInner
+// reports whether a shortcode uses inner content
+func summarize(gm goldmark.Markdown, p page.Page, hasInner func(name string) bool) string {
+	if p.Description != "" {
+		return p.Description
+	}
+	// A shortcode that can't be extracted fails the page's build instead
+	extracted, err := extract(gm, p, hasInner)
+	if err != nil {
+		return ""
+	}
+	// The inner content of a shortcode is kept since it's usually part of the
+	// writing, and template actions are left out
+	inner := []string{}
+	for _, call := range extracted.Calls {
+		inner = append(inner, call.Inner)
+	}
+	doc := gm.Parser().Parse(text.NewReader(extracted.Content))
+	summary := ""
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering && n.Kind() == ast.KindParagraph {
+			summary = extracted.Replace(paragraphText(n, extracted.Content), inner)
+			if summary = strings.TrimSpace(summary); summary != "" {
+				return ast.WalkStop, nil
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return summary
+}
+
+// paragraphText returns the plain text of a paragraph, with its lines joined by spaces
+func paragraphText(paragraph ast.Node, source []byte) string {
+	summary := strings.Builder{}
+	ast.Walk(paragraph, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Text:
+			summary.Write(node.Value(source))
+			if node.SoftLineBreak() || node.HardLineBreak() {
+				summary.WriteString(" ")
+			}
+		case *ast.String:
+			summary.Write(node.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(summary.String())
+}
+
+// parseShortcodes parses each shortcode file on top of a clone of the components,
+// so that shortcodes can use them, e.g. {{ template "linkList" .Params.items }}
+func parseShortcodes(components *template.Template, shortcodeFiles []string) (*template.Template, error) {
+	shortcodes, err := components.Clone()
 	if err != nil {
 		return nil, err
 	}
-	mainContentBuffer := bytes.Buffer{}
-	if err := mainContentTemplate.ExecuteTemplate(&mainContentBuffer, "main_content", pageParams); err != nil {
-		log.Printf("Error executing template: %s, %s", pageParams, err)
+	if len(shortcodeFiles) == 0 {
+		return shortcodes, nil
+	}
+	shortcodes, err = shortcodes.ParseFiles(shortcodeFiles...)
+	if err != nil {
+		log.Printf("Error parsing files: %s, %s", shortcodeFiles, err)
 		return nil, err
 	}
-	pageParams["main_content"] = template.HTML(mainContentBuffer.String())
-	pageParams["title"] = config.Template.Params["title"].(string)
-	return pageParams, nil
+	return shortcodes, nil
+}
+
+// parseLayouts parses each file in the layouts directory on top of its own clone
+// of the base page template. A layout only has to redefine the blocks of the base
+// page that it changes, e.g. {{ define "main" }} or {{ define "body" }}. The base
+// page itself is keyed by both the empty layout name and "base_page" so that a page
+// can opt out of its directory's layout
+func parseLayouts(runtime utils.RuntimeConfig, base *template.Template) (map[string]*template.Template, error) {
+	layouts := map[string]*template.Template{"": base, "base_page": base}
+	layoutFiles, err := utils.GetLayoutFiles(runtime)
+	if err != nil {
+		return nil, err
+	}
+	for _, layoutFile := range layoutFiles {
+		clone, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		layout, err := clone.ParseFiles(layoutFile)
+		if err != nil {
+			log.Printf("Error parsing layout: %s, %s", layoutFile, err)
+			return nil, err
+		}
+		layouts[layoutName(layoutFile)] = layout
+	}
+	return layouts, nil
+}
+
+// layoutName is the name a page uses to pick a layout, which is the layout's file
+// name without the extension
+func layoutName(layoutFile string) string {
+	return strings.TrimSuffix(filepath.Base(layoutFile), filepath.Ext(layoutFile))
 }
 
 func newGoldmark() goldmark.Markdown {
 	return goldmark.New(
 		attributes.Enable,
-		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithExtensions(extension.GFM, highlight.Extension(), mathml.Extension(), images.Extension()),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(),
 			parser.WithAttribute(), // Lets you use {.att } syntax to add attributes to HTML output
@@ -135,8 +840,11 @@ func newGoldmark() goldmark.Markdown {
 // and all subdirectories. The path is a parameter because this
 // function is called recursively to get all the pages in the site underneath
 // "assets/pages". The first call of this function should be with the empty string
-// as path which represents the root of assets/pages
-func getAssetPages(runtime utils.RuntimeConfig, path string, params map[string]interface{}) ([]page.Page, error) {
+// as path which represents the root of assets/pages.
+// A directory can set the layout for the pages beneath it with a _layout file
+// containing the layout's name. dirLayout carries that default down into
+// subdirectories, and a page's own front matter layout takes precedence over it
+func getAssetPages(runtime utils.RuntimeConfig, path string, dirLayout string) ([]page.Page, error) {
 	baseAssetPath := utils.MakePath(filepath.Join(runtime.AssetsPath, "pages"))
 	fullAssetPath := path
 	if !strings.HasPrefix(path, baseAssetPath) {
@@ -149,9 +857,16 @@ func getAssetPages(runtime utils.RuntimeConfig, path string, params map[string]i
 		return pages, err
 	}
 
+	layoutFile, err := os.ReadFile(filepath.Join(fullAssetPath, "_layout"))
+	if err == nil {
+		dirLayout = strings.TrimSpace(string(layoutFile))
+	} else if !os.IsNotExist(err) {
+		return pages, err
+	}
+
 	for _, file := range files {
 		if file.IsDir() {
-			subPages, err := getAssetPages(runtime, filepath.Join(fullAssetPath, file.Name()), params)
+			subPages, err := getAssetPages(runtime, filepath.Join(fullAssetPath, file.Name()), dirLayout)
 			if err != nil {
 				return pages, err
 			}
@@ -169,18 +884,41 @@ func getAssetPages(runtime utils.RuntimeConfig, path string, params map[string]i
 		}
 
 		// Mark where the output for this page should be written
-		title := strings.TrimSuffix(file.Name(), ".md")
+		name := strings.TrimSuffix(file.Name(), ".md")
 		buildPath := filepath.Join(
-			strings.ReplaceAll(fullAssetPath, baseAssetPath, utils.MakePath("build")),
-			fmt.Sprintf("%s.html", title),
+			strings.ReplaceAll(fullAssetPath, baseAssetPath, utils.MakePath(runtime.BuildPath)),
+			fmt.Sprintf("%s.html", name),
 		)
+		relPath, err := filepath.Rel(baseAssetPath, fullAssetPath)
+		if err != nil {
+			return pages, err
+		}
+		relPath = filepath.ToSlash(relPath)
+		section := ""
+		if relPath != "." {
+			section = strings.Split(relPath, "/")[0]
+		}
 		page := page.Page{
-			Title:     title,
+			Name:      name,
+			Section:   section,
+			URL:       gopath.Join("/", relPath, fmt.Sprintf("%s.html", name)),
 			Content:   content,
-			Params:    params,
+			Params:    map[string]interface{}{},
 			AssetPath: fullAssetPath,
 			BuildPath: buildPath,
 		}
+		// Posts are often about code, so their template actions are only
+		// evaluated when their front matter asks for it
+		page.Templated = section != postsSection
+		// Front matter is stripped from the content here so that goldmark only
+		// ever sees the markdown body
+		if err := page.ParseFrontMatter(); err != nil {
+			return pages, fmt.Errorf("error reading front matter of %s: %s", filepath.Join(fullAssetPath, file.Name()), err)
+		}
+		if page.Layout == "" {
+			page.Layout = dirLayout
+		}
+		page.Layout = strings.TrimSuffix(page.Layout, ".html")
 		pages = append(pages, page)
 	}
 
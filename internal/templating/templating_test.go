@@ -1,13 +1,24 @@
 package templating
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
 	"html/template"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/krmckone/lk-site/internal/config"
+	"github.com/krmckone/lk-site/internal/fingerprint"
+	"github.com/krmckone/lk-site/internal/highlight"
+	"github.com/krmckone/lk-site/internal/page"
+	"github.com/krmckone/lk-site/internal/toc"
 	"github.com/krmckone/lk-site/internal/utils"
 )
 
@@ -35,23 +46,463 @@ func TestTemplateSite(t *testing.T) {
 	} else if err != nil {
 		t.Errorf("Error checking if %s directory exists: %s", runtime.BuildPath, err)
 	}
+	for _, feed := range []string{"feed.xml", "atom.xml", "feed.json", "sitemap.xml", "robots.txt", highlight.StylesheetFile, fingerprint.ManifestFile} {
+		if _, err := os.Stat(filepath.Join(utils.MakePath(runtime.BuildPath), feed)); err != nil {
+			t.Errorf("Expected %s to be written: %s", feed, err)
+		}
+	}
+	post, err := utils.ReadFile(filepath.Join(runtime.BuildPath, "post_1.html"))
+	if err != nil {
+		t.Fatalf("Unexpected error reading post_1.html: %s", err)
+	}
+	styles, err := utils.ReadFile(filepath.Join(runtime.AssetsPath, "css", "styles.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(styles)
+	stylesheet := fmt.Sprintf(`<link rel="stylesheet" href="/css/styles.%x.css">`, sum[:4])
+	if !strings.Contains(string(post), stylesheet) {
+		t.Errorf("Expected the page to link the fingerprinted stylesheet: %s, actual: %s", stylesheet, post)
+	}
+	if expected := `<link rel="alternate" type="application/rss+xml" title="RSS Feed" href="/feed.xml">`; !strings.Contains(string(post), expected) {
+		t.Errorf("Expected the page to link the feeds: %s, actual: %s", expected, post)
+	}
+	if expected := `<span class="line hl"><span class="cl"><span class="kd">func</span>`; !strings.Contains(string(post), expected) {
+		t.Errorf("Expected the code block to be highlighted: %s, actual: %s", expected, post)
+	}
+	if expected := `<math><mrow><mi>𝐈</mi><mover accent="true"><mi>x</mi>`; !strings.Contains(string(post), expected) {
+		t.Errorf("Expected the math to be rendered: %s, actual: %s", expected, post)
+	}
+	if expected := `<aside class="note">A note from a shortcode</aside>`; !strings.Contains(string(post), expected) {
+		t.Errorf("Expected the shortcode to be rendered: %s, actual: %s", expected, post)
+	}
+	post, err = utils.ReadFile(filepath.Join(runtime.BuildPath, "posts", "post_7.html"))
+	if err != nil {
+		t.Fatalf("Unexpected error reading posts/post_7.html: %s", err)
+	}
+	if expected := "<code>{{ .page.Title }}</code> and {{ .page.Title }} as written"; !strings.Contains(string(post), expected) {
+		t.Errorf("Expected the template actions of a post to be left as written: %s, actual: %s", expected, post)
+	}
 }
 
-func TestSetupPageParams(t *testing.T) {
+// readBuild returns the contents of every file in the build directory by path
+func readBuild(t *testing.T, runtime utils.RuntimeConfig) map[string]string {
+	files, err := utils.ReadDir(runtime.BuildPath)
+	if err != nil {
+		t.Fatalf("Unexpected error from ReadDir: %s", err)
+	}
+	contents := map[string]string{}
+	for _, file := range files {
+		b, err := utils.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Unexpected error from ReadFile: %s", err)
+		}
+		contents[file] = string(b)
+	}
+	return contents
+}
+
+func TestTemplateSiteWorkers(t *testing.T) {
+	runtime := NewTestRuntime()
+	t.Cleanup(func() {
+		if err := utils.Clean(utils.MakePath(runtime.BuildPath)); err != nil {
+			t.Errorf("Unexpected error from Clean: %s", err)
+		}
+	})
+	runtime.Workers = 1
+	if err := TemplateSite(runtime); err != nil {
+		t.Fatalf("Error from TemplateSite: %s", err)
+	}
+	serial := readBuild(t, runtime)
+	runtime.Workers = 8
+	if err := TemplateSite(runtime); err != nil {
+		t.Fatalf("Error from TemplateSite: %s", err)
+	}
+	if !reflect.DeepEqual(serial, readBuild(t, runtime)) {
+		t.Errorf("Expected the same output regardless of the number of workers")
+	}
+}
+
+func TestRenderPagesErrors(t *testing.T) {
 	runtime := NewTestRuntime()
+	runtime.Workers = 2
 	t.Cleanup(func() {
 		if err := utils.Clean(utils.MakePath(runtime.BuildPath)); err != nil {
 			t.Errorf("Unexpected error from Clean: %s", err)
 		}
 	})
+	renderer := siteRenderer{
+		runtime:    runtime,
+		components: template.New("components"),
+		shortcodes: template.New("shortcodes"),
+		layouts:    map[string]*template.Template{},
+	}
+	pages := []page.Page{
+		{BuildPath: "first.html", Layout: "missing"},
+		{BuildPath: "second.html", Layout: "also_missing"},
+	}
+	err := renderer.renderPages(pages)
+	if err == nil {
+		t.Fatalf("Expected an error from renderPages")
+	}
+	for _, expect := range []string{"first.html", "second.html"} {
+		if !strings.Contains(err.Error(), expect) {
+			t.Errorf("Expected the error to mention %s, actual: %s", expect, err)
+		}
+	}
+}
+
+func TestRenderPagesSourceErrors(t *testing.T) {
+	runtime := NewTestRuntime()
+	t.Cleanup(func() {
+		if err := utils.Clean(utils.MakePath(runtime.BuildPath)); err != nil {
+			t.Errorf("Unexpected error from Clean: %s", err)
+		}
+	})
+	shortcodeFiles, err := utils.GetShortcodeFiles(runtime)
+	if err != nil {
+		t.Fatalf("Unexpected error from GetShortcodeFiles: %s", err)
+	}
+	shortcodes, err := parseShortcodes(template.New("components"), shortcodeFiles)
+	if err != nil {
+		t.Fatalf("Unexpected error from parseShortcodes: %s", err)
+	}
+	renderer := siteRenderer{
+		runtime:    runtime,
+		config:     config.Config{Template: config.TemplateConfig{Params: config.Params{"title": "Tester"}}},
+		components: template.New("components"),
+		shortcodes: shortcodes,
+		layouts:    map[string]*template.Template{"": template.New("base_page.html")},
+	}
+	buildPath := utils.MakePath(filepath.Join(runtime.BuildPath, "post.html"))
+	// Lines count the front matter that was stripped from the content
 	cases := []struct {
-		componentFiles []string
-		config         config.Config
-		mainContent    string
-		expect         map[string]interface{}
+		name     string
+		content  string
+		expected string
+	}{
+		{"math", "# Heading\n\nSome $x + \\nope$ math\n", `invalid math at line 6, column 11: unknown command \nope`},
+		{"math after a shortcode", "{{< note >}}\nA\nnote\n{{< /note >}}\n\nSome $x + \\nope$ math\n", `invalid math at line 9, column 11: unknown command \nope`},
+		{"unknown shortcode", "# Heading\n\n{{< missing >}}\n", "line 6: unknown shortcode missing, which would be test/assets/shortcodes/missing.html"},
+		{"never closed", "Text\n\n{{< note >}}\nA note\n", "line 6: {{< note >}} is never closed with {{< /note >}}"},
+		{"action error", "---\n\n{{ .page.Title.Nope }}\n", "line 6: template: content:1:8: executing \"content\" at <.page.Title.Nope>: can't evaluate field Nope in type string"},
+		{"template error", "{{< test_shortcode >}}\n", "line 4: html/template:test_shortcode.html:1:64: no such template \"test_component.html\""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pages := []page.Page{{
+				Name:       "post",
+				Content:    []byte(c.content),
+				LineOffset: 3,
+				Templated:  true,
+				AssetPath:  "pages",
+				BuildPath:  buildPath,
+			}}
+			err := renderer.renderPages(pages)
+			expected := fmt.Sprintf("error building %s: pages/post.md: %s", buildPath, c.expected)
+			if err == nil || err.Error() != expected {
+				t.Errorf("Expected: %s, actual: %v", expected, err)
+			}
+		})
+	}
+}
+
+func TestRenderPageShortcodes(t *testing.T) {
+	runtime := NewTestRuntime()
+	t.Cleanup(func() {
+		if err := utils.Clean(utils.MakePath(runtime.BuildPath)); err != nil {
+			t.Errorf("Unexpected error from Clean: %s", err)
+		}
+	})
+	components, err := template.New("components").ParseFiles(filepath.Join(utils.MakePath(runtime.AssetsPath), "components", "test_component.html"))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing components: %s", err)
+	}
+	shortcodeFiles, err := utils.GetShortcodeFiles(runtime)
+	if err != nil {
+		t.Fatalf("Unexpected error from GetShortcodeFiles: %s", err)
+	}
+	shortcodes, err := parseShortcodes(components, shortcodeFiles)
+	if err != nil {
+		t.Fatalf("Unexpected error from parseShortcodes: %s", err)
+	}
+	renderer := siteRenderer{
+		runtime:    runtime,
+		config:     config.Config{Template: config.TemplateConfig{Params: config.Params{"title": "Tester"}}},
+		components: components,
+		shortcodes: shortcodes,
+		layouts:    map[string]*template.Template{"": template.Must(template.New("base_page.html").Parse("{{ .main_content }}"))},
+	}
+	worker, err := renderer.forWorker()
+	if err != nil {
+		t.Fatalf("Unexpected error from forWorker: %s", err)
+	}
+	cases := []struct {
+		name      string
+		content   string
+		templated bool
+		expected  string
+	}{
+		{
+			"block",
+			"Before\n\n{{< test_shortcode kind=\"a b\" >}}\n\nAfter\n",
+			false,
+			"<p>Before</p>\n<span class=\"a b\">Shortcodes: <html>It's a test component file\n\n</html></span>\n\n<p>After</p>\n",
+		},
+		{
+			"inner content",
+			"{{< note >}}\nSome <b>bold</b> & *raw* text\n{{< /note >}}\n",
+			false,
+			"<aside class=\"note\">\nSome <b>bold</b> & *raw* text\n</aside>\n\n",
+		},
+		{
+			"inline",
+			"A {{< note >}}short{{< /note >}} note\n",
+			false,
+			"<p>A <aside class=\"note\">short</aside>\n note</p>\n",
+		},
+		{
+			"code is left as written",
+			"```\n<b>{{ .page.Title }}</b>\n```\n",
+			false,
+			"<pre><code>&lt;b&gt;{{ .page.Title }}&lt;/b&gt;\n</code></pre>\n",
+		},
+		{
+			"actions on an untemplated page",
+			"Hello {{ .page.Title }}\n",
+			false,
+			"<p>Hello {{ .page.Title }}</p>\n",
+		},
+		{
+			"actions on a templated page",
+			"Hello {{ .page.Title }}, `{{ .page.Title }}`\n\n{{ if .page.Title }}<b>{{ .page.Title }}</b>{{ end }}\n\n\\{{ .page.Title }} $\\mathbf{ {{x}} }$\n",
+			true,
+			"<p>Hello Shortcodes, <code>{{ .page.Title }}</code></p>\n<b>Shortcodes</b>\n<p>{{ .page.Title }} <math><mi>𝐱</mi></math></p>\n",
+		},
+		{
+			"components on a templated page",
+			"{{ template \"test_component.html\" }}\n",
+			true,
+			"<html>It's a test component file\n\n</html>\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := page.Page{
+				Title:     "Shortcodes",
+				Content:   []byte(c.content),
+				Templated: c.templated,
+				BuildPath: utils.MakePath(filepath.Join(runtime.BuildPath, "shortcodes.html")),
+			}
+			if err := worker.renderPage(newGoldmark(), &p); err != nil {
+				t.Fatalf("Unexpected error from renderPage: %s", err)
+			}
+			if !strings.HasPrefix(p.HTML, c.expected) {
+				t.Errorf("Expected: %s, actual: %s", c.expected, p.HTML)
+			}
+		})
+	}
+}
+
+func TestRenderPageTableOfContents(t *testing.T) {
+	runtime := NewTestRuntime()
+	t.Cleanup(func() {
+		if err := utils.Clean(utils.MakePath(runtime.BuildPath)); err != nil {
+			t.Errorf("Unexpected error from Clean: %s", err)
+		}
+	})
+	layout := template.Must(template.New("base_page.html").Parse("{{ with .TableOfContents }}<nav>{{ .HTML }}</nav>{{ end }}{{ .main_content }}"))
+	renderer := siteRenderer{
+		runtime: runtime,
+		config: config.Config{Template: config.TemplateConfig{
+			Params:          config.Params{"title": "Tester"},
+			TableOfContents: config.TableOfContentsConfig{MaxLevel: 4},
+		}},
+		components: template.New("components"),
+		shortcodes: template.New("shortcodes"),
+		layouts:    map[string]*template.Template{"": layout},
+	}
+	worker, err := renderer.forWorker()
+	if err != nil {
+		t.Fatalf("Unexpected error from forWorker: %s", err)
+	}
+	cases := []struct {
+		name     string
+		noTOC    bool
+		expected string
+	}{
+		{"listed", false, `<nav><ul><li><a href="#first">First</a><ul><li><a href="#nested">Nested</a><ul><li><a href="#deepest">Deepest</a></li></ul></li></ul></li><li><a href="#second">Second</a></li></ul></nav><h1 id="title">`},
+		{"opted out", true, `<h1 id="title">`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := page.Page{
+				Content:   []byte("# Title\n## First\n### Nested\n#### Deepest\n## Second\n"),
+				NoTOC:     c.noTOC,
+				BuildPath: utils.MakePath(filepath.Join(runtime.BuildPath, "toc.html")),
+			}
+			if err := worker.renderPage(newGoldmark(), &p); err != nil {
+				t.Fatalf("Unexpected error from renderPage: %s", err)
+			}
+			actual, err := os.ReadFile(p.BuildPath)
+			if err != nil {
+				t.Fatalf("Unexpected error reading the page: %s", err)
+			}
+			if !strings.HasPrefix(string(actual), c.expected) {
+				t.Errorf("Expected: %s, actual: %s", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTemplateSiteCache(t *testing.T) {
+	runtime := NewTestRuntime()
+	runtime.CachePath = "test/cache"
+	t.Cleanup(func() {
+		for _, path := range []string{runtime.BuildPath, runtime.CachePath} {
+			if err := utils.Clean(utils.MakePath(path)); err != nil {
+				t.Errorf("Unexpected error from Clean: %s", err)
+			}
+		}
+	})
+
+	if err := TemplateSite(runtime); err != nil {
+		t.Fatalf("Error from TemplateSite: %s", err)
+	}
+	clean := readBuild(t, runtime)
+	if err := TemplateSite(runtime); err != nil {
+		t.Fatalf("Error from TemplateSite: %s", err)
+	}
+	if !reflect.DeepEqual(clean, readBuild(t, runtime)) {
+		t.Errorf("Expected the incremental build to match the clean build")
+	}
+	if _, err := os.Stat(utils.MakePath(filepath.Join(runtime.CachePath, "manifest.json"))); err != nil {
+		t.Errorf("Expected the build cache manifest to be written: %s", err)
+	}
+
+	// Files the cache doesn't know about are only removed by a forced build,
+	// which starts from a clean build directory
+	stray := filepath.Join(runtime.BuildPath, "stray.html")
+	if err := utils.WriteFile(stray, []byte("stray")); err != nil {
+		t.Fatalf("Unexpected error from WriteFile: %s", err)
+	}
+	runtime.Force = true
+	if err := TemplateSite(runtime); err != nil {
+		t.Fatalf("Error from TemplateSite: %s", err)
+	}
+	if _, err := os.Stat(utils.MakePath(stray)); !os.IsNotExist(err) {
+		t.Errorf("Expected a forced build to start from a clean build directory")
+	}
+	if !reflect.DeepEqual(clean, readBuild(t, runtime)) {
+		t.Errorf("Expected the forced build to match the clean build")
+	}
+}
+
+func TestTemplateSiteCacheBuildTime(t *testing.T) {
+	runtime := NewTestRuntime()
+	runtime.CachePath = "test/cache"
+	clean := NewTestRuntime()
+	clean.BuildPath = "test/build_clean"
+	t.Cleanup(func() {
+		for _, path := range []string{runtime.BuildPath, runtime.CachePath, clean.BuildPath} {
+			if err := utils.Clean(utils.MakePath(path)); err != nil {
+				t.Errorf("Unexpected error from Clean: %s", err)
+			}
+		}
+	})
+
+	runtime.BuildTime = time.Date(2024, 6, 5, 12, 0, 0, 0, time.UTC)
+	if err := TemplateSite(runtime); err != nil {
+		t.Fatalf("Error from TemplateSite: %s", err)
+	}
+	// Changing the stored pages shows which ones the next build reuses
+	b, err := utils.ReadFile(filepath.Join(runtime.CachePath, "manifest.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error reading the cache manifest: %s", err)
+	}
+	manifest := struct {
+		Outputs map[string]string `json:"outputs"`
+	}{}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatalf("Unexpected error from Unmarshal: %s", err)
+	}
+	stored, err := json.Marshal(renderedPage{HTML: "reused", Page: "reused at " + buildTimePlaceholder})
+	if err != nil {
+		t.Fatalf("Unexpected error from Marshal: %s", err)
+	}
+	if err := utils.WriteFile(filepath.Join(runtime.CachePath, "content", manifest.Outputs["post_1.html"]), stored); err != nil {
+		t.Fatalf("Unexpected error from WriteFile: %s", err)
+	}
+
+	runtime.BuildTime = runtime.BuildTime.Add(time.Hour)
+	if err := TemplateSite(runtime); err != nil {
+		t.Fatalf("Error from TemplateSite: %s", err)
+	}
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		// Only the build time changed, so the page is reused with the new time
+		{"post_1.html", "reused at 05 Jun 24 09:00 EDT"},
+		// The page is built from Steam data, which may have changed
+		{"post_8.html", "Post 8 has 0 playtime snapshots"},
+	}
+	for _, c := range cases {
+		actual, err := utils.ReadFile(filepath.Join(runtime.BuildPath, c.name))
+		if err != nil {
+			t.Fatalf("Unexpected error reading %s: %s", c.name, err)
+		}
+		if !strings.Contains(string(actual), c.expected) {
+			t.Errorf("Expected %s to contain: %s, actual: %s", c.name, c.expected, actual)
+		}
+	}
+
+	// Every other page is the same as in a clean build at the same time
+	if err := utils.WriteFile(filepath.Join(runtime.CachePath, "content", manifest.Outputs["post_1.html"]), []byte{}); err != nil {
+		t.Fatalf("Unexpected error from WriteFile: %s", err)
+	}
+	if err := TemplateSite(runtime); err != nil {
+		t.Fatalf("Error from TemplateSite: %s", err)
+	}
+	clean.BuildTime = runtime.BuildTime
+	if err := TemplateSite(clean); err != nil {
+		t.Fatalf("Error from TemplateSite: %s", err)
+	}
+	err = filepath.WalkDir(utils.MakePath(clean.BuildPath), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(utils.MakePath(clean.BuildPath), path)
+		if err != nil {
+			return err
+		}
+		expected, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		actual, err := os.ReadFile(filepath.Join(utils.MakePath(runtime.BuildPath), rel))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(expected, actual) {
+			t.Errorf("Expected the incremental build of %s to match the clean build", rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error comparing the builds: %s", err)
+	}
+}
+
+func TestSetupPageParams(t *testing.T) {
+	cases := []struct {
+		config   config.Config
+		site     Site
+		page     page.Page
+		contents *toc.TableOfContents
+		expect   map[string]interface{}
 	}{
 		{
-			[]string{filepath.Join(utils.MakePath(runtime.AssetsPath), "components", "test_component.html")},
 			config.Config{
 				Env: config.EnvConfig{Params: config.Params{}},
 				Template: config.TemplateConfig{
@@ -60,16 +511,221 @@ func TestSetupPageParams(t *testing.T) {
 					},
 				},
 			},
-			"<h1>Test Page</h1>",
-			map[string]interface{}{"title": "Test Page", "main_content": template.HTML("<h1>Test Page</h1>")},
+			Site{},
+			page.Page{},
+			nil,
+			map[string]interface{}{
+				"title":           "Test Page",
+				"site":            Site{},
+				"Data":            map[string]interface{}(nil),
+				"TableOfContents": (*toc.TableOfContents)(nil),
+				"page":            page.Page{},
+			},
+		},
+		{
+			config.Config{
+				Env: config.EnvConfig{Params: config.Params{}},
+				Template: config.TemplateConfig{
+					Params: config.Params{
+						"title": "Test Page",
+					},
+				},
+			},
+			Site{},
+			page.Page{Title: "Front Matter Title"},
+			nil,
+			map[string]interface{}{
+				"title":           "Front Matter Title",
+				"site":            Site{},
+				"Data":            map[string]interface{}(nil),
+				"TableOfContents": (*toc.TableOfContents)(nil),
+				"page":            page.Page{Title: "Front Matter Title"},
+			},
+		},
+		{
+			config.Config{
+				Env:      config.EnvConfig{Params: config.Params{"steamId": "123"}},
+				Template: config.TemplateConfig{Params: config.Params{"title": "Test Page", "author": "<b>LK</b>"}},
+			},
+			Site{Data: map[string]interface{}{"projects": map[string]interface{}{"graphics": []interface{}{"rayTracer"}}}},
+			page.Page{},
+			&toc.TableOfContents{Entries: []*toc.Entry{{Level: 2, ID: "intro", Title: "Intro"}}},
+			map[string]interface{}{
+				"title":           "Test Page",
+				"author":          template.HTML("<b>LK</b>"),
+				"steamId":         "123",
+				"site":            Site{Data: map[string]interface{}{"projects": map[string]interface{}{"graphics": []interface{}{"rayTracer"}}}},
+				"Data":            map[string]interface{}{"projects": map[string]interface{}{"graphics": []interface{}{"rayTracer"}}},
+				"TableOfContents": &toc.TableOfContents{Entries: []*toc.Entry{{Level: 2, ID: "intro", Title: "Intro"}}},
+				"page":            page.Page{},
+			},
 		},
 	}
 	for _, c := range cases {
-		actual, err := setupPageParams(runtime, c.componentFiles, c.config, c.mainContent)
-		if err != nil {
-			t.Errorf("Unexpected error: %s", err)
+		actual := setupPageParams(c.config, c.site, c.page, c.contents)
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("Expected: %s, actual: %s", c.expect, actual)
+		}
+	}
+}
+
+func TestGetAssetPagesLayouts(t *testing.T) {
+	runtime := NewTestRuntime()
+	pages, err := getAssetPages(runtime, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error from getAssetPages: %s", err)
+	}
+	expect := map[string]string{
+		"post_0.html": "",
+		"post_3.html": "test_layout",
+		"post_4.html": "base_page",
+	}
+	for _, p := range pages {
+		name := filepath.Base(p.BuildPath)
+		layout, ok := expect[name]
+		if !ok {
+			continue
+		}
+		if p.Layout != layout {
+			t.Errorf("Expected %s to use layout %q, actual: %q", name, layout, p.Layout)
+		}
+		delete(expect, name)
+	}
+	if len(expect) != 0 {
+		t.Errorf("Expected pages not found: %v", expect)
+	}
+}
+
+func TestParseLayouts(t *testing.T) {
+	runtime := NewTestRuntime()
+	manifest := fingerprint.NewManifest(false)
+	manifest.Add("css/styles.css", []byte("body {}"))
+	base, err := template.New("base_page.html").Funcs(fingerprint.TemplateFuncs(manifest)).ParseFiles(utils.GetBasePageFiles(runtime)...)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing base page: %s", err)
+	}
+	layouts, err := parseLayouts(runtime, base)
+	if err != nil {
+		t.Fatalf("Unexpected error from parseLayouts: %s", err)
+	}
+	cases := []struct {
+		layout string
+		expect string
+	}{
+		{"", "\n<p>content</p>\n"},
+		{"base_page", "\n<p>content</p>\n"},
+		{"test_layout", "<article><p>content</p></article>"},
+	}
+	for _, c := range cases {
+		layout, ok := layouts[c.layout]
+		if !ok {
+			t.Fatalf("Expected layout %q to be parsed", c.layout)
+		}
+		actual := bytes.Buffer{}
+		params := map[string]interface{}{"main_content": template.HTML("<p>content</p>"), "site": Site{}}
+		if err := layout.ExecuteTemplate(&actual, "base_page.html", params); err != nil {
+			t.Fatalf("Unexpected error executing layout %q: %s", c.layout, err)
+		}
+		if !strings.Contains(actual.String(), c.expect) {
+			t.Errorf("Expected layout %q output to contain %q, actual: %q", c.layout, c.expect, actual.String())
+		}
+		// The feeds aren't written without a base URL, so they aren't linked
+		if strings.Contains(actual.String(), "/feed.xml") {
+			t.Errorf("Expected layout %q not to link the feeds without a base URL, actual: %q", c.layout, actual.String())
+		}
+	}
+}
+
+func TestPublishedPages(t *testing.T) {
+	now := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+	pages := []page.Page{
+		{BuildPath: "published.html"},
+		{BuildPath: "draft.html", Draft: true},
+		{BuildPath: "future.html", PublishDate: now.Add(time.Hour)},
+		{BuildPath: "past.html", PublishDate: now.Add(-time.Hour)},
+	}
+	cases := []struct {
+		drafts, future bool
+		expect         []string
+	}{
+		{false, false, []string{"published.html", "past.html"}},
+		{true, false, []string{"published.html", "draft.html", "past.html"}},
+		{false, true, []string{"published.html", "future.html", "past.html"}},
+		{true, true, []string{"published.html", "draft.html", "future.html", "past.html"}},
+	}
+	for _, c := range cases {
+		runtime := NewTestRuntime()
+		runtime.BuildDrafts = c.drafts
+		runtime.BuildFuture = c.future
+		actual := []string{}
+		for _, p := range publishedPages(runtime, pages, now) {
+			actual = append(actual, p.BuildPath)
 		}
 		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("Expected with drafts=%t future=%t: %s, actual: %s", c.drafts, c.future, c.expect, actual)
+		}
+	}
+}
+
+func TestGetAssetPagesLinks(t *testing.T) {
+	runtime := NewTestRuntime()
+	pages, err := getAssetPages(runtime, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error from getAssetPages: %s", err)
+	}
+	expect := map[string][4]string{
+		"post_0": {"", "/post_0.html", "", "true"},
+		"post_3": {"nested", "/nested/post_3.html", "", "true"},
+		"post_2": {"", "/post_2.html", "Post 2 Front Matter", "true"},
+		"post_7": {"posts", "/posts/post_7.html", "", "false"},
+	}
+	for _, p := range pages {
+		e, ok := expect[p.Name]
+		if !ok {
+			continue
+		}
+		actual := [4]string{p.Section, p.URL, p.Title, fmt.Sprint(p.Templated)}
+		if actual != e {
+			t.Errorf("Expected %s to have section, URL, title and templated %q, actual: %q", p.Name, e, actual)
+		}
+		delete(expect, p.Name)
+	}
+	if len(expect) != 0 {
+		t.Errorf("Expected pages not found: %v", expect)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	cases := []struct {
+		page   page.Page
+		expect string
+	}{
+		{page.Page{Description: "From front matter", Content: []byte("First paragraph")}, "From front matter"},
+		{page.Page{Content: []byte("# Heading\n\nFirst *paragraph*\nwraps [here](/x.html).\n\nSecond paragraph")}, "First paragraph wraps here."},
+		{page.Page{Content: []byte("<div id=\"container\"></div>")}, ""},
+		{page.Page{Content: []byte("{{< figure src=\"a.png\" >}}\n\nAfter {{< note >}}the{{< /note >}} figure")}, "After the figure"},
+	}
+	gm := newGoldmark()
+	for _, c := range cases {
+		if actual := summarize(gm, c.page, func(name string) bool { return name == "note" }); actual != c.expect {
+			t.Errorf("Expected: %q, actual: %q", c.expect, actual)
+		}
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	date := time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC)
+	lastmod := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		page   page.Page
+		expect time.Time
+	}{
+		{page.Page{Lastmod: lastmod, Date: date}, lastmod},
+		{page.Page{Name: "untracked", AssetPath: "test/assets/pages", Date: date}, date},
+		{page.Page{Name: "untracked", AssetPath: "test/assets/pages"}, time.Time{}},
+	}
+	for _, c := range cases {
+		if actual := lastModified(c.page); !actual.Equal(c.expect) {
 			t.Errorf("Expected: %s, actual: %s", c.expect, actual)
 		}
 	}
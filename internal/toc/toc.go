@@ -0,0 +1,102 @@
+package toc
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+const (
+	// DefaultMinLevel lists headings from ##, since # is the page's own title
+	DefaultMinLevel = 2
+	DefaultMaxLevel = 3
+)
+
+// Entry is a heading in a table of contents, with the headings beneath it
+type Entry struct {
+	Level    int
+	ID       string // The heading's id, which links to it
+	Title    string
+	Children []*Entry
+}
+
+// TableOfContents is the tree of headings on a page
+type TableOfContents struct {
+	Entries []*Entry
+}
+
+// Collect returns the table of contents for the headings in doc from minLevel
+// to maxLevel, nesting each heading under the closest one above it with a
+// lower level. Headings without an id are left out. It's nil when there are
+// fewer than two headings, which aren't worth navigating
+func Collect(doc ast.Node, source []byte, minLevel, maxLevel int) *TableOfContents {
+	contents := &TableOfContents{}
+	parents := []*Entry{}
+	count := 0
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		id, ok := heading.AttributeString("id")
+		if !ok || heading.Level < minLevel || heading.Level > maxLevel {
+			return ast.WalkSkipChildren, nil
+		}
+		entry := &Entry{Level: heading.Level, ID: fmt.Sprintf("%s", id), Title: title(heading, source)}
+		for len(parents) > 0 && parents[len(parents)-1].Level >= entry.Level {
+			parents = parents[:len(parents)-1]
+		}
+		if len(parents) == 0 {
+			contents.Entries = append(contents.Entries, entry)
+		} else {
+			parent := parents[len(parents)-1]
+			parent.Children = append(parent.Children, entry)
+		}
+		parents = append(parents, entry)
+		count++
+		return ast.WalkSkipChildren, nil
+	})
+	if count < 2 {
+		return nil
+	}
+	return contents
+}
+
+// title returns the plain text of a heading
+func title(heading *ast.Heading, source []byte) string {
+	b := strings.Builder{}
+	ast.Walk(heading, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Text:
+			b.Write(node.Segment.Value(source))
+		case *ast.String:
+			b.Write(node.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(b.String())
+}
+
+// HTML returns the table of contents as nested lists of links to its headings
+func (t *TableOfContents) HTML() template.HTML {
+	b := strings.Builder{}
+	writeList(&b, t.Entries)
+	return template.HTML(b.String())
+}
+
+func writeList(b *strings.Builder, entries []*Entry) {
+	b.WriteString("<ul>")
+	for _, entry := range entries {
+		fmt.Fprintf(b, `<li><a href="#%s">%s</a>`, template.HTMLEscapeString(entry.ID), template.HTMLEscapeString(entry.Title))
+		if len(entry.Children) > 0 {
+			writeList(b, entry.Children)
+		}
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ul>")
+}
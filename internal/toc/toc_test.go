@@ -0,0 +1,84 @@
+package toc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+func collect(markdown string, minLevel, maxLevel int) *TableOfContents {
+	source := []byte(markdown)
+	gm := goldmark.New(goldmark.WithParserOptions(parser.WithAutoHeadingID()))
+	return Collect(gm.Parser().Parse(text.NewReader(source)), source, minLevel, maxLevel)
+}
+
+func TestCollect(t *testing.T) {
+	cases := []struct {
+		name     string
+		markdown string
+		minLevel int
+		maxLevel int
+		expected *TableOfContents
+	}{
+		{
+			"nested",
+			"# Title\n## First\n### Nested\n#### Too deep\n## Second\n",
+			2,
+			3,
+			&TableOfContents{Entries: []*Entry{
+				{Level: 2, ID: "first", Title: "First", Children: []*Entry{
+					{Level: 3, ID: "nested", Title: "Nested"},
+				}},
+				{Level: 2, ID: "second", Title: "Second"},
+			}},
+		},
+		{
+			"starting deeper",
+			"### Before\n## Section\n#### Skipped a level\n",
+			2,
+			4,
+			&TableOfContents{Entries: []*Entry{
+				{Level: 3, ID: "before", Title: "Before"},
+				{Level: 2, ID: "section", Title: "Section", Children: []*Entry{
+					{Level: 4, ID: "skipped-a-level", Title: "Skipped a level"},
+				}},
+			}},
+		},
+		{
+			"formatted titles",
+			"## The `main` *function*\n## Plain\n",
+			2,
+			3,
+			&TableOfContents{Entries: []*Entry{
+				{Level: 2, ID: "the-main-function", Title: "The main function"},
+				{Level: 2, ID: "plain", Title: "Plain"},
+			}},
+		},
+		{
+			"one heading",
+			"# Title\n## Only\n",
+			2,
+			3,
+			nil,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := collect(c.markdown, c.minLevel, c.maxLevel)
+			if !reflect.DeepEqual(c.expected, actual) {
+				t.Errorf("Expected: %v, actual: %v", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestHTML(t *testing.T) {
+	contents := collect("## First\n### Nested\n## Fish & \"Chips\"\n", 2, 3)
+	expected := `<ul><li><a href="#first">First</a><ul><li><a href="#nested">Nested</a></li></ul></li><li><a href="#fish--chips">Fish &amp; &#34;Chips&#34;</a></li></ul>`
+	if actual := string(contents.HTML()); actual != expected {
+		t.Errorf("Expected: %s, actual: %s", expected, actual)
+	}
+}
@@ -6,15 +6,16 @@ import (
 	"html/template"
 	"log"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/krmckone/lk-site/internal/steamapi"
+	"github.com/krmckone/lk-site/internal/cache"
+	"github.com/krmckone/lk-site/internal/page"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
@@ -22,10 +23,27 @@ import (
 // Parameterizes specific values needed to load assets and configuration
 // at runtime
 type RuntimeConfig struct {
-	AssetsPath    string
-	ConfigsPath   string
-	BuildPath     string
-	TemplateFuncs template.FuncMap
+	AssetsPath     string
+	ConfigsPath    string
+	BuildPath      string
+	CachePath      string    // Build cache directory, caching is off when empty
+	BuildDrafts    bool      // Include pages marked as drafts
+	BuildFuture    bool      // Include pages with a publish date in the future
+	Force          bool      // Rebuild everything regardless of the build cache
+	Offline        bool      // Never call remote APIs, only use cached responses
+	SteamFixture   string    // Directory of fake Steam API responses to use instead of the API
+	RecordPlaytime bool      // Add today's Steam playtime to the history in the assets data
+	Workers        int       // Pages rendered concurrently, one per CPU when less than 1
+	BuildTime      time.Time // When the site is built, the current time when zero
+	TemplateFuncs  template.FuncMap
+}
+
+// Now returns the build time, which is the current time unless BuildTime is set
+func (r RuntimeConfig) Now() time.Time {
+	if r.BuildTime.IsZero() {
+		return time.Now()
+	}
+	return r.BuildTime
 }
 
 func NewRuntimeConfig() RuntimeConfig {
@@ -33,15 +51,16 @@ func NewRuntimeConfig() RuntimeConfig {
 		AssetsPath:    "assets",
 		ConfigsPath:   "configs",
 		BuildPath:     "build",
+		CachePath:     ".lk-cache",
 		TemplateFuncs: getTemplateFuncs(),
 	}
 }
 
 func getTemplateFuncs() template.FuncMap {
 	return template.FuncMap{
-		"makeHrefs":         makeHrefs,
-		"makeNavTitle":      makeNavTitleFromHref,
-		"getSteamDeckTop50": steamapi.GetSteamDeckTop50Wrapper,
+		"where":        page.Where,
+		"sortBy":       page.SortBy,
+		"makeNavTitle": makeNavTitleFromHref,
 	}
 }
 
@@ -87,6 +106,26 @@ func GetBasePageFiles(runtime RuntimeConfig) []string {
 	return files
 }
 
+// GetLayoutFiles returns the list of layout files in the assets/layouts directory.
+// Layouts are optional, so a missing directory is not an error
+func GetLayoutFiles(runtime RuntimeConfig) ([]string, error) {
+	files, err := ReadDir(filepath.Join(MakePath(runtime.AssetsPath), "layouts"))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	return files, err
+}
+
+// GetShortcodeFiles returns the list of shortcode files in the assets/shortcodes
+// directory. Shortcodes are optional, so a missing directory is not an error
+func GetShortcodeFiles(runtime RuntimeConfig) ([]string, error) {
+	files, err := ReadDir(filepath.Join(MakePath(runtime.AssetsPath), "shortcodes"))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	return files, err
+}
+
 // GetComponentFiles returns the list of component files in the assets/components directory
 func GetComponentFiles(runtime RuntimeConfig) ([]string, error) {
 	return ReadDir(filepath.Join(MakePath(runtime.AssetsPath), "components"))
@@ -127,15 +166,19 @@ func MakePath(path string) string {
 
 // SetupBuild generates the directories for the output artifacts and puts
 // assets that do not need processing in the build directory; these assets
-// are referred to by the output artifacts
-func SetupBuild(runtime RuntimeConfig) error {
+// are referred to by the output artifacts. The build directory is only
+// cleaned when there is no previous build in buildCache to reuse, which
+// is always the case for a nil buildCache
+func SetupBuild(runtime RuntimeConfig, buildCache *cache.Cache) error {
 	assetDirs := []string{"css", "images", "js", "shaders"}
 	dirs := []string{}
 	for _, dir := range assetDirs {
 		dirs = append(dirs, filepath.Join(MakePath(runtime.BuildPath), dir))
 	}
-	if err := Clean(MakePath(runtime.BuildPath)); err != nil {
-		return fmt.Errorf("error cleaning directory %s: %s", MakePath(runtime.BuildPath), err)
+	if buildCache.Clean() {
+		if err := Clean(MakePath(runtime.BuildPath)); err != nil {
+			return fmt.Errorf("error cleaning directory %s: %s", MakePath(runtime.BuildPath), err)
+		}
 	}
 	for _, dir := range dirs { // Maybe we could combine these loops
 		if err := Mkdir(dir); err != nil {
@@ -143,7 +186,11 @@ func SetupBuild(runtime RuntimeConfig) error {
 		}
 	}
 	for _, dir := range assetDirs {
-		if err := CopyAssetToBuild(runtime, dir); err != nil {
+		// Images are written by the images package, which strips their metadata
+		if dir == "images" {
+			continue
+		}
+		if err := CopyAssetToBuild(runtime, dir, buildCache); err != nil {
 			return fmt.Errorf("error copying %s to %s: %s", dir, runtime.BuildPath, err)
 		}
 	}
@@ -179,13 +226,70 @@ func Clean(path string) error {
 	return nil
 }
 
+// GitLastModified returns the commit time of the last commit that touched path.
+// The zero time is returned when path has no history, such as for new files or
+// builds outside of a git checkout
+func GitLastModified(path string) time.Time {
+	cmd := exec.Command("git", "log", "-1", "--format=%cI", "--", MakePath(path))
+	cmd.Dir = GetRepoRoot()
+	out, err := cmd.Output()
+	if err != nil {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(out)))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// NewPage creates a markdown page at name under the pages directory with front
+// matter for the title and the current date. The title defaults to one derived
+// from the file name. An existing page is never overwritten. Returns the path
+// of the new page
+func NewPage(runtime RuntimeConfig, name, title string, draft bool, now time.Time) (string, error) {
+	if !strings.HasSuffix(name, ".md") {
+		name += ".md"
+	}
+	if title == "" {
+		title = makeNavTitleFromHref(strings.TrimSuffix(name, ".md"))
+	}
+	pagePath := MakePath(filepath.Join(runtime.AssetsPath, "pages", name))
+	if !strings.HasPrefix(pagePath, MakePath(filepath.Join(runtime.AssetsPath, "pages"))+string(filepath.Separator)) {
+		return "", fmt.Errorf("page %s is outside of the pages directory", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(pagePath), 0755); err != nil {
+		return "", fmt.Errorf("error making directory for page %s: %s", name, err)
+	}
+	content := fmt.Sprintf(
+		"---\ntitle: %s\ndate: %s\ndraft: %t\n---\n\n",
+		strconv.Quote(title),
+		now.Format(time.RFC3339),
+		draft,
+	)
+	f, err := os.OpenFile(pagePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("error creating page %s: %s", name, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		return "", fmt.Errorf("error writing page %s: %s", name, err)
+	}
+	return pagePath, nil
+}
+
 // Returns the current eastern timestamp
 func GetCurrentEasternTime() string {
+	return GetEasternTime(time.Now())
+}
+
+// Returns the eastern timestamp of t
+func GetEasternTime(t time.Time) string {
 	location, err := time.LoadLocation("America/New_York")
 	if err != nil {
 		log.Fatalf("Error getting the current EST time: %s", err)
 	}
-	return time.Now().In(location).Format(time.RFC822)
+	return t.In(location).Format(time.RFC822)
 }
 
 // Returns the current year such as "2024"
@@ -193,11 +297,43 @@ func GetCurrentYear() string {
 	return strconv.Itoa(time.Now().Year())
 }
 
-func CopyAssetToBuild(runtime RuntimeConfig, srcName string) error {
-	return CopyFiles(
-		filepath.Join(runtime.AssetsPath, srcName),
-		filepath.Join(runtime.BuildPath, srcName),
-	)
+// CopyAssetToBuild copies the srcName directory of the assets to the build
+// directory. With a buildCache, files are copied one at a time and the ones
+// whose content is unchanged since the previous build are skipped
+func CopyAssetToBuild(runtime RuntimeConfig, srcName string, buildCache *cache.Cache) error {
+	if buildCache == nil {
+		return CopyFiles(
+			filepath.Join(runtime.AssetsPath, srcName),
+			filepath.Join(runtime.BuildPath, srcName),
+		)
+	}
+	files, err := ReadDir(filepath.Join(runtime.AssetsPath, srcName))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		output, err := filepath.Rel(runtime.AssetsPath, file)
+		if err != nil {
+			return err
+		}
+		b, err := ReadFile(file)
+		if err != nil {
+			return err
+		}
+		key := cache.Hash(b)
+		if buildCache.Fresh(output, key) {
+			continue
+		}
+		dst := filepath.Join(runtime.BuildPath, output)
+		if err := Mkdir(filepath.Dir(dst)); err != nil {
+			return err
+		}
+		if err := WriteFile(dst, b); err != nil {
+			return err
+		}
+		buildCache.Put(output, key)
+	}
+	return nil
 }
 
 // Copies files and directories from srcPath to dstPath
@@ -213,52 +349,6 @@ func CopyFiles(srcPath, dstPath string) error {
 	return os.CopyFS(repoDstPath, os.DirFS(repoSrcPath))
 }
 
-func makeHrefs(path string) ([]string, error) {
-	var hrefs []string
-
-	assets, err := getAssets(path)
-	if err != nil {
-		return hrefs, err
-	}
-
-	sort.Strings(assets)
-	for _, v := range assets {
-		hrefs = append(hrefs, makeHref(v, path))
-	}
-
-	return hrefs, nil
-}
-
-func makeHref(assetName, originalPath string) string {
-	_, file := path.Split(originalPath)
-	return path.Join(string(os.PathSeparator), file, assetName)
-}
-
-func getAssets(path string) ([]string, error) {
-	var assets []string
-
-	dir, err := os.Open(MakePath(path))
-	if err != nil {
-		return assets, err
-	}
-
-	files, err := dir.Readdir(0)
-	if err != nil {
-		return assets, err
-	}
-
-	for i, v := range files {
-		// We only want to treat files as assets here. If there's nested
-		// directories containg more assets, then getAssets needs to get
-		// called with that nested path to handle that case separately
-		if !v.IsDir() {
-			assets = append(assets, strings.Split(files[i].Name(), ".")[0])
-		}
-	}
-
-	return assets, nil
-}
-
 func makeNavTitleFromHref(assetHref string) string {
 	_, file := path.Split(assetHref)
 	caser := cases.Title(language.AmericanEnglish)
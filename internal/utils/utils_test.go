@@ -29,6 +29,9 @@ func TestReadDir(t *testing.T) {
 	expected := []string{
 		filepath.Join("assets", "components", "steam_deck_top_50.html"),
 		filepath.Join("assets", "components", "contents.html"),
+		filepath.Join("assets", "components", "steam_recent_activity.html"),
+		filepath.Join("assets", "components", "link_list.html"),
+		filepath.Join("assets", "components", "github_repos.html"),
 	}
 	slices.Sort(expected)
 	if !slices.Equal(actual, expected) {
@@ -68,6 +71,53 @@ func TestGetComponentFiles(t *testing.T) {
 	}
 }
 
+func TestGetLayoutFiles(t *testing.T) {
+	runtime := NewTestRuntime()
+	actual, err := GetLayoutFiles(runtime)
+	if err != nil {
+		t.Errorf("Unexpected error from GetLayoutFiles: %s", err)
+	}
+	expected := []string{
+		filepath.Join(MakePath(runtime.AssetsPath), "layouts", "test_layout.html"),
+	}
+	if !slices.Equal(actual, expected) {
+		t.Errorf("Expected: %s, actual: %s", expected, actual)
+	}
+
+	runtime.AssetsPath = "test/no_assets"
+	actual, err = GetLayoutFiles(runtime)
+	if err != nil {
+		t.Errorf("Unexpected error from GetLayoutFiles without a layouts directory: %s", err)
+	}
+	if len(actual) != 0 {
+		t.Errorf("Expected no layouts, actual: %s", actual)
+	}
+}
+
+func TestGetShortcodeFiles(t *testing.T) {
+	runtime := NewTestRuntime()
+	actual, err := GetShortcodeFiles(runtime)
+	if err != nil {
+		t.Errorf("Unexpected error from GetShortcodeFiles: %s", err)
+	}
+	expected := []string{
+		filepath.Join(MakePath(runtime.AssetsPath), "shortcodes", "note.html"),
+		filepath.Join(MakePath(runtime.AssetsPath), "shortcodes", "test_shortcode.html"),
+	}
+	if !slices.Equal(actual, expected) {
+		t.Errorf("Expected: %s, actual: %s", expected, actual)
+	}
+
+	runtime.AssetsPath = "test/no_assets"
+	actual, err = GetShortcodeFiles(runtime)
+	if err != nil {
+		t.Errorf("Unexpected error from GetShortcodeFiles without a shortcodes directory: %s", err)
+	}
+	if len(actual) != 0 {
+		t.Errorf("Expected no shortcodes, actual: %s", actual)
+	}
+}
+
 func TestGetRepoRoot(t *testing.T) {
 	runtime := NewTestRuntime()
 	t.Cleanup(func() {
@@ -131,7 +181,7 @@ func TestSetupBuild(t *testing.T) {
 		}
 	})
 
-	if err := SetupBuild(runtime); err != nil {
+	if err := SetupBuild(runtime, nil); err != nil {
 		t.Errorf("Unexpected error from SetupBuild: %s", err)
 	}
 	dir, err := os.ReadDir(MakePath(runtime.BuildPath))
@@ -216,6 +266,49 @@ func TestClean(t *testing.T) {
 	}
 }
 
+func TestGitLastModified(t *testing.T) {
+	if GitLastModified("go.mod").IsZero() {
+		t.Errorf("Expected go.mod to have a last modified time from git")
+	}
+	if actual := GitLastModified("not_a_tracked_file.md"); !actual.IsZero() {
+		t.Errorf("Expected zero time for an untracked file, actual: %s", actual)
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	runtime := NewTestRuntime()
+	runtime.AssetsPath = "test/new_assets"
+	t.Cleanup(func() {
+		if err := Clean(MakePath(runtime.AssetsPath)); err != nil {
+			t.Errorf("Cleanup Unexpected error from Clean: %s", err)
+		}
+	})
+	now := time.Date(2024, 4, 10, 17, 0, 0, 0, time.UTC)
+
+	pagePath, err := NewPage(runtime, "posts/my_new_post", "", true, now)
+	if err != nil {
+		t.Fatalf("Unexpected error from NewPage: %s", err)
+	}
+	if expected := MakePath("test/new_assets/pages/posts/my_new_post.md"); pagePath != expected {
+		t.Errorf("Expected: %s, actual: %s", expected, pagePath)
+	}
+	b, err := os.ReadFile(pagePath)
+	if err != nil {
+		t.Fatalf("Unexpected error reading new page: %s", err)
+	}
+	expected := "---\ntitle: \"My New Post\"\ndate: 2024-04-10T17:00:00Z\ndraft: true\n---\n\n"
+	if string(b) != expected {
+		t.Errorf("Expected: %s, actual: %s", expected, string(b))
+	}
+
+	if _, err := NewPage(runtime, "posts/my_new_post.md", "Other", false, now); err == nil {
+		t.Errorf("Expected an error creating a page that already exists")
+	}
+	if _, err := NewPage(runtime, "../escaped", "", false, now); err == nil {
+		t.Errorf("Expected an error creating a page outside of the pages directory")
+	}
+}
+
 func TestGetCurrentEasternTime(t *testing.T) {
 	location, err := time.LoadLocation("America/New_York")
 	if err != nil {
@@ -310,58 +403,3 @@ func TestMakeNavTitleFromHref(t *testing.T) {
 		}
 	}
 }
-
-func TestMakeHref(t *testing.T) {
-	runtime := NewTestRuntime()
-	t.Cleanup(func() {
-		if err := Clean(MakePath(runtime.BuildPath)); err != nil {
-			t.Errorf("Unexpected error from Clean: %s", err)
-		}
-	})
-	cases := []struct {
-		assetName, originalPath, expect string
-	}{
-		{
-			"testing_1_2_3", "test/posts", "/posts/testing_1_2_3",
-		},
-		{
-			"file_name", "test123/xyz", "/xyz/file_name",
-		},
-		{
-			"index", "website/test123/files", "/files/index",
-		},
-	}
-	for _, c := range cases {
-		actual := makeHref(c.assetName, c.originalPath)
-		if actual != c.expect {
-			t.Errorf("Expected: %s, actual: %s", c.expect, actual)
-		}
-	}
-}
-
-func TestMakeHrefs(t *testing.T) {
-	runtime := NewTestRuntime()
-	t.Cleanup(func() {
-		if err := Clean(MakePath(runtime.BuildPath)); err != nil {
-			t.Errorf("Unexpected error from Clean: %s", err)
-		}
-	})
-	cases := []struct {
-		path   string
-		expect []string
-	}{
-		{
-			filepath.Join(MakePath(runtime.AssetsPath), "pages"),
-			[]string{"/pages/post_0", "/pages/post_1", "/pages/post_2"},
-		},
-	}
-	for _, c := range cases {
-		actual, err := makeHrefs(c.path)
-		if err != nil {
-			t.Errorf("Unexpected error: %s", err)
-		}
-		if !reflect.DeepEqual(actual, c.expect) {
-			t.Errorf("Expected: %s, actual: %s", c.expect, actual)
-		}
-	}
-}